@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// adoptedLabelKey records when a pre-existing server was taken over by the group.
+const adoptedLabelKey = "fleeting-adopted-at"
+
+// adoptServers labels existing servers in the zone whose hostname starts with
+// AdoptByPrefix as members of this group, so fleets migrated from other
+// executors are taken over rather than recreated. Servers already belonging
+// to a group are left alone. It returns the number of servers adopted.
+func (g *InstanceGroup) adoptServers(ctx context.Context) (int, error) {
+	if g.AdoptByPrefix == "" {
+		return 0, nil
+	}
+
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{})
+	if err != nil {
+		return 0, fmt.Errorf("listing servers: %w", err)
+	}
+
+	adopted := 0
+	for _, s := range servers.Servers {
+		if s.Zone != g.Zone || !strings.HasPrefix(s.Hostname, g.AdoptByPrefix) {
+			continue
+		}
+		ok, err := g.adoptServer(ctx, s.UUID)
+		if err != nil {
+			return adopted, err
+		}
+		if ok {
+			g.log.Info("adopted server into group", "uuid", s.UUID, "hostname", s.Hostname)
+			adopted++
+		}
+	}
+	return adopted, nil
+}
+
+// adoptServer adds the group label to a single server, keeping its existing
+// labels. It reports false if the server already belongs to a group.
+func (g *InstanceGroup) adoptServer(ctx context.Context, uuid string) (bool, error) {
+	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid})
+	if err != nil {
+		return false, fmt.Errorf("getting server details for %s: %w", uuid, err)
+	}
+
+	for _, l := range details.Labels {
+		if l.Key == g.GroupLabelKey {
+			if l.Value != g.Name {
+				g.log.Warn("not adopting server owned by another group", "uuid", uuid, "hostname", details.Hostname, "group", l.Value)
+			}
+			return false, nil
+		}
+	}
+
+	labels := upcloud.LabelSlice{}
+	for _, l := range details.Labels {
+		if _, ok := g.LabelFilters[l.Key]; !ok {
+			labels = append(labels, l)
+		}
+	}
+	labels = append(labels,
+		upcloud.Label{Key: g.GroupLabelKey, Value: g.Name},
+		upcloud.Label{Key: adoptedLabelKey, Value: strconv.FormatInt(time.Now().Unix(), 10)},
+	)
+	// Without the filter labels Update would never list the server.
+	for _, k := range slices.Sorted(maps.Keys(g.LabelFilters)) {
+		labels = append(labels, upcloud.Label{Key: k, Value: g.LabelFilters[k]})
+	}
+	if _, err := g.svc.ModifyServer(ctx, &request.ModifyServerRequest{UUID: uuid, Labels: &labels}); err != nil {
+		return false, fmt.Errorf("labelling server %s: %w", uuid, err)
+	}
+	return true, nil
+}
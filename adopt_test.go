@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── server adoption ──────────────────────────────────────────────────────────
+
+func TestAdoptServers(t *testing.T) {
+	modified := map[string]upcloud.LabelSlice{}
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(_ context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		if len(r.Filters) != 0 {
+			t.Errorf("filters = %v, want none", r.Filters)
+		}
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "uuid-legacy", Hostname: "runner-dm-1", Zone: "fi-hel1"},
+			{UUID: "uuid-member", Hostname: "runner-dm-2", Zone: "fi-hel1"},
+			{UUID: "uuid-other", Hostname: "runner-dm-3", Zone: "fi-hel1"},
+			{UUID: "uuid-zone", Hostname: "runner-dm-4", Zone: "de-fra1"},
+			{UUID: "uuid-db", Hostname: "database", Zone: "fi-hel1"},
+		}}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := &upcloud.ServerDetails{Server: upcloud.Server{UUID: r.UUID}}
+		switch r.UUID {
+		case "uuid-legacy":
+			d.Labels = upcloud.LabelSlice{{Key: "team", Value: "ci"}}
+		case "uuid-member":
+			d.Labels = upcloud.LabelSlice{{Key: groupLabelKey, Value: "test-group"}}
+		case "uuid-other":
+			d.Labels = upcloud.LabelSlice{{Key: groupLabelKey, Value: "other-group"}}
+		default:
+			t.Errorf("unexpected details lookup for %s", r.UUID)
+		}
+		return d, nil
+	}
+	mock.modifyServer = func(_ context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		modified[r.UUID] = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.AdoptByPrefix = "runner-dm-"
+
+	n, err := g.adoptServers(context.Background())
+	if err != nil {
+		t.Fatalf("adoptServers() unexpected error: %v", err)
+	}
+	if n != 1 || len(modified) != 1 {
+		t.Fatalf("adopted %d servers (modified %v), want only uuid-legacy", n, modified)
+	}
+	labels := modified["uuid-legacy"]
+	if v, _ := labelValue(labels, groupLabelKey); v != "test-group" {
+		t.Errorf("group label = %q, want test-group", v)
+	}
+	if v, _ := labelValue(labels, "team"); v != "ci" {
+		t.Error("existing labels were not preserved")
+	}
+	if _, ok := labelValue(labels, adoptedLabelKey); !ok {
+		t.Error("adopted-at label missing")
+	}
+}
+
+func TestAdoptServers_Disabled(t *testing.T) {
+	// The mock panics on any call, so nothing may reach the API.
+	g := baseGroup(newMockSvc())
+	if n, err := g.adoptServers(context.Background()); n != 0 || err != nil {
+		t.Errorf("adoptServers() = (%d, %v), want (0, nil)", n, err)
+	}
+}
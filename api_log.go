@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// apiLogBodyLimit caps how much of a request or response body is logged.
+const apiLogBodyLimit = 4096
+
+// redactedAPIKeys are JSON keys whose values never appear in API logs.
+var redactedAPIKeys = map[string]bool{
+	"password":               true,
+	"remote_access_password": true,
+	"user_data":              true,
+}
+
+// correlationHeaders are response headers that may carry an ID identifying the
+// request on the UpCloud side.
+var correlationHeaders = []string{"X-Request-Id", "X-Correlation-Id", "Upcloud-Request-Id"}
+
+// apiLogTransport logs every UpCloud API call. Authorization headers are never
+// logged and sensitive body fields are redacted.
+type apiLogTransport struct {
+	next http.RoundTripper
+	log  hclog.Logger
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *apiLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+
+	if err != nil {
+		t.log.Info("API call failed", "method", req.Method, "path", req.URL.Path, "duration", duration, "error", err,
+			"request", redactBody(reqBody))
+		return nil, err
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if readErr != nil {
+		return resp, readErr
+	}
+
+	t.log.Info("API call", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode,
+		"duration", duration, "correlation_id", correlationID(resp.Header),
+		"request", redactBody(reqBody), "response", redactBody(respBody))
+	return resp, nil
+}
+
+// correlationID returns the first correlation header present in h.
+func correlationID(h http.Header) string {
+	for _, name := range correlationHeaders {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// redactBody renders a JSON body for logging with sensitive fields replaced.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("[%d bytes of non-JSON body]", len(body))
+	}
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+	if len(b) > apiLogBodyLimit {
+		return string(b[:apiLogBodyLimit]) + "…(truncated)"
+	}
+	return string(b)
+}
+
+// redactValue walks a decoded JSON value replacing sensitive fields in place.
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, inner := range v {
+			if redactedAPIKeys[k] {
+				v[k] = "[REDACTED]"
+				continue
+			}
+			v[k] = redactValue(inner)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
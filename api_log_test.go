@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ─── API debug logging ────────────────────────────────────────────────────────
+
+func TestRedactBody(t *testing.T) {
+	in := `{"server":{"hostname":"h","user_data":"#!/bin/sh\nsecret","login_user":{"password":"p"},"items":[{"password":"q"}]}}`
+	got := redactBody([]byte(in))
+
+	for _, secret := range []string{"secret", `"p"`, `"q"`} {
+		if strings.Contains(got, secret) {
+			t.Errorf("redactBody() leaked %s: %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, `"hostname":"h"`) {
+		t.Errorf("redactBody() dropped non-sensitive fields: %s", got)
+	}
+	if got := redactBody([]byte("not json")); !strings.Contains(got, "non-JSON") {
+		t.Errorf("redactBody(non-JSON) = %q", got)
+	}
+	if got := redactBody(nil); got != "" {
+		t.Errorf("redactBody(nil) = %q, want empty", got)
+	}
+}
+
+func TestAPILogTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-123")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"server":{"uuid":"u1","remote_access_password":"vnc"}}`)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{Output: &buf, Level: hclog.Trace})
+	c := &http.Client{Transport: &apiLogTransport{next: http.DefaultTransport, log: logger}}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/1.3/server", strings.NewReader(`{"server":{"user_data":"token=abc"}}`))
+	req.Header.Set("Authorization", "Bearer ucat_secret")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), "u1") {
+		t.Errorf("response body not passed through: %q", body)
+	}
+	out := buf.String()
+	for _, want := range []string{"POST", "/1.3/server", "201", "req-123"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log missing %q: %s", want, out)
+		}
+	}
+	for _, secret := range []string{"ucat_secret", "token=abc", "vnc"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaked %q: %s", secret, out)
+		}
+	}
+}
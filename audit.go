@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Audited lifecycle actions.
+const (
+	auditCreate  = "create"
+	auditStop    = "stop"
+	auditDelete  = "delete"
+	auditRestart = "restart"
+)
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Outcome  string    `json:"outcome"` // "success" or "failure"
+	Group    string    `json:"group"`
+	Instance string    `json:"instance,omitempty"`
+	Hostname string    `json:"hostname,omitempty"`
+	Zone     string    `json:"zone"`
+	Plan     string    `json:"plan"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// audit appends a lifecycle record to the audit log, if one is configured.
+// zone is the zone the server is in, which differs from the group's for
+// servers created in a fallback zone; empty means the group's zone.
+// The file is opened per write so external log rotation needs no signalling.
+func (g *InstanceGroup) audit(action, instance, hostname, zone string, cause error) {
+	if g.AuditLog == "" {
+		return
+	}
+
+	rec := auditRecord{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Outcome:  "success",
+		Group:    g.Name,
+		Instance: instance,
+		Hostname: hostname,
+		Zone:     zone,
+		Plan:     g.Plan,
+	}
+	if rec.Zone == "" {
+		rec.Zone = g.Zone
+	}
+	if cause != nil {
+		rec.Outcome = "failure"
+		rec.Error = cause.Error()
+	}
+
+	if err := g.writeAudit(rec); err != nil {
+		g.log.Error("failed to write audit log", "path", g.AuditLog, "error", err)
+	}
+}
+
+// writeAudit appends a single JSON line to the audit log.
+func (g *InstanceGroup) writeAudit(rec auditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	g.auditMu.Lock()
+	defer g.auditMu.Unlock()
+
+	f, err := os.OpenFile(g.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkAuditLog verifies at startup that the audit log can be written.
+func (g *InstanceGroup) checkAuditLog() error {
+	if g.AuditLog == "" {
+		return nil
+	}
+	f, err := os.OpenFile(g.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit_log: %w", err)
+	}
+	return f.Close()
+}
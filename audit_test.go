@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── audit log ────────────────────────────────────────────────────────────────
+
+// readAudit parses every record in the audit log at path.
+func readAudit(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening audit log: %v", err)
+	}
+	defer f.Close()
+
+	var recs []auditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("audit line %q is not JSON: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestAudit_Increase(t *testing.T) {
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("quota exceeded")
+		}
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	if _, err := g.Increase(context.Background(), 2); err != nil {
+		t.Fatalf("Increase() unexpected error: %v", err)
+	}
+
+	recs := readAudit(t, g.AuditLog)
+	if len(recs) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(recs))
+	}
+	ok, failed := recs[0], recs[1]
+	if ok.Action != auditCreate || ok.Outcome != "success" || ok.Instance != "uuid-1" ||
+		ok.Zone != g.Zone || ok.Plan != g.Plan || ok.Hostname == "" {
+		t.Errorf("success record = %+v", ok)
+	}
+	if failed.Outcome != "failure" || failed.Error != "quota exceeded" || failed.Hostname == "" {
+		t.Errorf("failure record = %+v", failed)
+	}
+}
+
+func TestAudit_FallbackZone(t *testing.T) {
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		if r.Zone == "fi-hel1" {
+			return nil, outOfCapacity
+		}
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FallbackZones = []string{"fi-hel2"}
+	g.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+	if _, err := g.Increase(context.Background(), 1); err != nil {
+		t.Fatalf("Increase() unexpected error: %v", err)
+	}
+
+	recs := readAudit(t, g.AuditLog)
+	if len(recs) != 1 || recs[0].Zone != "fi-hel2" {
+		t.Errorf("audit records = %+v, want one create in fi-hel2", recs)
+	}
+}
+
+func TestAudit_Decrease(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.Hostname = "fleeting-abc"
+		return d, nil
+	}
+	mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+
+	recs := readAudit(t, g.AuditLog)
+	if len(recs) != 2 || recs[0].Action != auditStop || recs[1].Action != auditDelete {
+		t.Fatalf("audit records = %+v, want stop then delete", recs)
+	}
+	for _, rec := range recs {
+		if rec.Instance != "uuid-1" || rec.Hostname != "fleeting-abc" || rec.Outcome != "success" {
+			t.Errorf("record = %+v", rec)
+		}
+	}
+}
+
+func TestAudit_Disabled(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	// Must be a no-op without a path configured.
+	g.audit(auditCreate, "uuid-1", "host", "", nil)
+}
+
+func TestCheckAuditLog_Unwritable(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.AuditLog = filepath.Join(t.TempDir(), "missing", "audit.jsonl")
+	if err := g.checkAuditLog(); err == nil {
+		t.Fatal("checkAuditLog() expected error for missing directory, got nil")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+const (
+	// bakeLabelKey marks the temporary build server with the group name. It is
+	// deliberately not the group label, so Update never reports it.
+	bakeLabelKey = "fleeting-bake"
+
+	defaultBakeTimeout    = 30 * time.Minute
+	bakeSSHRetryInterval  = 5 * time.Second
+	bakeCleanupTimeout    = 5 * time.Minute
+	bakeSoftStopTimeout   = 2 * time.Minute
+	defaultBakeLoginUser  = "root"
+	bakeTemplateTitleDate = "2006-01-02 15:04"
+)
+
+// labelFlag collects repeated key=value flags.
+type labelFlag map[string]string
+
+func (l labelFlag) String() string { return fmt.Sprint(map[string]string(l)) }
+
+func (l labelFlag) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("label %q must be key=value with a valid label key", v)
+	}
+	l[key] = value
+	return nil
+}
+
+// bakeOptions describe one template build.
+type bakeOptions struct {
+	Base     string // template the build server is cloned from
+	Script   string // provisioning script body
+	Title    string // title of the resulting template
+	Labels   map[string]string
+	Username string
+}
+
+// runBakeTemplate implements `bake-template --config <file> --base <uuid>
+// --script <file> [--title <title>] [--label key=value]...`. Progress goes to
+// stderr; only the new template UUID is printed to stdout.
+func runBakeTemplate(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("bake-template", stdout)
+	base := fs.String("base", "", "UUID of the template to start from, e.g. a public OS template")
+	script := fs.String("script", "", "path of the provisioning script run on the build server")
+	title := fs.String("title", "", "title of the new template (default: group name and date)")
+	username := fs.String("username", defaultBakeLoginUser, "login user the script runs as")
+	timeout := fs.Duration("timeout", defaultBakeTimeout, "time limit for the whole build")
+	labels := labelFlag{}
+	fs.Var(labels, "label", "key=value label for the new template, e.g. for template_selector (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *base == "" || *script == "" {
+		return fmt.Errorf("--base and --script are required")
+	}
+	body, err := os.ReadFile(*script)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+
+	g, err := loadGroup(ctx, *config)
+	if err != nil {
+		return err
+	}
+	if *title == "" {
+		*title = fmt.Sprintf("%s %s", g.Name, time.Now().UTC().Format(bakeTemplateTitleDate))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	uuid, err := g.bakeTemplate(ctx, bakeOptions{
+		Base:     *base,
+		Script:   string(body),
+		Title:    *title,
+		Labels:   labels,
+		Username: *username,
+	}, os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, uuid)
+	return nil
+}
+
+// bakeTemplate boots a build server from opts.Base, runs the provisioning
+// script on it, shuts it down and turns its disk into a new template. The
+// build server is always removed afterwards.
+func (g *InstanceGroup) bakeTemplate(ctx context.Context, opts bakeOptions, progress io.Writer) (_ string, err error) {
+	pub, priv, err := generateSSHKeyPair()
+	if err != nil {
+		return "", err
+	}
+
+	hostname := fmt.Sprintf("%s-bake-%s", g.NamePrefix, randomSuffix(g.SuffixLength))
+	fmt.Fprintf(progress, "creating build server %s from %s\n", hostname, opts.Base)
+	details, err := g.svc.CreateServer(ctx, &request.CreateServerRequest{
+		Hostname: hostname,
+		Title:    fmt.Sprintf("fleeting-plugin-upcloud - %s", hostname),
+		Plan:     g.Plan,
+		Zone:     g.Zone,
+		Metadata: upcloud.True,
+		StorageDevices: request.CreateServerStorageDeviceSlice{{
+			Action:  request.CreateServerStorageDeviceActionClone,
+			Storage: opts.Base,
+			Title:   "disk1",
+			Size:    g.StorageSize,
+			Tier:    g.StorageTier,
+		}},
+		Networking: g.networking(),
+		LoginUser:  &request.LoginUser{Username: opts.Username, SSHKeys: request.SSHKeySlice{pub}},
+		Labels:     &upcloud.LabelSlice{{Key: bakeLabelKey, Value: g.Name}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating build server: %w", err)
+	}
+	uuid := details.UUID
+
+	stopped := false
+	defer func() {
+		// The caller's context may already be done; cleanup gets its own.
+		cctx, cancel := context.WithTimeout(context.Background(), bakeCleanupTimeout)
+		defer cancel()
+		if cerr := g.removeBuildServer(cctx, uuid, stopped); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("build server %s was left behind: %w", uuid, cerr))
+		}
+	}()
+
+	if details, err = g.svc.WaitForServerState(ctx, &request.WaitForServerStateRequest{
+		UUID:         uuid,
+		DesiredState: upcloud.ServerStateStarted,
+	}); err != nil {
+		return "", fmt.Errorf("waiting for build server to start: %w", err)
+	}
+	if details, err = g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid}); err != nil {
+		return "", fmt.Errorf("getting build server details: %w", err)
+	}
+	addr := buildServerAddress(details)
+	if addr == "" {
+		return "", fmt.Errorf("build server %s has no IPv4 address", uuid)
+	}
+	info := provider.ConnectInfo{
+		ConnectorConfig: provider.ConnectorConfig{Username: opts.Username, Key: priv, Protocol: provider.ProtocolSSH},
+		ID:              uuid,
+		ExternalAddr:    addr,
+	}
+
+	fmt.Fprintf(progress, "waiting for SSH on %s\n", addr)
+	if err := waitForSSH(ctx, info); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintln(progress, "running provisioning script")
+	out, err := runSSHCommand(ctx, info, opts.Script)
+	progress.Write(out)
+	if err != nil {
+		return "", fmt.Errorf("provisioning script failed: %w", err)
+	}
+
+	// A soft stop lets the OS flush its disks before the image is taken.
+	fmt.Fprintln(progress, "stopping build server")
+	if _, err := g.svc.StopServer(ctx, &request.StopServerRequest{
+		UUID:     uuid,
+		StopType: request.ServerStopTypeSoft,
+		Timeout:  bakeSoftStopTimeout,
+	}); err != nil {
+		return "", fmt.Errorf("stopping build server: %w", err)
+	}
+	if _, err := g.svc.WaitForServerState(ctx, &request.WaitForServerStateRequest{
+		UUID:         uuid,
+		DesiredState: upcloud.ServerStateStopped,
+	}); err != nil {
+		return "", fmt.Errorf("waiting for build server to stop: %w", err)
+	}
+	stopped = true
+
+	if len(details.StorageDevices) == 0 {
+		return "", fmt.Errorf("build server %s has no storage", uuid)
+	}
+	fmt.Fprintf(progress, "creating template %q\n", opts.Title)
+	tmpl, err := g.svc.TemplatizeStorage(ctx, &request.TemplatizeStorageRequest{
+		UUID:  details.StorageDevices[0].UUID,
+		Title: opts.Title,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating template: %w", err)
+	}
+	if _, err := g.svc.WaitForStorageState(ctx, &request.WaitForStorageStateRequest{
+		UUID:         tmpl.UUID,
+		DesiredState: upcloud.StorageStateOnline,
+	}); err != nil {
+		return "", fmt.Errorf("waiting for template %s: %w", tmpl.UUID, err)
+	}
+
+	if len(opts.Labels) > 0 {
+		labels := make([]upcloud.Label, 0, len(opts.Labels))
+		for k, v := range opts.Labels {
+			labels = append(labels, upcloud.Label{Key: k, Value: v})
+		}
+		if _, err := g.svc.ModifyStorage(ctx, &request.ModifyStorageRequest{UUID: tmpl.UUID, Labels: &labels}); err != nil {
+			return "", fmt.Errorf("labelling template %s: %w", tmpl.UUID, err)
+		}
+	}
+	return tmpl.UUID, nil
+}
+
+// removeBuildServer deletes the build server and its disk; the template is a
+// separate storage and survives.
+func (g *InstanceGroup) removeBuildServer(ctx context.Context, uuid string, stopped bool) error {
+	if !stopped {
+		if _, err := g.svc.StopServer(ctx, &request.StopServerRequest{UUID: uuid, StopType: request.ServerStopTypeHard}); err != nil {
+			return fmt.Errorf("stopping: %w", err)
+		}
+		if _, err := g.svc.WaitForServerState(ctx, &request.WaitForServerStateRequest{
+			UUID:         uuid,
+			DesiredState: upcloud.ServerStateStopped,
+		}); err != nil {
+			return fmt.Errorf("waiting for stop: %w", err)
+		}
+	}
+	if err := g.svc.DeleteServerAndStorages(ctx, &request.DeleteServerAndStoragesRequest{UUID: uuid, Backups: g.backupsMode()}); err != nil {
+		return fmt.Errorf("deleting: %w", err)
+	}
+	return nil
+}
+
+// buildServerAddress returns the address to reach a build server on,
+// preferring its public IPv4 address, then public IPv6, then any other IPv4.
+func buildServerAddress(details *upcloud.ServerDetails) string {
+	var publicV6, fallback string
+	for _, ip := range details.IPAddresses {
+		if ip.Family == upcloud.IPAddressFamilyIPv6 && ip.Access == upcloud.IPAddressAccessPublic && publicV6 == "" {
+			publicV6 = ip.Address
+		}
+		if ip.Family != upcloud.IPAddressFamilyIPv4 {
+			continue
+		}
+		if ip.Access == upcloud.IPAddressAccessPublic {
+			return ip.Address
+		}
+		if fallback == "" {
+			fallback = ip.Address
+		}
+	}
+	if publicV6 != "" {
+		return publicV6
+	}
+	return fallback
+}
+
+// waitForSSH retries a no-op command until the server accepts SSH logins.
+func waitForSSH(ctx context.Context, info provider.ConnectInfo) error {
+	for {
+		_, err := runSSHCommand(ctx, info, "true")
+		if err == nil {
+			return nil
+		}
+		t := time.NewTimer(bakeSSHRetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("waiting for SSH: %w (last error: %w)", ctx.Err(), err)
+		case <-t.C:
+		}
+	}
+}
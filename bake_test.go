@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── bake-template ────────────────────────────────────────────────────────────
+
+// bakeMock simulates a build server, recording API calls in order.
+func bakeMock(calls *[]string) *mockSvc {
+	record := func(c string) { *calls = append(*calls, c) }
+	mock := newMockSvc()
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		record("create")
+		if _, ok := labelValue(*r.Labels, groupLabelKey); ok {
+			return nil, errors.New("build server must not carry the group label")
+		}
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "build-1"}}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, r *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		record("wait-" + r.DesiredState)
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("1.2.3.4", "")
+		d.StorageDevices = upcloud.ServerStorageDeviceSlice{{UUID: "disk-1"}}
+		return d, nil
+	}
+	mock.stopServer = func(_ context.Context, r *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		record("stop-" + r.StopType)
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.templatizeStorage = func(_ context.Context, r *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error) {
+		record("templatize-" + r.UUID)
+		return &upcloud.StorageDetails{Storage: upcloud.Storage{UUID: "template-new"}}, nil
+	}
+	mock.waitForStorageState = func(context.Context, *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error) {
+		record("wait-storage")
+		return &upcloud.StorageDetails{}, nil
+	}
+	mock.modifyStorage = func(_ context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+		record("label-" + r.UUID)
+		return &upcloud.StorageDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		record("delete-" + r.UUID)
+		return nil
+	}
+	return mock
+}
+
+func TestBakeTemplate(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		calls    []string
+		commands []string
+	)
+	stubSSH(t, func(_ context.Context, info provider.ConnectInfo, command string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if info.ExternalAddr != "1.2.3.4" || len(info.Key) == 0 {
+			return nil, errors.New("unexpected connect info")
+		}
+		commands = append(commands, command)
+		return []byte("provisioned\n"), nil
+	})
+
+	g := baseGroup(bakeMock(&calls))
+	var progress bytes.Buffer
+	uuid, err := g.bakeTemplate(context.Background(), bakeOptions{
+		Base:     "ubuntu-24.04",
+		Script:   "apt-get install -y docker.io",
+		Title:    "ci-runner",
+		Labels:   map[string]string{"image": "ci-runner"},
+		Username: "root",
+	}, &progress)
+	if err != nil {
+		t.Fatalf("bakeTemplate() unexpected error: %v", err)
+	}
+	if uuid != "template-new" {
+		t.Errorf("bakeTemplate() = %q, want template-new", uuid)
+	}
+
+	want := []string{
+		"create", "wait-started", "stop-soft", "wait-stopped",
+		"templatize-disk-1", "wait-storage", "label-template-new", "delete-build-1",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if len(commands) != 2 || commands[1] != "apt-get install -y docker.io" {
+		t.Errorf("SSH commands = %q, want readiness check then the script", commands)
+	}
+	if !bytes.Contains(progress.Bytes(), []byte("provisioned")) {
+		t.Error("script output not shown in progress")
+	}
+}
+
+func TestBakeTemplate_ScriptFailureRemovesBuildServer(t *testing.T) {
+	var calls []string
+	stubSSH(t, func(_ context.Context, _ provider.ConnectInfo, command string) ([]byte, error) {
+		if command == "true" {
+			return nil, nil
+		}
+		return []byte("E: package not found\n"), errors.New("exit status 100")
+	})
+
+	g := baseGroup(bakeMock(&calls))
+	_, err := g.bakeTemplate(context.Background(), bakeOptions{Base: "ubuntu-24.04", Script: "false", Username: "root"}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("bakeTemplate() expected error, got nil")
+	}
+	want := []string{"create", "wait-started", "stop-hard", "wait-stopped", "delete-build-1"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestLabelFlag(t *testing.T) {
+	l := labelFlag{}
+	if err := l.Set("image=ci-runner"); err != nil || l["image"] != "ci-runner" {
+		t.Errorf("Set(image=ci-runner) = %v, labels %v", err, l)
+	}
+	for _, bad := range []string{"no-value", "bad key=x"} {
+		if err := l.Set(bad); err == nil {
+			t.Errorf("Set(%q) expected error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultBastionPort is used when bastion_address has no port.
+const defaultBastionPort = "22"
+
+// bastion forwards local ports to instances through an SSH jump host. The
+// runner dials the local port, so instances on a private network are
+// reachable without a route from the runner manager.
+type bastion struct {
+	addr   string
+	config *ssh.ClientConfig
+	log    hclog.Logger
+
+	mu       sync.Mutex
+	client   *ssh.Client
+	forwards map[string]*bastionForward // by server UUID
+}
+
+// bastionForward is a local listener relaying connections to target.
+type bastionForward struct {
+	target string
+	ln     net.Listener
+}
+
+// initBastion prepares the jump host connection when bastion_address is set.
+// The connection itself is only opened on first use.
+func (g *InstanceGroup) initBastion() error {
+	if g.BastionAddress == "" {
+		return nil
+	}
+
+	var signer ssh.Signer
+	if g.BastionKeyFile != "" {
+		key, err := os.ReadFile(g.BastionKeyFile)
+		if err != nil {
+			return fmt.Errorf("reading bastion_key_file: %w", err)
+		}
+		if signer, err = ssh.ParsePrivateKey(key); err != nil {
+			return fmt.Errorf("parsing bastion_key_file: %w", err)
+		}
+	} else {
+		if len(g.settings.ConnectorConfig.Key) == 0 {
+			return errors.New("bastion_address requires bastion_key_file or a connector_config key")
+		}
+		passphrase, err := g.keyPassphrase()
+		if err != nil {
+			return err
+		}
+		if signer, _, err = parsePrivateKey(g.settings.ConnectorConfig.Key, passphrase); err != nil {
+			return fmt.Errorf("parsing SSH private key for bastion: %w", err)
+		}
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if g.BastionHostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(g.BastionHostKey))
+		if err != nil {
+			return fmt.Errorf("parsing bastion_host_key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(key)
+	} else {
+		g.log.Warn("bastion_host_key is not set; the bastion's host key will not be verified", "bastion", g.BastionAddress)
+	}
+
+	user := g.BastionUser
+	if user == "" {
+		user = g.settings.ConnectorConfig.Username
+	}
+	addr := g.BastionAddress
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultBastionPort)
+	}
+
+	g.bastion = &bastion{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sshDialTimeout,
+		},
+		log:      g.log.Named("bastion"),
+		forwards: make(map[string]*bastionForward),
+	}
+	return nil
+}
+
+// routeThroughBastion rewrites info so the runner connects through a local
+// port forwarded over the bastion to the instance's internal address.
+func (g *InstanceGroup) routeThroughBastion(info *provider.ConnectInfo) error {
+	addr := info.InternalAddr
+	if addr == "" {
+		addr = info.ExternalAddr
+	}
+	if addr == "" {
+		return fmt.Errorf("instance %s has no address", info.ID)
+	}
+	port := info.ProtocolPort
+	if port == 0 {
+		port = provider.DefaultProtocolPorts[info.Protocol]
+	}
+
+	local, err := g.bastion.forward(info.ID, net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("forwarding to %s through bastion: %w", info.ID, err)
+	}
+	info.ExternalAddr = "127.0.0.1"
+	info.InternalAddr = "127.0.0.1"
+	info.ProtocolPort = local
+	return nil
+}
+
+// forward returns the local port relaying to target for a server, opening a
+// listener the first time or when the target has changed.
+func (b *bastion) forward(uuid, target string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if f, ok := b.forwards[uuid]; ok {
+		if f.target == target {
+			return f.ln.Addr().(*net.TCPAddr).Port, nil
+		}
+		f.ln.Close()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	b.forwards[uuid] = &bastionForward{target: target, ln: ln}
+	go b.serve(ln, target)
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// serve relays connections accepted on ln until the listener is closed.
+func (b *bastion) serve(ln net.Listener, target string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.relay(conn, target)
+	}
+}
+
+// relay copies data between a local connection and target until either
+// side closes.
+func (b *bastion) relay(conn net.Conn, target string) {
+	defer conn.Close()
+
+	remote, err := b.dial(target)
+	if err != nil {
+		b.log.Warn("cannot reach instance through bastion", "target", target, "error", err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(remote, conn); done <- struct{}{} }()
+	go func() { io.Copy(conn, remote); done <- struct{}{} }()
+	<-done
+}
+
+// dial opens a connection to target through the bastion, reconnecting once
+// if the existing SSH connection has gone away.
+func (b *bastion) dial(target string) (net.Conn, error) {
+	client, err := b.connect(nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", target)
+	if err == nil {
+		return conn, nil
+	}
+	if client, err = b.connect(client); err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", target)
+}
+
+// connect returns the shared SSH client, replacing it when it is stale.
+func (b *bastion) connect(stale *ssh.Client) (*ssh.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil && b.client != stale {
+		return b.client, nil
+	}
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+	client, err := ssh.Dial("tcp", b.addr, b.config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to bastion %s: %w", b.addr, err)
+	}
+	b.client = client
+	return client, nil
+}
+
+// close stops forwarding for a removed server.
+func (b *bastion) close(uuid string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if f, ok := b.forwards[uuid]; ok {
+		f.ln.Close()
+		delete(b.forwards, uuid)
+	}
+}
+
+// closeAll stops every forward and disconnects from the bastion.
+func (b *bastion) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for uuid, f := range b.forwards {
+		f.ln.Close()
+		delete(b.forwards, uuid)
+	}
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// ─── bastion ──────────────────────────────────────────────────────────────────
+
+// testBastion starts an SSH server on localhost that accepts any client key
+// and serves direct-tcpip channels. It returns its address and host key.
+func testBastion(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) { return nil, nil },
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					var dest struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+					if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &dest) != nil {
+						nc.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					target, err := net.Dial("tcp", net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port))))
+					if err != nil {
+						nc.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, reqs, err := nc.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(reqs)
+					go func() { io.Copy(ch, target); ch.Close() }()
+					go func() { io.Copy(target, ch); target.Close() }()
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+// echoServer starts a TCP server echoing back everything it receives.
+func echoServer(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(conn, conn); conn.Close() }()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestConnectInfo_Bastion(t *testing.T) {
+	bastionAddr, hostKey := testBastion(t)
+	port := echoServer(t)
+	_, key, err := generateSSHKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", "127.0.0.1"), nil
+	}
+	g := baseGroup(mock)
+	g.BastionAddress = bastionAddr
+	g.BastionHostKey = string(ssh.MarshalAuthorizedKey(hostKey))
+	g.settings.ConnectorConfig = provider.ConnectorConfig{Username: "runner", Key: key, ProtocolPort: port}
+	if err := g.initBastion(); err != nil {
+		t.Fatalf("initBastion() unexpected error: %v", err)
+	}
+	defer g.bastion.closeAll()
+
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.ExternalAddr != "127.0.0.1" || info.InternalAddr != "127.0.0.1" || info.ProtocolPort == port {
+		t.Fatalf("ConnectInfo() = %s/%s:%d, want a local forwarded port", info.ExternalAddr, info.InternalAddr, info.ProtocolPort)
+	}
+	if again, _ := g.ConnectInfo(context.Background(), "uuid-1"); again.ProtocolPort != info.ProtocolPort {
+		t.Errorf("second ConnectInfo() port = %d, want the existing forward %d", again.ProtocolPort, info.ProtocolPort)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(info.ExternalAddr, strconv.Itoa(info.ProtocolPort)))
+	if err != nil {
+		t.Fatalf("dialing forwarded port: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("read %q (%v) through bastion, want ping", buf, err)
+	}
+}
+
+func TestInitBastion_RequiresKey(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.BastionAddress = "bastion.example.com"
+	if err := g.initBastion(); err == nil {
+		t.Fatal("initBastion() expected error without any key, got nil")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// billingDateLayout is the date format accepted by --from and --to besides
+// RFC 3339.
+const billingDateLayout = "2006-01-02"
+
+// billingLine is the estimated spend on one plan in one zone.
+type billingLine struct {
+	Zone         string  `json:"zone"`
+	Plan         string  `json:"plan"`
+	Instances    int     `json:"instances"`
+	Hours        float64 `json:"hours"`
+	PricePerHour float64 `json:"price_per_hour"` // EUR; zero if unknown
+	Cost         float64 `json:"cost"`           // EUR
+}
+
+// billingReport is the estimated spend of the group over a time window.
+type billingReport struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Lines []billingLine `json:"lines"`
+	Total float64       `json:"total"` // EUR
+	// Unpriced lists zone/plan pairs missing from the price list, whose
+	// hours are not included in the total.
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// runBilling implements `billing --config <file> [--from date] [--to date]
+// [--format table|json]`.
+func runBilling(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("billing", stdout)
+	fromFlag := fs.String("from", "", "start of the window, YYYY-MM-DD or RFC 3339 (default: start of the month)")
+	toFlag := fs.String("to", "", "end of the window, YYYY-MM-DD or RFC 3339 (default: now)")
+	format := fs.String("format", "table", `output format: "table" or "json"`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	var err error
+	if *fromFlag != "" {
+		if from, err = parseBillingTime(*fromFlag); err != nil {
+			return fmt.Errorf("--from: %w", err)
+		}
+	}
+	if *toFlag != "" {
+		if to, err = parseBillingTime(*toFlag); err != nil {
+			return fmt.Errorf("--to: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("--from must be before --to")
+	}
+
+	g, err := loadGroup(ctx, *config)
+	if err != nil {
+		return err
+	}
+	if g.StateFile == "" {
+		g.log.Warn("state_file is not set; only servers that still exist are counted")
+	}
+	if g.store, err = loadStateStore(g.StateFile); err != nil {
+		return err
+	}
+	records, err := g.billingRecords(ctx)
+	if err != nil {
+		return err
+	}
+	prices, err := g.svc.GetPricesByZone(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching prices: %w", err)
+	}
+
+	r := estimateSpend(records, *prices, from, to)
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return writeBillingTable(stdout, r)
+}
+
+// parseBillingTime parses a date or an RFC 3339 timestamp.
+func parseBillingTime(s string) (time.Time, error) {
+	if t, err := time.Parse(billingDateLayout, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// billingRecords combines the instance history kept next to the state file with
+// the group's current servers, which may predate the history or have been
+// adopted. Missing zones and plans default to the group's.
+func (g *InstanceGroup) billingRecords(ctx context.Context) ([]instanceRecord, error) {
+	records, err := g.store.history()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(records))
+	for _, r := range records {
+		known[r.UUID] = true
+	}
+
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{Filters: g.groupFilters()})
+	if err != nil {
+		return nil, fmt.Errorf("listing group servers: %w", err)
+	}
+	for _, s := range servers.Servers {
+		if known[s.UUID] {
+			continue
+		}
+		created, ok := g.serverCreatedAt(ctx, s.UUID)
+		if !ok {
+			g.log.Warn("creation time unknown; counting the whole window", "uuid", s.UUID, "hostname", s.Hostname)
+		}
+		records = append(records, instanceRecord{UUID: s.UUID, Hostname: s.Hostname, Zone: s.Zone, Plan: s.Plan, Created: created})
+	}
+
+	for i := range records {
+		if records[i].Zone == "" {
+			records[i].Zone = g.Zone
+		}
+		if records[i].Plan == "" {
+			records[i].Plan = g.Plan
+		}
+	}
+	return records, nil
+}
+
+// estimateSpend prices the part of each server's lifetime within [from, to).
+// Servers not yet deleted are counted up to the end of the window. UpCloud
+// lists prices in cents per hour.
+func estimateSpend(records []instanceRecord, prices upcloud.PricesByZone, from, to time.Time) billingReport {
+	type key struct{ zone, plan string }
+	lines := map[key]*billingLine{}
+	for _, r := range records {
+		start, end := r.Created, r.Deleted
+		if start.Before(from) {
+			start = from
+		}
+		if end.IsZero() || end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+		k := key{r.Zone, r.Plan}
+		l, ok := lines[k]
+		if !ok {
+			l = &billingLine{Zone: r.Zone, Plan: r.Plan}
+			lines[k] = l
+		}
+		l.Instances++
+		l.Hours += end.Sub(start).Hours()
+	}
+
+	report := billingReport{From: from, To: to, Lines: []billingLine{}}
+	for _, l := range lines {
+		price, ok := prices[l.Zone][planPriceKey+l.Plan]
+		if ok {
+			l.PricePerHour = price.Price / 100
+			l.Cost = l.Hours * l.PricePerHour
+			report.Total += l.Cost
+		} else {
+			report.Unpriced = append(report.Unpriced, l.Zone+"/"+l.Plan)
+		}
+		report.Lines = append(report.Lines, *l)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		return a.Zone < b.Zone || a.Zone == b.Zone && a.Plan < b.Plan
+	})
+	sort.Strings(report.Unpriced)
+	return report
+}
+
+// writeBillingTable prints a billing report as an aligned table.
+func writeBillingTable(w io.Writer, r billingReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Estimated spend from %s to %s\n\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339))
+	fmt.Fprintln(tw, "ZONE\tPLAN\tINSTANCES\tHOURS\tEUR/HOUR\tEUR")
+	for _, l := range r.Lines {
+		price := "-"
+		if l.PricePerHour > 0 {
+			price = fmt.Sprintf("%.4f", l.PricePerHour)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%s\t%.2f\n", l.Zone, l.Plan, l.Instances, l.Hours, price, l.Cost)
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t\t\t%.2f\n", r.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, u := range r.Unpriced {
+		fmt.Fprintf(w, "warning: no price for %s; its hours are not in the total\n", u)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// ─── billing command ──────────────────────────────────────────────────────────
+
+func TestEstimateSpend(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(30 * 24 * time.Hour)
+	records := []instanceRecord{
+		// Straddles the start of the window: 2 of its 4 hours count.
+		{UUID: "a", Zone: "fi-hel1", Plan: "1xCPU-2GB", Created: from.Add(-2 * time.Hour), Deleted: from.Add(2 * time.Hour)},
+		// Still running: counted up to the end of the window.
+		{UUID: "b", Zone: "fi-hel1", Plan: "1xCPU-2GB", Created: to.Add(-10 * time.Hour)},
+		// Gone before the window.
+		{UUID: "c", Zone: "fi-hel1", Plan: "1xCPU-2GB", Created: from.Add(-5 * time.Hour), Deleted: from.Add(-time.Hour)},
+		{UUID: "d", Zone: "de-fra1", Plan: "2xCPU-4GB", Created: from, Deleted: from.Add(time.Hour)},
+	}
+	prices := upcloud.PricesByZone{"fi-hel1": {planPriceKey + "1xCPU-2GB": {Amount: 1, Price: 1.5}}}
+
+	r := estimateSpend(records, prices, from, to)
+	if len(r.Lines) != 2 {
+		t.Fatalf("lines = %+v, want 2", r.Lines)
+	}
+	fra, hel := r.Lines[0], r.Lines[1]
+	if hel.Instances != 2 || math.Abs(hel.Hours-12) > 1e-9 || math.Abs(hel.Cost-0.18) > 1e-9 {
+		t.Errorf("fi-hel1 line = %+v, want 2 instances, 12h, 0.18 EUR", hel)
+	}
+	if fra.Instances != 1 || fra.Cost != 0 {
+		t.Errorf("de-fra1 line = %+v, want 1 unpriced instance", fra)
+	}
+	if math.Abs(r.Total-0.18) > 1e-9 || len(r.Unpriced) != 1 || r.Unpriced[0] != "de-fra1/2xCPU-4GB" {
+		t.Errorf("total = %.4f, unpriced = %v", r.Total, r.Unpriced)
+	}
+
+	var sb strings.Builder
+	if err := writeBillingTable(&sb, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "no price for de-fra1/2xCPU-4GB") {
+		t.Errorf("table output missing unpriced warning:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Circuit breaker defaults.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+)
+
+// errProviderDegraded is returned instead of calling the API while the
+// circuit breaker is open.
+var errProviderDegraded = errors.New("provider degraded")
+
+// breakerTransport stops calling the UpCloud API after Threshold
+// consecutive failures (network errors, 429 and 5xx responses) and fails
+// calls fast for Cooldown. After that a single probe call is let through:
+// success closes the breaker, failure opens it for another cool-down. This
+// keeps the plugin from amplifying an API outage with its own retries.
+type breakerTransport struct {
+	next      http.RoundTripper
+	log       hclog.Logger
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time // time.Now unless replaced by tests
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // the half-open probe call is in flight
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	probe, err := t.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil && req.Context().Err() == nil ||
+		resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError)
+	t.record(failed, probe)
+	return resp, err
+}
+
+// allow reports errProviderDegraded while the breaker is open, and lets one
+// probe call through once the cool-down has passed, reporting it as such.
+func (t *breakerTransport) allow() (probe bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.threshold <= 0 || t.failures < t.threshold {
+		return false, nil
+	}
+	if t.now().Before(t.openUntil) || t.probing {
+		return false, fmt.Errorf("%w: UpCloud API calls suspended until %s after %d consecutive failures",
+			errProviderDegraded, t.openUntil.Format(time.RFC3339), t.failures)
+	}
+	t.probing = true
+	return true, nil
+}
+
+// record updates the breaker with the outcome of a call. Only the probe
+// itself ends the probe: calls that were in flight before the breaker opened
+// may finish meanwhile.
+func (t *breakerTransport) record(failed, probe bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if probe {
+		t.probing = false
+	}
+	if !failed {
+		if t.threshold > 0 && t.failures >= t.threshold {
+			t.log.Info("UpCloud API recovered; resuming calls")
+		}
+		t.failures = 0
+		return
+	}
+	t.failures++
+	if t.threshold > 0 && t.failures >= t.threshold {
+		t.openUntil = t.now().Add(t.cooldown)
+		t.log.Warn("UpCloud API degraded; suspending calls", "consecutive_failures", t.failures, "cooldown", t.cooldown)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ─── circuit breaker ──────────────────────────────────────────────────────────
+
+func TestBreakerTransport(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	bt := &breakerTransport{
+		next:      http.DefaultTransport,
+		log:       hclog.NewNullLogger(),
+		threshold: 3,
+		cooldown:  time.Minute,
+		now:       func() time.Time { return now },
+	}
+	client := &http.Client{Transport: bt}
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("call %d: unexpected error %v", i, err)
+		}
+	}
+	if err := get(); !errors.Is(err, errProviderDegraded) {
+		t.Fatalf("call after %d failures: error = %v, want errProviderDegraded", calls, err)
+	}
+	if calls != 3 {
+		t.Errorf("API called %d times, want 3 while the breaker is open", calls)
+	}
+
+	// A failed probe after the cool-down reopens the breaker.
+	now = now.Add(time.Minute)
+	if err := get(); err != nil {
+		t.Fatalf("probe: unexpected error %v", err)
+	}
+	if err := get(); !errors.Is(err, errProviderDegraded) {
+		t.Fatalf("after failed probe: error = %v, want errProviderDegraded", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	status = http.StatusOK
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("call %d after recovery: unexpected error %v", i, err)
+		}
+	}
+	if calls != 6 {
+		t.Errorf("API called %d times, want 6", calls)
+	}
+}
+
+func TestBreakerTransport_LateCallKeepsProbe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bt := &breakerTransport{log: hclog.NewNullLogger(), threshold: 1, cooldown: time.Minute, now: func() time.Time { return now }}
+	bt.record(true, false)
+
+	now = now.Add(time.Minute)
+	if probe, err := bt.allow(); !probe || err != nil {
+		t.Fatalf("allow() = %v, %v, want the probe", probe, err)
+	}
+	// A call started before the breaker opened fails while the probe runs.
+	bt.record(true, false)
+	if _, err := bt.allow(); !errors.Is(err, errProviderDegraded) {
+		t.Fatalf("allow() during the probe: error = %v, want errProviderDegraded", err)
+	}
+
+	bt.record(false, true)
+	if probe, err := bt.allow(); probe || err != nil {
+		t.Errorf("allow() after a successful probe = %v, %v, want a plain call", probe, err)
+	}
+}
+
+func TestIsTransient_ProviderDegraded(t *testing.T) {
+	if isTransient(errProviderDegraded) {
+		t.Error("calls rejected by the circuit breaker should not be retried")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// command is an operator subcommand run instead of serving the plugin.
+type command func(ctx context.Context, args []string, stdout io.Writer) error
+
+// commands are dispatched by main before handing over to plugin.Main, which
+// keeps handling "serve" and "bootstrap".
+var commands = map[string]command{
+	"status":        runStatus,
+	"set-template":  runSetTemplate,
+	"bake-template": runBakeTemplate,
+	"billing":       runBilling,
+	"connect":       runConnect,
+	"scale":         runScale,
+	"version":       runVersion,
+	"--version":     runVersion,
+	"-version":      runVersion,
+}
+
+// newFlagSet returns a flag set for a subcommand with the shared --config flag.
+func newFlagSet(name string, stdout io.Writer) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	config := fs.String("config", "", "path to a JSON file holding the plugin_config")
+	return fs, config
+}
+
+// readGroupConfig reads a plugin_config JSON file without validating it.
+func readGroupConfig(path string) (*InstanceGroup, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--config is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	g := &InstanceGroup{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// loadGroup reads a plugin_config JSON file, validates it and connects to the
+// UpCloud API, returning a group ready for read-only and operator commands.
+// Logs go to stderr so they never mix with command output.
+func loadGroup(ctx context.Context, path string) (*InstanceGroup, error) {
+	g, err := readGroupConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+
+	g.registerSecrets()
+	g.log = &redactingLogger{Logger: hclog.New(&hclog.LoggerOptions{Name: Version.Name, Level: hclog.Warn, Output: os.Stderr})}
+	g.svc = newUpcloudService(g.newClient())
+	if _, err := g.svc.GetAccount(ctx); err != nil {
+		return nil, fmt.Errorf("authenticating with UpCloud API: %w", err)
+	}
+	return g, nil
+}
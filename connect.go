@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// runConnect implements `connect --config <file> [--key-path file]
+// [--username user] [--internal] [--exec] <uuid-or-hostname>`. It resolves
+// the instance's ConnectInfo as the runner would and prints the matching ssh
+// command, or runs it in place of the plugin process with --exec.
+func runConnect(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("connect", stdout)
+	keyPath := fs.String("key-path", "", "SSH private key of the instances, as connector_config.key_path")
+	username := fs.String("username", defaultScaleUsername, "login user of the instances, as connector_config.username")
+	internal := fs.Bool("internal", false, "connect to the internal address instead of the external one")
+	execSSH := fs.Bool("exec", false, "run ssh instead of printing the command")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exactly one instance UUID or hostname is required")
+	}
+
+	g, err := loadGroup(ctx, *config)
+	if err != nil {
+		return err
+	}
+	g.settings = provider.Settings{ConnectorConfig: provider.ConnectorConfig{Username: *username}}
+	if g.EphemeralSSHKeys {
+		return fmt.Errorf("instances use ephemeral_ssh_keys, which only the running plugin knows")
+	}
+
+	uuid, err := g.resolveInstance(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := g.connectInfo(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	argv, err := g.sshCommand(info, *keyPath, *internal)
+	if err != nil {
+		return err
+	}
+
+	if !*execSSH {
+		fmt.Fprintln(stdout, shellJoin(argv))
+		return nil
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// resolveInstance returns the UUID of the group server with the given UUID
+// or hostname.
+func (g *InstanceGroup) resolveInstance(ctx context.Context, id string) (string, error) {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{Filters: g.groupFilters()})
+	if err != nil {
+		return "", fmt.Errorf("listing group servers: %w", err)
+	}
+	for _, s := range servers.Servers {
+		if s.UUID == id || s.Hostname == id {
+			return s.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("no server with UUID or hostname %q in group %s", id, g.Name)
+}
+
+// sshCommand builds the ssh command line reaching an instance, jumping
+// through bastion_address when one is configured, like the plugin does.
+// Through a bastion the internal address is used.
+func (g *InstanceGroup) sshCommand(info provider.ConnectInfo, keyPath string, internal bool) ([]string, error) {
+	if info.Protocol != provider.ProtocolSSH {
+		return nil, fmt.Errorf("instance %s is reached over %s, not ssh", info.ID, info.Protocol)
+	}
+	addr := info.ExternalAddr
+	if internal || g.BastionAddress != "" || addr == "" {
+		addr = info.InternalAddr
+		if addr == "" {
+			addr = info.ExternalAddr
+		}
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("instance %s has no address", info.ID)
+	}
+
+	argv := []string{"ssh"}
+	if keyPath != "" {
+		argv = append(argv, "-i", keyPath)
+	}
+	if info.ProtocolPort != 0 && info.ProtocolPort != provider.DefaultProtocolPorts[provider.ProtocolSSH] {
+		argv = append(argv, "-p", strconv.Itoa(info.ProtocolPort))
+	}
+	if g.BastionAddress != "" {
+		user := g.BastionUser
+		if user == "" {
+			user = info.Username
+		}
+		host, port, err := net.SplitHostPort(g.BastionAddress)
+		if err != nil {
+			host, port = g.BastionAddress, defaultBastionPort
+		}
+		if g.BastionKeyFile != "" {
+			// -J cannot take a separate key for the jump host.
+			argv = append(argv, "-o", fmt.Sprintf("ProxyCommand=ssh -i %s -p %s -W %%h:%%p %s@%s", g.BastionKeyFile, port, user, host))
+		} else {
+			argv = append(argv, "-J", fmt.Sprintf("%s@%s", user, net.JoinHostPort(host, port)))
+		}
+	}
+	return append(argv, info.Username+"@"+addr), nil
+}
+
+// shellJoin quotes args for a POSIX shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.IndexFunc(a, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+		}) < 0 {
+			quoted[i] = a
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
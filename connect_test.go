@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── connect command ──────────────────────────────────────────────────────────
+
+func TestRunConnect_Args(t *testing.T) {
+	for _, args := range [][]string{
+		{"--config", "plugin.json"},
+		{"--config", "plugin.json", "uuid-1", "uuid-2"},
+	} {
+		if err := runConnect(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("runConnect(%q) expected error, got nil", args)
+		}
+	}
+}
+
+func TestResolveInstance(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "uuid-1", Hostname: "test-group-1"},
+			{UUID: "uuid-2", Hostname: "test-group-2"},
+		}}, nil
+	}
+	g := baseGroup(mock)
+
+	for id, want := range map[string]string{"uuid-1": "uuid-1", "test-group-2": "uuid-2"} {
+		got, err := g.resolveInstance(context.Background(), id)
+		if err != nil || got != want {
+			t.Errorf("resolveInstance(%q) = %q, %v; want %q", id, got, err, want)
+		}
+	}
+	if _, err := g.resolveInstance(context.Background(), "uuid-3"); err == nil {
+		t.Error("resolveInstance(uuid-3) expected error, got nil")
+	}
+}
+
+func TestSSHCommand(t *testing.T) {
+	info := provider.ConnectInfo{
+		ConnectorConfig: provider.ConnectorConfig{Protocol: provider.ProtocolSSH, Username: "root"},
+		ID:              "uuid-1",
+		ExternalAddr:    "203.0.113.10",
+		InternalAddr:    "10.0.0.10",
+	}
+	custom := info
+	custom.ProtocolPort = 2222
+
+	tests := []struct {
+		name     string
+		group    *InstanceGroup
+		info     provider.ConnectInfo
+		keyPath  string
+		internal bool
+		want     []string
+	}{
+		{"external", &InstanceGroup{}, info, "", false,
+			[]string{"ssh", "root@203.0.113.10"}},
+		{"internal with key", &InstanceGroup{}, info, "id_ed25519", true,
+			[]string{"ssh", "-i", "id_ed25519", "root@10.0.0.10"}},
+		{"custom port", &InstanceGroup{}, custom, "", false,
+			[]string{"ssh", "-p", "2222", "root@203.0.113.10"}},
+		{"bastion", &InstanceGroup{BastionAddress: "bastion.example.com"}, info, "", false,
+			[]string{"ssh", "-J", "root@bastion.example.com:22", "root@10.0.0.10"}},
+		{"bastion with key", &InstanceGroup{BastionAddress: "bastion.example.com:2200", BastionUser: "jump", BastionKeyFile: "bastion_key"}, info, "", false,
+			[]string{"ssh", "-o", "ProxyCommand=ssh -i bastion_key -p 2200 -W %h:%p jump@bastion.example.com", "root@10.0.0.10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.group.sshCommand(tt.info, tt.keyPath, tt.internal)
+			if err != nil {
+				t.Fatalf("sshCommand: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sshCommand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	winrm := info
+	winrm.Protocol = provider.ProtocolWinRM
+	if _, err := (&InstanceGroup{}).sshCommand(winrm, "", false); err == nil {
+		t.Error("sshCommand over winrm expected error, got nil")
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	got := shellJoin([]string{"ssh", "-o", "ProxyCommand=ssh -W %h:%p a@b", "it's", ""})
+	want := `ssh -o 'ProxyCommand=ssh -W %h:%p a@b' 'it'\''s' ''`
+	if got != want {
+		t.Errorf("shellJoin = %s, want %s", got, want)
+	}
+}
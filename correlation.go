@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// correlationKey is the context key under which a *correlationSlot travels
+// from an upcloudSvc call down to the HTTP transport.
+type correlationKey struct{}
+
+// correlationSlot receives the correlation ID of the last response seen
+// during one service call; calls such as WaitForServerState poll repeatedly.
+type correlationSlot struct {
+	mu sync.Mutex
+	id string
+}
+
+func (s *correlationSlot) set(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id = id
+}
+
+func (s *correlationSlot) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// withCorrelationSlot returns a context whose API responses record their
+// correlation ID in the returned slot.
+func withCorrelationSlot(ctx context.Context) (context.Context, *correlationSlot) {
+	slot := &correlationSlot{}
+	return context.WithValue(ctx, correlationKey{}, slot), slot
+}
+
+// correlationTransport copies response correlation headers into the slot
+// carried by the request context, if any.
+type correlationTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if resp != nil {
+		if slot, ok := req.Context().Value(correlationKey{}).(*correlationSlot); ok {
+			if id := correlationID(resp.Header); id != "" {
+				slot.set(id)
+			}
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// creditCheckInterval is how often Update re-reads the account balance when
+// a credit threshold is set.
+const creditCheckInterval = 15 * time.Minute
+
+// errCreditsLow is returned by Increase while the account balance is below
+// CreditFloor.
+var errCreditsLow = errors.New("account credits below credit_floor")
+
+// checksCredits reports whether any credit threshold is configured.
+func (g *InstanceGroup) checksCredits() bool {
+	return g.CreditWarnThreshold > 0 || g.CreditFloor > 0
+}
+
+// recordCredits stores the balance of account, which the API reports in
+// cents, and warns when it is below a threshold.
+func (g *InstanceGroup) recordCredits(account *upcloud.Account) {
+	balance := account.Credits / 100
+	g.creditMu.Lock()
+	g.credits, g.creditsKnown = balance, true
+	g.creditCheckAt = time.Now()
+	g.creditMu.Unlock()
+
+	g.metrics.gauge("account.credits", balance)
+	log := g.logger(logScaling)
+	switch {
+	case g.CreditFloor > 0 && balance < g.CreditFloor:
+		log.Error("account credits below credit_floor; refusing to create servers", "credits", balance, "floor", g.CreditFloor)
+	case g.CreditWarnThreshold > 0 && balance < g.CreditWarnThreshold:
+		log.Warn("account credits running low", "credits", balance, "threshold", g.CreditWarnThreshold)
+	}
+}
+
+// maybeCheckCredits re-reads the account balance in the background if the
+// last reading is at least creditCheckInterval old. Update calls it on
+// every cycle.
+func (g *InstanceGroup) maybeCheckCredits() {
+	if !g.checksCredits() {
+		return
+	}
+	g.creditMu.Lock()
+	if time.Since(g.creditCheckAt) < creditCheckInterval {
+		g.creditMu.Unlock()
+		return
+	}
+	g.creditCheckAt = time.Now()
+	g.creditMu.Unlock()
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		ctx, cancel := context.WithTimeout(g.probeContext(), time.Minute)
+		defer cancel()
+		account, err := g.svc.GetAccount(ctx)
+		if err != nil {
+			g.logger(logScaling).Warn("failed to check account credits", "error", err)
+			return
+		}
+		g.recordCredits(account)
+	}()
+}
+
+// creditsBelowFloor returns errCreditsLow, with the balance, if the last
+// reading was below CreditFloor.
+func (g *InstanceGroup) creditsBelowFloor() error {
+	if g.CreditFloor <= 0 {
+		return nil
+	}
+	g.creditMu.Lock()
+	defer g.creditMu.Unlock()
+	if !g.creditsKnown || g.credits >= g.CreditFloor {
+		return nil
+	}
+	return fmt.Errorf("%w: %.2f left, floor is %.2f", errCreditsLow, g.credits, g.CreditFloor)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── account credits ──────────────────────────────────────────────────────────
+
+func TestIncrease_CreditFloor(t *testing.T) {
+	credits := 500.0 // cents
+	created := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.getAccount = func(context.Context) (*upcloud.Account, error) {
+		return &upcloud.Account{Credits: credits}, nil
+	}
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		created++
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.CreditFloor = 10
+	acct, _ := mock.GetAccount(context.Background())
+	g.recordCredits(acct)
+	if n, err := g.Increase(context.Background(), 1); n != 0 || !errors.Is(err, errCreditsLow) {
+		t.Fatalf("Increase() = %d, %v, want 0, errCreditsLow", n, err)
+	}
+
+	// The balance is topped up and re-read on a later Update.
+	credits = 5000
+	g.creditCheckAt = time.Now().Add(-creditCheckInterval)
+	g.Update(context.Background(), func(string, provider.State) {})
+	g.background.Wait()
+	if n, err := g.Increase(context.Background(), 1); n != 1 || created != 1 {
+		t.Errorf("Increase() after top-up = %d, %v with %d created, want 1", n, err, created)
+	}
+}
+
+func TestValidate_Credits(t *testing.T) {
+	g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", CreditFloor: -1}
+	if err := g.validate(); err == nil {
+		t.Error("validate() expected error for a negative credit_floor")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// stateLabelKey marks servers the plugin has started to remove, so external
+// tooling can tell them apart and a restarted plugin can finish the job.
+const (
+	stateLabelKey      = "fleeting-state"
+	stateLabelDeleting = "deleting"
+)
+
+// backgroundDeleteTimeout bounds how long removing a single server in the
+// background may take.
+const backgroundDeleteTimeout = 10 * time.Minute
+
+// setDeleting records whether a server is currently being removed.
+func (g *InstanceGroup) setDeleting(uuid string, deleting bool) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if !deleting {
+		delete(g.deleting, uuid)
+		return
+	}
+	if g.deleting == nil {
+		g.deleting = make(map[string]bool)
+	}
+	g.deleting[uuid] = true
+}
+
+// isDeleting reports whether a server is currently being removed.
+func (g *InstanceGroup) isDeleting(uuid string) bool {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	return g.deleting[uuid]
+}
+
+// removing reports whether a server is being removed, by this process or,
+// going by its deletion-pending label, by an earlier one.
+func (g *InstanceGroup) removing(uuid string, details *upcloud.ServerDetails) bool {
+	if g.isDeleting(uuid) {
+		return true
+	}
+	for _, l := range details.Labels {
+		if l.Key == stateLabelKey && l.Value == stateLabelDeleting {
+			return true
+		}
+	}
+	return false
+}
+
+// labelDeleting adds the deletion-pending label to a server, keeping its
+// existing labels since ModifyServer replaces the whole set.
+func (g *InstanceGroup) labelDeleting(ctx context.Context, details *upcloud.ServerDetails) error {
+	labels := upcloud.LabelSlice{}
+	for _, l := range details.Labels {
+		if l.Key != stateLabelKey {
+			labels = append(labels, l)
+		}
+	}
+	labels = append(labels, upcloud.Label{Key: stateLabelKey, Value: stateLabelDeleting})
+
+	if _, err := g.svc.ModifyServer(ctx, &request.ModifyServerRequest{UUID: details.UUID, Labels: &labels}); err != nil {
+		return fmt.Errorf("labelling server %s for deletion: %w", details.UUID, err)
+	}
+	return nil
+}
+
+// deleteInBackground removes a server without blocking the caller. It is a
+// no-op if the server is already being removed.
+func (g *InstanceGroup) deleteInBackground(uuid string) {
+	g.deleteInBackgroundThen(uuid, nil)
+}
+
+// deleteInBackgroundThen is deleteInBackground calling removed, if set,
+// once stopAndDelete succeeded. A failed removal never calls it.
+func (g *InstanceGroup) deleteInBackgroundThen(uuid string, removed func()) {
+	g.staleMu.Lock()
+	if g.deleting[uuid] {
+		g.staleMu.Unlock()
+		return
+	}
+	if g.deleting == nil {
+		g.deleting = make(map[string]bool)
+	}
+	g.deleting[uuid] = true
+	g.staleMu.Unlock()
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				err := fmt.Errorf("removing server %s: panic: %v", uuid, r)
+				g.logger(logGC).Error("panic while removing server in background", "uuid", uuid, "panic", r, "stack", string(debug.Stack()))
+				g.setDeleting(uuid, false)
+				g.notify(eventInstanceFailed, uuid, "", err)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundDeleteTimeout)
+		defer cancel()
+		if err := g.stopAndDelete(ctx, uuid); err != nil {
+			g.logger(logGC).Error("failed to remove server in background", "uuid", uuid, "error", err)
+			g.notify(eventInstanceFailed, uuid, "", err)
+			return
+		}
+		if removed != nil {
+			removed()
+		}
+	}()
+}
+
+// removeErrorServer deletes a server stuck in UpCloud's error state in the
+// background; such servers never recover and still count against quota.
+func (g *InstanceGroup) removeErrorServer(uuid string) {
+	if g.isDeleting(uuid) {
+		return
+	}
+	g.logger(logGC).Warn("server is in error state; removing it", "uuid", uuid)
+	g.markUnhealthy(uuid, "server in error state")
+	g.deleteInBackground(uuid)
+}
+
+// resumeDeletions finishes removing group servers that carry the
+// deletion-pending label, e.g. after the plugin crashed mid-Decrease.
+func (g *InstanceGroup) resumeDeletions(ctx context.Context) error {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: append(g.groupFilters(),
+			request.FilterLabel{Label: upcloud.Label{Key: stateLabelKey, Value: stateLabelDeleting}},
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("listing servers pending deletion: %w", err)
+	}
+
+	for _, s := range servers.Servers {
+		g.logger(logGC).Info("resuming interrupted deletion", "uuid", s.UUID, "hostname", s.Hostname)
+		g.deleteInBackground(s.UUID)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── deletion-pending label ───────────────────────────────────────────────────
+
+// stubRemoval makes stop, wait and delete succeed, recording deleted UUIDs.
+func stubRemoval(m *mockSvc, mu *sync.Mutex, deleted *[]string) {
+	m.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	m.waitForServerState = func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	m.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*deleted = append(*deleted, r.UUID)
+		return nil
+	}
+}
+
+func TestDecrease_LabelsBeforeStopping(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+		calls   []string
+		labels  upcloud.LabelSlice
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{Labels: upcloud.LabelSlice{{Key: groupLabelKey, Value: "test-group"}}}, nil
+	}
+	mock.modifyServer = func(_ context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		calls = append(calls, "modify")
+		labels = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		calls = append(calls, "stop")
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+
+	if len(calls) < 2 || calls[0] != "modify" || calls[1] != "stop" {
+		t.Errorf("call order = %v, want modify before stop", calls)
+	}
+	if v, _ := labelValue(labels, stateLabelKey); v != stateLabelDeleting {
+		t.Errorf("label %s = %q, want %q", stateLabelKey, v, stateLabelDeleting)
+	}
+	if v, _ := labelValue(labels, groupLabelKey); v != "test-group" {
+		t.Errorf("existing group label lost: %v", labels)
+	}
+}
+
+func TestDecrease_LabelFailureIsNotFatal(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", ""), nil
+	}
+	mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return nil, errors.New("api error")
+	}
+
+	g := baseGroup(mock)
+	succeeded, err := g.Decrease(context.Background(), []string{"uuid-1"})
+	if err != nil || len(succeeded) != 1 {
+		t.Errorf("Decrease() = (%v, %v), want ([uuid-1], nil)", succeeded, err)
+	}
+}
+
+func TestResumeDeletions(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+		filters []request.QueryFilter
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServersWithFilters = func(_ context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		if filters == nil {
+			filters = r.Filters
+		}
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+
+	g := baseGroup(mock)
+	if err := g.resumeDeletions(context.Background()); err != nil {
+		t.Fatalf("resumeDeletions() unexpected error: %v", err)
+	}
+
+	// While the removal is in flight Update must not report the server as usable.
+	var state provider.State
+	if g.isDeleting("uuid-1") {
+		g.Update(context.Background(), func(_ string, s provider.State) { state = s })
+		if state != provider.StateDeleting {
+			t.Errorf("state during resumed deletion = %v, want StateDeleting", state)
+		}
+	}
+
+	g.Shutdown(context.Background())
+	if len(filters) != 2 {
+		t.Errorf("filters = %v, want group and state label", filters)
+	}
+	if len(deleted) != 1 || deleted[0] != "uuid-1" {
+		t.Errorf("deleted = %v, want [uuid-1]", deleted)
+	}
+	if g.isDeleting("uuid-1") {
+		t.Error("server still marked as deleting after removal")
+	}
+}
+
+// ─── error-state cleanup ──────────────────────────────────────────────────────
+
+// errorServerMock lists uuid-1 in the error state and records deleted UUIDs.
+// StopServer is left unstubbed: error-state servers must not be stopped.
+func errorServerMock(mu *sync.Mutex, deleted *[]string) *mockSvc {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateError}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.State = upcloud.ServerStateError
+		return d, nil
+	}
+	mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*deleted = append(*deleted, r.UUID)
+		return nil
+	}
+	return mock
+}
+
+func TestUpdate_DeletesErrorServers(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(errorServerMock(&mu, &deleted))
+	g.DeleteErrorServers = true
+
+	var got provider.State
+	if err := g.Update(context.Background(), func(_ string, s provider.State) { got = s }); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.Shutdown(context.Background())
+
+	if got != provider.StateDeleting {
+		t.Errorf("state = %v, want StateDeleting", got)
+	}
+	if len(deleted) != 1 || deleted[0] != "uuid-1" {
+		t.Errorf("deleted = %v, want [uuid-1]", deleted)
+	}
+}
+
+func TestUpdate_KeepsErrorServersByDefault(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(errorServerMock(&mu, &deleted))
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateDeleted || len(deleted) != 0 {
+		t.Errorf("state = %v, deleted = %v, want StateDeleted and none", got, deleted)
+	}
+}
+
+func TestHeartbeat_DeletesErrorServer(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(errorServerMock(&mu, &deleted))
+	g.DeleteErrorServers = true
+
+	if err := g.Heartbeat(context.Background(), "uuid-1"); err == nil {
+		t.Error("Heartbeat() expected error for server in error state, got nil")
+	}
+	g.Shutdown(context.Background())
+
+	if len(deleted) != 1 || deleted[0] != "uuid-1" {
+		t.Errorf("deleted = %v, want [uuid-1]", deleted)
+	}
+}
+
+func TestDecrease_DeletesBackups(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		var got request.DeleteStorageBackupsMode
+		mock := newMockSvc()
+		var mu sync.Mutex
+		var deleted []string
+		stubRemoval(mock, &mu, &deleted)
+		mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+			return &upcloud.ServerDetails{Labels: upcloud.LabelSlice{{Key: groupLabelKey, Value: "test-group"}}}, nil
+		}
+		mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+			return &upcloud.ServerDetails{}, nil
+		}
+		mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+			got = r.Backups
+			return nil
+		}
+
+		g := baseGroup(mock)
+		g.KeepBackups = keep
+		if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+			t.Fatalf("Decrease() unexpected error: %v", err)
+		}
+		want := request.DeleteStorageBackupsModeDelete
+		if keep {
+			want = request.DeleteStorageBackupsModeKeep
+		}
+		if got != want {
+			t.Errorf("keep_backups=%v: backups = %q, want %q", keep, got, want)
+		}
+	}
+}
+
+func TestDeleteInBackground_RecoversPanic(t *testing.T) {
+	// newMockSvc panics on the unset GetServerDetails.
+	g := baseGroup(newMockSvc())
+	g.deleteInBackground("uuid-1")
+	g.background.Wait()
+	if g.isDeleting("uuid-1") {
+		t.Error("server still marked as deleting after a panic")
+	}
+}
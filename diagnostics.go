@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/hashicorp/go-hclog"
+)
+
+// diagnosticsTimeout bounds the diagnostics command run on an unhealthy
+// instance before it is removed.
+const diagnosticsTimeout = time.Minute
+
+// diagnostics is the post-mortem record written to DiagnosticsDir for an
+// unhealthy instance before it is removed.
+type diagnostics struct {
+	UUID         string                 `json:"uuid"`
+	Hostname     string                 `json:"hostname"`
+	Reason       string                 `json:"reason"`
+	CapturedAt   time.Time              `json:"captured_at"`
+	Server       *upcloud.ServerDetails `json:"server"`
+	Command      string                 `json:"command,omitempty"`
+	Output       string                 `json:"output,omitempty"`
+	CommandError string                 `json:"command_error,omitempty"`
+}
+
+// markUnhealthy records why a server is considered broken, so its removal
+// captures diagnostics.
+func (g *InstanceGroup) markUnhealthy(uuid, reason string) {
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	if g.unhealthy == nil {
+		g.unhealthy = make(map[string]string)
+	}
+	g.unhealthy[uuid] = reason
+}
+
+// unhealthyReason returns why a server was marked unhealthy, if it was.
+func (g *InstanceGroup) unhealthyReason(uuid string) (string, bool) {
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	reason, ok := g.unhealthy[uuid]
+	return reason, ok
+}
+
+// captureDiagnostics logs the final details of an unhealthy server about to
+// be removed and, with DiagnosticsDir set, saves them there together with
+// the output of DiagnosticsCommand. Healthy servers are skipped.
+func (g *InstanceGroup) captureDiagnostics(ctx context.Context, log hclog.Logger, uuid string, details *upcloud.ServerDetails) {
+	reason, ok := g.unhealthyReason(uuid)
+	if !ok {
+		return
+	}
+
+	var addrs []string
+	for _, ip := range details.IPAddresses {
+		addrs = append(addrs, ip.Access+" "+ip.Address)
+	}
+	created, _ := parseCreatedAt(details.Labels)
+	log.Warn("removing unhealthy instance", "reason", reason, "state", details.State,
+		"created_at", created, "plan", details.Plan, "zone", details.Zone, "addresses", addrs)
+
+	if g.DiagnosticsDir == "" {
+		return
+	}
+	server := *details
+	server.RemoteAccessPassword = ""
+	d := diagnostics{
+		UUID:       uuid,
+		Hostname:   details.Hostname,
+		Reason:     reason,
+		CapturedAt: time.Now().UTC(),
+		Server:     &server,
+	}
+	// Only a running server can be reached over SSH.
+	if g.DiagnosticsCommand != "" && details.State == upcloud.ServerStateStarted {
+		d.Command = g.DiagnosticsCommand
+		out, err := g.runOnInstance(ctx, uuid, g.DiagnosticsCommand, diagnosticsTimeout)
+		d.Output = secrets.redact(string(out))
+		if err != nil {
+			d.CommandError = secrets.redact(err.Error())
+		}
+	}
+
+	path, err := writeDiagnostics(g.DiagnosticsDir, d)
+	if err != nil {
+		log.Warn("failed to save diagnostics", "error", err)
+		return
+	}
+	log.Info("saved diagnostics", "path", path)
+}
+
+// writeDiagnostics stores d as <hostname>-<timestamp>.json in dir.
+func writeDiagnostics(dir string, d diagnostics) (string, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating diagnostics_dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", d.Hostname, d.CapturedAt.Format("20060102T150405Z")))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("writing diagnostics: %w", err)
+	}
+	return path, nil
+}
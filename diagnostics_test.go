@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// ─── diagnostics ──────────────────────────────────────────────────────────────
+
+func TestDecrease_SavesDiagnosticsOfUnhealthyInstance(t *testing.T) {
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.getServerDetails = func(_ context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("1.2.3.4", "")
+		d.UUID, d.Hostname, d.State = r.UUID, "fleeting-"+r.UUID, upcloud.ServerStateError
+		d.RemoteAccessPassword = "console-secret"
+		return d, nil
+	}
+	mock.deleteServerAndStorages = func(context.Context, *request.DeleteServerAndStoragesRequest) error { return nil }
+
+	g := baseGroup(mock)
+	g.DiagnosticsDir = t.TempDir()
+	if err := g.Heartbeat(context.Background(), "sick"); err == nil {
+		t.Fatal("Heartbeat() = nil, want error for a server in error state")
+	}
+	if _, err := g.Decrease(context.Background(), []string{"sick", "healthy"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(g.DiagnosticsDir, "*.json"))
+	if len(files) != 1 || filepath.Base(files[0])[:len("fleeting-sick-")] != "fleeting-sick-" {
+		t.Fatalf("diagnostics files = %v, want one for the unhealthy server", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d struct{ Reason string }
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Reason != "heartbeat: server error" || !strings.Contains(string(data), "1.2.3.4") {
+		t.Errorf("diagnostics = %s, want the heartbeat reason and server addresses", data)
+	}
+	if strings.Contains(string(data), "console-secret") {
+		t.Error("diagnostics contain the remote access password")
+	}
+}
+
+func TestCaptureDiagnostics_SkipsHealthyInstances(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.DiagnosticsDir = filepath.Join(t.TempDir(), "diag")
+	g.captureDiagnostics(context.Background(), hclog.NewNullLogger(), "uuid-1", makeDetails("", ""))
+	if _, err := os.Stat(g.DiagnosticsDir); !os.IsNotExist(err) {
+		t.Errorf("diagnostics_dir created for a healthy instance: %v", err)
+	}
+}
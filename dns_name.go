@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// connectNameData is the data available to connect_dns_template.
+type connectNameData struct {
+	UUID     string
+	Hostname string
+	Zone     string
+	Group    string
+	Address  string
+}
+
+// parseConnectNameTemplate compiles connect_dns_template, if set.
+func (g *InstanceGroup) parseConnectNameTemplate() error {
+	if g.ConnectDNSTemplate == "" {
+		return nil
+	}
+	tmpl, err := template.New("connect_dns").Option("missingkey=error").Parse(g.ConnectDNSTemplate)
+	if err != nil {
+		return fmt.Errorf("connect_dns_template: %w", err)
+	}
+	g.connectNameTmpl = tmpl
+	return nil
+}
+
+// connectName returns the DNS name to hand to the runner instead of addr,
+// or addr itself when no name is configured or available. Host certificates
+// are usually bound to names, so SSH CAs need the runner to dial one.
+func (g *InstanceGroup) connectName(uuid string, details *upcloud.ServerDetails, addr string) (string, error) {
+	if addr == "" {
+		return addr, nil
+	}
+	if g.connectNameTmpl != nil {
+		var sb strings.Builder
+		err := g.connectNameTmpl.Execute(&sb, connectNameData{
+			UUID:     uuid,
+			Hostname: details.Hostname,
+			Zone:     g.Zone,
+			Group:    g.Name,
+			Address:  addr,
+		})
+		if err != nil {
+			return addr, fmt.Errorf("rendering connect_dns_template: %w", err)
+		}
+		return strings.TrimSpace(sb.String()), nil
+	}
+	if g.ConnectReverseDNS {
+		for _, ip := range details.IPAddresses {
+			if ip.Address == addr && ip.PTRRecord != "" {
+				return strings.TrimSuffix(ip.PTRRecord, "."), nil
+			}
+		}
+		g.log.Debug("no reverse DNS name for connect address; using the address", "uuid", uuid, "address", addr)
+	}
+	return addr, nil
+}
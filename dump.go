@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// stateDump is the plugin's own view of its fleet, logged on SIGUSR1 to
+// compare with what the runner and UpCloud report.
+type stateDump struct {
+	Config     dumpConfig           `json:"config"`
+	LastUpdate *dumpUpdate          `json:"last_update,omitempty"`
+	Instances  []dumpInstance       `json:"instances"`
+	Pending    map[string]pendingOp `json:"pending,omitempty"`
+}
+
+type dumpConfig struct {
+	Version    string `json:"version"`
+	Zone       string `json:"zone"`
+	Group      string `json:"group"`
+	Plan       string `json:"plan"`
+	Template   string `json:"template"`
+	MaxSize    int    `json:"max_size"`
+	ConfigHash string `json:"config_hash"`
+}
+
+type dumpUpdate struct {
+	At     time.Time              `json:"at"`
+	Age    string                 `json:"age"`
+	States map[provider.State]int `json:"states"`
+}
+
+type dumpInstance struct {
+	UUID        string     `json:"uuid"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	SeenRunning bool       `json:"seen_running,omitempty"`
+	Deleting    bool       `json:"deleting,omitempty"`
+	Ready       bool       `json:"ready,omitempty"`
+	NotReady    bool       `json:"not_ready,omitempty"`
+	Probing     bool       `json:"probing,omitempty"`
+}
+
+// recordUpdate reports the instance counts of an Update in metrics and
+// keeps them for the state dump.
+func (g *InstanceGroup) recordUpdate(counts map[provider.State]int) {
+	g.gaugeInstances(counts)
+	g.dumpMu.Lock()
+	defer g.dumpMu.Unlock()
+	g.lastUpdate, g.lastCounts = time.Now(), counts
+}
+
+// stateDump collects the plugin's internal view of the group.
+func (g *InstanceGroup) stateDump(now time.Time) stateDump {
+	d := stateDump{
+		Config: dumpConfig{
+			Version:    Version.Version,
+			Zone:       g.Zone,
+			Group:      g.Name,
+			Plan:       g.Plan,
+			Template:   g.Template,
+			MaxSize:    g.MaxSize,
+			ConfigHash: g.configHash,
+		},
+		Pending: g.store.snapshot(),
+	}
+
+	g.dumpMu.Lock()
+	if !g.lastUpdate.IsZero() {
+		d.LastUpdate = &dumpUpdate{At: g.lastUpdate, Age: now.Sub(g.lastUpdate).Round(time.Second).String(), States: g.lastCounts}
+	}
+	g.dumpMu.Unlock()
+
+	instances := map[string]*dumpInstance{}
+	get := func(uuid string) *dumpInstance {
+		if instances[uuid] == nil {
+			instances[uuid] = &dumpInstance{UUID: uuid}
+		}
+		return instances[uuid]
+	}
+	g.staleMu.Lock()
+	for uuid, at := range g.createdAt {
+		get(uuid).CreatedAt = &at
+	}
+	for uuid := range g.seenRunning {
+		get(uuid).SeenRunning = true
+	}
+	for uuid, deleting := range g.deleting {
+		get(uuid).Deleting = deleting
+	}
+	g.staleMu.Unlock()
+	g.readyMu.Lock()
+	for uuid := range g.ready {
+		get(uuid).Ready = true
+	}
+	for uuid := range g.notReady {
+		get(uuid).NotReady = true
+	}
+	for uuid := range g.probing {
+		get(uuid).Probing = true
+	}
+	g.readyMu.Unlock()
+
+	d.Instances = []dumpInstance{}
+	for _, inst := range instances {
+		d.Instances = append(d.Instances, *inst)
+	}
+	sort.Slice(d.Instances, func(i, j int) bool { return d.Instances[i].UUID < d.Instances[j].UUID })
+	return d
+}
+
+// logStateDump writes the state dump to the log as a single JSON document.
+func (g *InstanceGroup) logStateDump() {
+	data, err := json.Marshal(g.stateDump(time.Now()))
+	if err != nil {
+		g.log.Error("failed to encode state dump", "error", err)
+		return
+	}
+	g.log.Info("state dump", "state", string(data))
+}
+
+// watchDumpSignal logs a state dump on every SIGUSR1 until Shutdown.
+func (g *InstanceGroup) watchDumpSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	done := g.probeContext().Done()
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				g.logStateDump()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── state dump ───────────────────────────────────────────────────────────────
+
+func TestStateDump(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	created := time.Unix(1700000000, 0)
+	g.recordCreated("b", created)
+	g.markRunning("b")
+	g.setDeleting("a", true)
+	g.recordUpdate(map[provider.State]int{provider.StateRunning: 1})
+
+	d := g.stateDump(time.Now())
+	if d.Config.Group != g.Name || d.Config.Zone != g.Zone {
+		t.Errorf("config = %+v", d.Config)
+	}
+	if d.LastUpdate == nil || d.LastUpdate.States[provider.StateRunning] != 1 {
+		t.Errorf("last update = %+v, want 1 running", d.LastUpdate)
+	}
+	if len(d.Instances) != 2 || d.Instances[0].UUID != "a" || !d.Instances[0].Deleting {
+		t.Fatalf("instances = %+v, want a (deleting) and b", d.Instances)
+	}
+	if b := d.Instances[1]; !b.SeenRunning || b.CreatedAt == nil || !b.CreatedAt.Equal(created) {
+		t.Errorf("instance b = %+v", b)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger writing from a goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchDumpSignal(t *testing.T) {
+	var out syncBuffer
+	g := baseGroup(newMockSvc())
+	g.log = hclog.New(&hclog.LoggerOptions{Output: &out})
+	g.watchDumpSignal()
+	defer g.Shutdown(context.Background())
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), "state dump") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no state dump logged after SIGUSR1:\n%s", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
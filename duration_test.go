@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: `"10m"`, want: 10 * time.Minute},
+		{in: `"1h30m"`, want: 90 * time.Minute},
+		{in: `90`, want: 90 * time.Second},
+		{in: `"soon"`, wantErr: true},
+		{in: `true`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			var d Duration
+			err := json.Unmarshal([]byte(tc.in), &d)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr = %v", tc.in, err, tc.wantErr)
+			}
+			if !tc.wantErr && time.Duration(d) != tc.want {
+				t.Errorf("Unmarshal(%s) = %v, want %v", tc.in, time.Duration(d), tc.want)
+			}
+		})
+	}
+}
+
+func TestDuration_RoundTrip(t *testing.T) {
+	b, err := json.Marshal(Duration(15 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d Duration
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(d) != 15*time.Minute {
+		t.Errorf("round trip = %v, want 15m", time.Duration(d))
+	}
+}
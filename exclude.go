@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// errExcluded is returned when asked to remove a server carrying ExcludeLabel.
+var errExcluded = errors.New("server carries the exclusion label")
+
+// excludeLabel splits ExcludeLabel into its key and, if given, value.
+func (g *InstanceGroup) excludeLabel() (key, value string, hasValue bool) {
+	return strings.Cut(g.ExcludeLabel, "=")
+}
+
+// isExcluded reports whether labels contain ExcludeLabel.
+func (g *InstanceGroup) isExcluded(labels upcloud.LabelSlice) bool {
+	if g.ExcludeLabel == "" {
+		return false
+	}
+	key, value, hasValue := g.excludeLabel()
+	for _, l := range labels {
+		if l.Key == key && (!hasValue || l.Value == value) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedServers returns the UUIDs of group servers carrying ExcludeLabel,
+// using a single filtered list call rather than per-server lookups.
+func (g *InstanceGroup) excludedServers(ctx context.Context) (map[string]bool, error) {
+	if g.ExcludeLabel == "" {
+		return nil, nil
+	}
+
+	var filter request.QueryFilter
+	key, value, hasValue := g.excludeLabel()
+	if hasValue {
+		filter = request.FilterLabel{Label: upcloud.Label{Key: key, Value: value}}
+	} else {
+		filter = request.FilterLabelKey{Key: key}
+	}
+
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: append(g.groupFilters(), filter),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing excluded servers: %w", err)
+	}
+
+	excluded := make(map[string]bool, len(servers.Servers))
+	for _, s := range servers.Servers {
+		excluded[s.UUID] = true
+	}
+	return excluded, nil
+}
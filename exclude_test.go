@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── exclusion label ──────────────────────────────────────────────────────────
+
+func TestUpdate_SkipsExcludedServers(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(_ context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		if len(r.Filters) == 2 {
+			want := request.FilterLabel{Label: upcloud.Label{Key: "fleeting-ignore", Value: "true"}}
+			if r.Filters[1] != want {
+				t.Errorf("exclusion filter = %v, want %v", r.Filters[1], want)
+			}
+			return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-pinned"}}}, nil
+		}
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "uuid-1", State: upcloud.ServerStateStarted},
+			{UUID: "uuid-pinned", State: upcloud.ServerStateStarted},
+		}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.ExcludeLabel = "fleeting-ignore=true"
+
+	var seen []string
+	if err := g.Update(context.Background(), func(id string, _ provider.State) { seen = append(seen, id) }); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "uuid-1" {
+		t.Errorf("Update() reported %v, want [uuid-1]", seen)
+	}
+}
+
+func TestDecrease_RefusesExcludedServer(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.Labels = append(d.Labels, upcloud.Label{Key: "fleeting-ignore", Value: "yes"})
+		return d, nil
+	}
+	// Any stop, label or delete call panics in the mock.
+
+	g := baseGroup(mock)
+	g.ExcludeLabel = "fleeting-ignore"
+
+	succeeded, err := g.Decrease(context.Background(), []string{"uuid-pinned"})
+	if !errors.Is(err, errExcluded) {
+		t.Errorf("Decrease() error = %v, want errExcluded", err)
+	}
+	if len(succeeded) != 0 {
+		t.Errorf("Decrease() succeeded = %v, want none", succeeded)
+	}
+	if g.isDeleting("uuid-pinned") {
+		t.Error("excluded server left marked as deleting")
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	labels := upcloud.LabelSlice{{Key: "fleeting-ignore", Value: "true"}}
+	tests := []struct {
+		label string
+		want  bool
+	}{
+		{"", false},
+		{"fleeting-ignore", true},
+		{"fleeting-ignore=true", true},
+		{"fleeting-ignore=false", false},
+		{"keep", false},
+	}
+	for _, tc := range tests {
+		g := baseGroup(newMockSvc())
+		g.ExcludeLabel = tc.label
+		if got := g.isExcluded(labels); got != tc.want {
+			t.Errorf("isExcluded() with exclude_label %q = %v, want %v", tc.label, got, tc.want)
+		}
+	}
+}
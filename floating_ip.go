@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// freeFloatingIP returns the first address in the configured pool that is not
+// currently attached to any server. The UpCloud API is the source of truth, so
+// the pool survives plugin restarts without local bookkeeping.
+func (g *InstanceGroup) freeFloatingIP(ctx context.Context) (string, error) {
+	g.ipMu.Lock()
+	defer g.ipMu.Unlock()
+
+	for _, addr := range g.FloatingIPs {
+		ip, err := g.svc.GetIPAddressDetails(ctx, &request.GetIPAddressDetailsRequest{Address: addr})
+		if err != nil {
+			g.log.Warn("failed to look up floating IP", "ip", addr, "error", err)
+			continue
+		}
+		if ip.MAC == "" && ip.ServerUUID == "" {
+			return addr, nil
+		}
+	}
+
+	return "", fmt.Errorf("all %d floating IPs in the pool are in use", len(g.FloatingIPs))
+}
+
+// attachFloatingIP attaches addr to the public interface of a freshly created server.
+func (g *InstanceGroup) attachFloatingIP(ctx context.Context, addr string, details *upcloud.ServerDetails) error {
+	g.ipMu.Lock()
+	defer g.ipMu.Unlock()
+
+	var mac string
+	for _, iface := range details.Networking.Interfaces {
+		if iface.Type == upcloud.NetworkTypePublic {
+			mac = iface.MAC
+			break
+		}
+	}
+	if mac == "" {
+		return fmt.Errorf("server %s has no public interface", details.UUID)
+	}
+
+	if _, err := g.svc.ModifyIPAddress(ctx, &request.ModifyIPAddressRequest{
+		IPAddress: addr,
+		MAC:       mac,
+	}); err != nil {
+		return fmt.Errorf("attaching floating IP %s to server %s: %w", addr, details.UUID, err)
+	}
+	return nil
+}
+
+// detachFloatingIPs detaches every pool address currently attached to the
+// given server so it can be handed to the next instance.
+func (g *InstanceGroup) detachFloatingIPs(ctx context.Context, uuid string) error {
+	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid})
+	if err != nil {
+		return fmt.Errorf("getting server details for %s: %w", uuid, err)
+	}
+
+	g.ipMu.Lock()
+	defer g.ipMu.Unlock()
+
+	for _, ip := range details.IPAddresses {
+		if !ip.Floating.Bool() || !slices.Contains(g.FloatingIPs, ip.Address) {
+			continue
+		}
+		// An empty MAC unassigns the address while keeping it in the account.
+		if _, err := g.svc.ModifyIPAddress(ctx, &request.ModifyIPAddressRequest{IPAddress: ip.Address}); err != nil {
+			return fmt.Errorf("detaching floating IP %s from server %s: %w", ip.Address, uuid, err)
+		}
+		g.log.Info("detached floating IP", "uuid", uuid, "ip", ip.Address)
+	}
+	return nil
+}
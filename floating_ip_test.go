@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── floating IP pool ─────────────────────────────────────────────────────────
+
+func TestFreeFloatingIP_SkipsAttached(t *testing.T) {
+	mock := newMockSvc()
+	mock.getIPAddressDetails = func(_ context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+		switch r.Address {
+		case "5.6.7.8":
+			return &upcloud.IPAddress{Address: r.Address, MAC: "aa:bb", ServerUUID: "uuid-1"}, nil
+		case "5.6.7.9":
+			return nil, errors.New("lookup failed")
+		}
+		return &upcloud.IPAddress{Address: r.Address}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8", "5.6.7.9", "5.6.7.10"}
+
+	ip, err := g.freeFloatingIP(context.Background())
+	if err != nil {
+		t.Fatalf("freeFloatingIP() unexpected error: %v", err)
+	}
+	if ip != "5.6.7.10" {
+		t.Errorf("freeFloatingIP() = %q, want 5.6.7.10", ip)
+	}
+}
+
+func TestFreeFloatingIP_PoolExhausted(t *testing.T) {
+	mock := newMockSvc()
+	mock.getIPAddressDetails = func(_ context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+		return &upcloud.IPAddress{Address: r.Address, MAC: "aa:bb", ServerUUID: "uuid-1"}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8"}
+
+	if _, err := g.freeFloatingIP(context.Background()); err == nil {
+		t.Fatal("freeFloatingIP() expected error for exhausted pool, got nil")
+	}
+}
+
+func TestIncrease_AttachesFloatingIP(t *testing.T) {
+	var attached *request.ModifyIPAddressRequest
+	mock := newMockSvc()
+	noServers(mock)
+	mock.getIPAddressDetails = func(_ context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+		if attached != nil && attached.IPAddress == r.Address {
+			return &upcloud.IPAddress{Address: r.Address, MAC: attached.MAC, ServerUUID: "uuid-1"}, nil
+		}
+		return &upcloud.IPAddress{Address: r.Address}, nil
+	}
+	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		d := &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}
+		d.Networking.Interfaces = upcloud.ServerInterfaceSlice{
+			{Type: upcloud.NetworkTypePublic, MAC: "aa:bb:cc:dd:ee:ff"},
+		}
+		return d, nil
+	}
+	mock.modifyIPAddress = func(_ context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+		attached = r
+		return &upcloud.IPAddress{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8"}
+
+	n, err := g.Increase(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Increase() unexpected error: %v", err)
+	}
+	// The second instance must not be created: the pool only holds one address.
+	if n != 1 {
+		t.Errorf("Increase() = %d, want 1", n)
+	}
+	if attached == nil || attached.IPAddress != "5.6.7.8" || attached.MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("ModifyIPAddress request = %+v, want 5.6.7.8 attached to aa:bb:cc:dd:ee:ff", attached)
+	}
+}
+
+func TestIncrease_FloatingIPAttachFailureRemovesServer(t *testing.T) {
+	var deleted []string
+	mock := newMockSvc()
+	noServers(mock)
+	allowDeletionLabel(mock)
+	mock.getIPAddressDetails = func(_ context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+		return &upcloud.IPAddress{Address: r.Address}, nil
+	}
+	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		d := &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}
+		d.Networking.Interfaces = upcloud.ServerInterfaceSlice{
+			{Type: upcloud.NetworkTypePublic, MAC: "aa:bb:cc:dd:ee:ff"},
+		}
+		return d, nil
+	}
+	mock.modifyIPAddress = func(context.Context, *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+		return nil, errors.New("attach failed")
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8"}
+
+	n, err := g.Increase(context.Background(), 1)
+	g.background.Wait()
+	if n != 0 || err == nil {
+		t.Errorf("Increase() = %d, %v; want 0 and an error", n, err)
+	}
+	if len(deleted) != 1 || deleted[0] != "uuid-1" {
+		t.Errorf("deleted = %v, want [uuid-1]", deleted)
+	}
+}
+
+func TestDecrease_DetachesFloatingIP(t *testing.T) {
+	var detached []string
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.stopServer = func(_ context.Context, _ *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, _ *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("1.2.3.4", "")
+		d.IPAddresses = append(d.IPAddresses,
+			upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPublic, Address: "5.6.7.8", Floating: upcloud.True},
+			upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPublic, Address: "9.9.9.9", Floating: upcloud.True},
+		)
+		return d, nil
+	}
+	mock.modifyIPAddress = func(_ context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+		if r.MAC != "" {
+			t.Errorf("ModifyIPAddress MAC = %q, want empty to detach", r.MAC)
+		}
+		detached = append(detached, r.IPAddress)
+		return &upcloud.IPAddress{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, _ *request.DeleteServerAndStoragesRequest) error {
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8"}
+
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	// 9.9.9.9 is floating but not part of the pool, so it is left alone.
+	if len(detached) != 1 || detached[0] != "5.6.7.8" {
+		t.Errorf("detached = %v, want [5.6.7.8]", detached)
+	}
+}
+
+func TestConnectInfo_PrefersFloatingIP(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.IPAddresses = upcloud.IPAddressSlice{
+			{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPublic, Address: "5.6.7.8", Floating: upcloud.True},
+			{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPublic, Address: "1.2.3.4", Floating: upcloud.False},
+		}
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.ExternalAddr != "5.6.7.8" {
+		t.Errorf("ExternalAddr = %q, want floating IP 5.6.7.8", info.ExternalAddr)
+	}
+}
+
+func TestIncrease_ConcurrentFloatingIPs(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		created  int
+		attached = map[string]string{} // address → MAC
+	)
+	mock := newMockSvc()
+	noServers(mock)
+	mock.getIPAddressDetails = func(_ context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return &upcloud.IPAddress{Address: r.Address, MAC: attached[r.Address]}, nil
+	}
+	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		time.Sleep(10 * time.Millisecond) // widens the window between picking and attaching
+		mu.Lock()
+		defer mu.Unlock()
+		created++
+		d := &upcloud.ServerDetails{Server: upcloud.Server{UUID: fmt.Sprintf("uuid-%d", created)}}
+		d.Networking.Interfaces = upcloud.ServerInterfaceSlice{
+			{Type: upcloud.NetworkTypePublic, MAC: fmt.Sprintf("aa:bb:cc:dd:ee:%02d", created)},
+		}
+		return d, nil
+	}
+	mock.modifyIPAddress = func(_ context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attached[r.IPAddress] != "" {
+			return nil, errors.New("address already attached")
+		}
+		attached[r.IPAddress] = r.MAC
+		return &upcloud.IPAddress{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FloatingIPs = []string{"5.6.7.8", "5.6.7.9"}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, err := g.Increase(context.Background(), 1); n != 1 {
+				t.Errorf("Increase() = %d, %v, want 1", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(attached) != 2 {
+		t.Errorf("attached %v, want each address to one server", attached)
+	}
+}
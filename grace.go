@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Servers removed by Decrease while DeletionGracePeriod is set are stopped
+// and labelled, but only deleted once their grace period has passed.
+const (
+	stateLabelGrace     = "grace"
+	deleteAfterLabelKey = "fleeting-delete-after" // Unix time
+)
+
+// graceDeadline reports when a server held for inspection is due for
+// deletion, if it is held.
+func (g *InstanceGroup) graceDeadline(uuid string) (time.Time, bool) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	at, ok := g.graceUntil[uuid]
+	return at, ok
+}
+
+// holdForGrace stops a server and labels it for deletion after
+// DeletionGracePeriod instead of deleting it, leaving it for operators to
+// inspect. Update hides held servers and removes them once they are due.
+func (g *InstanceGroup) holdForGrace(ctx context.Context, log hclog.Logger, uuid string, details *upcloud.ServerDetails) error {
+	deleteAt := time.Now().Add(time.Duration(g.DeletionGracePeriod))
+
+	if details.State != upcloud.ServerStateError && details.State != upcloud.ServerStateStopped {
+		if err := g.stopServer(ctx, uuid, details.Hostname, details.Zone); err != nil {
+			return err
+		}
+	}
+
+	labels := upcloud.LabelSlice{}
+	for _, l := range details.Labels {
+		if l.Key != stateLabelKey && l.Key != deleteAfterLabelKey {
+			labels = append(labels, l)
+		}
+	}
+	labels = append(labels,
+		upcloud.Label{Key: stateLabelKey, Value: stateLabelGrace},
+		upcloud.Label{Key: deleteAfterLabelKey, Value: strconv.FormatInt(deleteAt.Unix(), 10)},
+	)
+	if _, err := g.svc.ModifyServer(ctx, &request.ModifyServerRequest{UUID: uuid, Labels: &labels}); err != nil {
+		// Without the label the server would outlive a plugin restart.
+		return fmt.Errorf("labelling server %s for delayed deletion: %w", uuid, err)
+	}
+
+	g.holdUntil(uuid, deleteAt)
+	g.forgetReadiness(uuid)
+	if g.bastion != nil {
+		g.bastion.close(uuid)
+	}
+	log.Info("stopped instance; deleting it after the grace period", "delete_after", deleteAt.Format(time.RFC3339))
+	return nil
+}
+
+// holdUntil records that a server is held for inspection until deleteAt.
+func (g *InstanceGroup) holdUntil(uuid string, deleteAt time.Time) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if g.graceUntil == nil {
+		g.graceUntil = make(map[string]time.Time)
+	}
+	g.graceUntil[uuid] = deleteAt
+}
+
+// resumeGrace picks up the servers held for inspection by an earlier plugin
+// process, so they are still deleted when their grace period ends.
+func (g *InstanceGroup) resumeGrace(ctx context.Context) error {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: append(g.groupFilters(),
+			request.FilterLabel{Label: upcloud.Label{Key: stateLabelKey, Value: stateLabelGrace}},
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("listing servers held for inspection: %w", err)
+	}
+
+	for _, s := range servers.Servers {
+		details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: s.UUID})
+		if err != nil {
+			return fmt.Errorf("reading server %s: %w", s.UUID, err)
+		}
+		// A missing or garbled deadline means the server is due now.
+		var deleteAt time.Time
+		for _, l := range details.Labels {
+			if l.Key == deleteAfterLabelKey {
+				if sec, err := strconv.ParseInt(l.Value, 10, 64); err == nil {
+					deleteAt = time.Unix(sec, 0)
+				}
+			}
+		}
+		g.holdUntil(s.UUID, deleteAt)
+	}
+	return nil
+}
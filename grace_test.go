@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── deletion grace period ────────────────────────────────────────────────────
+
+func TestDecrease_DeletionGracePeriod(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		labels  upcloud.LabelSlice
+		deleted []string
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.modifyServer = func(_ context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		labels = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStopped}}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.DeletionGracePeriod = Duration(time.Hour)
+	if succeeded, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil || len(succeeded) != 1 {
+		t.Fatalf("Decrease() = %v, %v, want uuid-1 removed", succeeded, err)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted = %v before the grace period ended", deleted)
+	}
+	if v, _ := labelValue(labels, stateLabelKey); v != stateLabelGrace {
+		t.Errorf("label %s = %q, want %q", stateLabelKey, v, stateLabelGrace)
+	}
+	v, _ := labelValue(labels, deleteAfterLabelKey)
+	if sec, _ := strconv.ParseInt(v, 10, 64); time.Until(time.Unix(sec, 0)) < 59*time.Minute {
+		t.Errorf("label %s = %q, want about an hour from now", deleteAfterLabelKey, v)
+	}
+
+	var reported []string
+	update := func() {
+		if err := g.Update(context.Background(), func(id string, _ provider.State) { reported = append(reported, id) }); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+	}
+	update()
+	if len(reported) != 0 || len(deleted) != 0 {
+		t.Fatalf("Update() reported %v and deleted %v while the server is held", reported, deleted)
+	}
+
+	g.holdUntil("uuid-1", time.Now().Add(-time.Second))
+	update()
+	g.Shutdown(context.Background())
+	if len(reported) != 0 || len(deleted) != 1 {
+		t.Errorf("Update() reported %v and deleted %v after the grace period, want the server deleted", reported, deleted)
+	}
+}
+
+func TestResumeGrace(t *testing.T) {
+	deleteAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1"}, {UUID: "uuid-2"}}}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		if r.UUID == "uuid-1" {
+			d.Labels = append(d.Labels, upcloud.Label{Key: deleteAfterLabelKey, Value: strconv.FormatInt(deleteAt.Unix(), 10)})
+		}
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	if err := g.resumeGrace(context.Background()); err != nil {
+		t.Fatalf("resumeGrace() unexpected error: %v", err)
+	}
+	if at, ok := g.graceDeadline("uuid-1"); !ok || !at.Equal(deleteAt) {
+		t.Errorf("uuid-1 deadline = %v, %v, want %v", at, ok, deleteAt)
+	}
+	if at, ok := g.graceDeadline("uuid-2"); !ok || !at.IsZero() {
+		t.Errorf("uuid-2 deadline = %v, %v, want due now", at, ok)
+	}
+}
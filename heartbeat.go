@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// tryRepair gives a server found stopped or in the error state one restart
+// before Heartbeat declares it unhealthy, so an instance that only needs a
+// reboot keeps its warm caches. It reports whether a restart was issued;
+// later calls for the same server return false.
+func (g *InstanceGroup) tryRepair(ctx context.Context, log hclog.Logger, uuid string, details *upcloud.ServerDetails) bool {
+	if !g.HeartbeatRestart || g.removing(uuid, details) {
+		return false
+	}
+	g.heartbeatMu.Lock()
+	if g.repaired[uuid] {
+		g.heartbeatMu.Unlock()
+		return false
+	}
+	if g.repaired == nil {
+		g.repaired = make(map[string]bool)
+	}
+	g.repaired[uuid] = true
+	g.heartbeatMu.Unlock()
+
+	var err error
+	if details.State == upcloud.ServerStateStopped {
+		_, err = g.svc.StartServer(ctx, &request.StartServerRequest{UUID: uuid, Host: g.DedicatedHost})
+	} else {
+		_, err = g.svc.RestartServer(ctx, &request.RestartServerRequest{
+			UUID:          uuid,
+			StopType:      request.ServerStopTypeHard,
+			TimeoutAction: request.RestartTimeoutActionDestroy,
+			Host:          g.DedicatedHost,
+		})
+	}
+	g.audit(auditRestart, uuid, details.Hostname, details.Zone, err)
+	if err != nil {
+		log.Warn("failed to restart unhealthy server", "state", details.State, "error", err)
+		return false
+	}
+	log.Warn("restarted unhealthy server", "state", details.State)
+	return true
+}
+
+// failureThreshold returns the number of consecutive failed heartbeats
+// that make an instance unhealthy.
+func (g *InstanceGroup) failureThreshold() int {
+	return max(g.HeartbeatFailureThreshold, 1)
+}
+
+// countFailure records a failed heartbeat and returns the number of
+// consecutive failures of the server so far.
+func (g *InstanceGroup) countFailure(uuid string) int {
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	if g.failures == nil {
+		g.failures = make(map[string]int)
+	}
+	g.failures[uuid]++
+	return g.failures[uuid]
+}
+
+// resetFailures clears the failure count of a server that passed a check.
+func (g *InstanceGroup) resetFailures(uuid string) {
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	delete(g.failures, uuid)
+}
+
+// heartbeatResult is the outcome of a Heartbeat, kept for HeartbeatCacheTTL.
+type heartbeatResult struct {
+	at  time.Time
+	err error
+}
+
+// cachedHeartbeat returns the server's last heartbeat result if it is
+// younger than HeartbeatCacheTTL.
+func (g *InstanceGroup) cachedHeartbeat(uuid string) (heartbeatResult, bool) {
+	if g.HeartbeatCacheTTL <= 0 {
+		return heartbeatResult{}, false
+	}
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	r, ok := g.heartbeats[uuid]
+	if !ok || time.Since(r.at) >= time.Duration(g.HeartbeatCacheTTL) {
+		return heartbeatResult{}, false
+	}
+	return r, true
+}
+
+// cacheHeartbeat stores the result of a Heartbeat; it is deferred with a
+// pointer to the named error result.
+func (g *InstanceGroup) cacheHeartbeat(uuid string, err *error) {
+	if g.HeartbeatCacheTTL <= 0 {
+		return
+	}
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	if g.heartbeats == nil {
+		g.heartbeats = make(map[string]heartbeatResult)
+	}
+	g.heartbeats[uuid] = heartbeatResult{at: time.Now(), err: *err}
+}
+
+// forgetHeartbeat drops the heartbeat state of a removed server.
+func (g *InstanceGroup) forgetHeartbeat(uuid string) {
+	g.heartbeatMu.Lock()
+	defer g.heartbeatMu.Unlock()
+	delete(g.repaired, uuid)
+	delete(g.failures, uuid)
+	delete(g.heartbeats, uuid)
+	delete(g.unhealthy, uuid)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── heartbeat repair ─────────────────────────────────────────────────────────
+
+func TestHeartbeat_RestartsOnce(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       string
+		wantStarts  int
+		wantRestart int
+	}{
+		{name: "stopped", state: upcloud.ServerStateStopped, wantStarts: 1},
+		{name: "error", state: upcloud.ServerStateError, wantRestart: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var starts, restarts int
+			mock := newMockSvc()
+			mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+				d := makeDetails("", "")
+				d.State = tc.state
+				return d, nil
+			}
+			mock.startServer = func(context.Context, *request.StartServerRequest) (*upcloud.ServerDetails, error) {
+				starts++
+				return &upcloud.ServerDetails{}, nil
+			}
+			mock.restartServer = func(_ context.Context, r *request.RestartServerRequest) (*upcloud.ServerDetails, error) {
+				if r.StopType != request.ServerStopTypeHard {
+					t.Errorf("restart stop type = %q, want hard", r.StopType)
+				}
+				restarts++
+				return &upcloud.ServerDetails{}, nil
+			}
+
+			g := baseGroup(mock)
+			g.HeartbeatRestart = true
+			if err := g.Heartbeat(context.Background(), "uuid-1"); err != nil {
+				t.Fatalf("first Heartbeat() = %v, want nil while the restart is attempted", err)
+			}
+			// A server that is still broken after its restart is not retried.
+			if err := g.Heartbeat(context.Background(), "uuid-1"); err == nil {
+				t.Error("second Heartbeat() = nil, want error")
+			}
+			if starts != tc.wantStarts || restarts != tc.wantRestart {
+				t.Errorf("starts = %d, restarts = %d, want %d, %d", starts, restarts, tc.wantStarts, tc.wantRestart)
+			}
+		})
+	}
+}
+
+func TestHeartbeat_NoRestartWhileDeleting(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.State = upcloud.ServerStateStopped
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.HeartbeatRestart = true
+	g.setDeleting("uuid-1", true)
+	g.Heartbeat(context.Background(), "uuid-1") // StartServer panics if called
+}
+
+func TestHeartbeat_StoppedServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup, *upcloud.ServerDetails)
+		wantErr bool
+	}{
+		{name: "stopped outside decrease", wantErr: true},
+		{name: "being deleted", mod: func(g *InstanceGroup, _ *upcloud.ServerDetails) { g.setDeleting("uuid-1", true) }},
+		{name: "labelled for deletion", mod: func(_ *InstanceGroup, d *upcloud.ServerDetails) {
+			d.Labels = append(d.Labels, upcloud.Label{Key: stateLabelKey, Value: stateLabelDeleting})
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			details := makeDetails("", "")
+			details.State = upcloud.ServerStateStopped
+			mock := newMockSvc()
+			mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+				return details, nil
+			}
+
+			g := baseGroup(mock)
+			if tc.mod != nil {
+				tc.mod(g, details)
+			}
+			if err := g.Heartbeat(context.Background(), "uuid-1"); (err != nil) != tc.wantErr {
+				t.Errorf("Heartbeat() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeartbeat_FailureThreshold(t *testing.T) {
+	state := upcloud.ServerStateError
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.State = state
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.HeartbeatFailureThreshold = 3
+	heartbeat := func() error { return g.Heartbeat(context.Background(), "uuid-1") }
+
+	for i := 1; i < 3; i++ {
+		if err := heartbeat(); err != nil {
+			t.Fatalf("Heartbeat() #%d = %v, want nil below the threshold", i, err)
+		}
+	}
+	// A healthy check resets the count.
+	state = upcloud.ServerStateStarted
+	heartbeat()
+	state = upcloud.ServerStateError
+	for i := 1; i < 3; i++ {
+		if err := heartbeat(); err != nil {
+			t.Fatalf("Heartbeat() #%d after reset = %v, want nil", i, err)
+		}
+	}
+	if err := heartbeat(); err == nil {
+		t.Error("Heartbeat() = nil at the threshold, want error")
+	}
+}
+
+func TestHeartbeat_CachesResult(t *testing.T) {
+	var calls int
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		d := makeDetails("", "")
+		d.State = upcloud.ServerStateError
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.HeartbeatCacheTTL = Duration(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := g.Heartbeat(context.Background(), "uuid-1"); err == nil {
+			t.Fatalf("Heartbeat() #%d = nil, want the cached error", i)
+		}
+	}
+	g.Heartbeat(context.Background(), "uuid-2")
+	if calls != 2 {
+		t.Errorf("GetServerDetails called %d times, want once per instance", calls)
+	}
+
+	g.forgetServer("uuid-1")
+	g.Heartbeat(context.Background(), "uuid-1")
+	if calls != 3 {
+		t.Errorf("GetServerDetails called %d times after forgetServer, want 3", calls)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+const (
+	// maxHostnameAttempts bounds how often a colliding hostname is regenerated.
+	maxHostnameAttempts = 10
+
+	// Bounds for suffix_length: short suffixes collide too often, and long
+	// ones push hostnames towards the 63 character label limit.
+	minSuffixLength = 4
+	maxSuffixLength = 32
+)
+
+// Values accepted for hostname_format. Structured hostnames read as
+// prefix-zone-YYYYMMDD-suffix, telling where and when a server was created.
+const (
+	hostnameFormatRandom     = "random"
+	hostnameFormatStructured = "structured"
+)
+
+var validHostnameFormats = []string{hostnameFormatRandom, hostnameFormatStructured}
+
+// hostnameSuffix generates the random part of a hostname; overridden in tests.
+var hostnameSuffix = randomSuffix
+
+// takenHostnames returns the hostnames of the group's current servers.
+// A failed lookup is logged and yields an empty set: a collision is rare,
+// and failing the whole scale-up over it would be worse.
+func (g *InstanceGroup) takenHostnames(ctx context.Context) map[string]bool {
+	taken := map[string]bool{}
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{Filters: g.groupFilters()})
+	if err != nil {
+		g.logger(logScaling).Warn("failed to list servers for hostname collision check", "error", err)
+		return taken
+	}
+	for _, s := range servers.Servers {
+		taken[s.Hostname] = true
+	}
+	return taken
+}
+
+// formatHostname builds a hostname for a server created at now.
+func (g *InstanceGroup) formatHostname(now time.Time) string {
+	suffix := hostnameSuffix(g.SuffixLength)
+	if g.HostnameFormat == hostnameFormatStructured {
+		return fmt.Sprintf("%s-%s-%s-%s", g.NamePrefix, g.Zone, now.UTC().Format("20060102"), suffix)
+	}
+	return fmt.Sprintf("%s-%s", g.NamePrefix, suffix)
+}
+
+// newHostname generates a hostname not present in taken and records it
+// there, so servers created in the same batch cannot collide either.
+func (g *InstanceGroup) newHostname(taken map[string]bool, now time.Time) (string, error) {
+	for range maxHostnameAttempts {
+		hostname := g.formatHostname(now)
+		if !taken[hostname] {
+			taken[hostname] = true
+			return hostname, nil
+		}
+		g.logger(logScaling).Debug("generated hostname already in use, retrying", "hostname", hostname)
+	}
+	return "", fmt.Errorf("no free hostname after %d attempts", maxHostnameAttempts)
+}
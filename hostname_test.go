@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── hostname collisions ──────────────────────────────────────────────────────
+
+// stubSuffixes makes hostnameSuffix return suffixes in order, repeating the
+// last one once they are exhausted.
+func stubSuffixes(t *testing.T, suffixes ...string) {
+	t.Helper()
+	orig := hostnameSuffix
+	t.Cleanup(func() { hostnameSuffix = orig })
+	i := 0
+	hostnameSuffix = func(int) string {
+		s := suffixes[min(i, len(suffixes)-1)]
+		i++
+		return s
+	}
+}
+
+func TestNewHostname_RegeneratesOnCollision(t *testing.T) {
+	stubSuffixes(t, "aaaaaaaa", "aaaaaaaa", "bbbbbbbb")
+	g := baseGroup(newMockSvc())
+	g.NamePrefix = "fleeting"
+	taken := map[string]bool{"fleeting-aaaaaaaa": true}
+
+	h, err := g.newHostname(taken, time.Now())
+	if err != nil || h != "fleeting-bbbbbbbb" {
+		t.Fatalf("newHostname() = (%q, %v), want (fleeting-bbbbbbbb, nil)", h, err)
+	}
+	if !taken[h] {
+		t.Errorf("hostname %q not recorded as taken", h)
+	}
+}
+
+func TestNewHostname_GivesUp(t *testing.T) {
+	stubSuffixes(t, "aaaaaaaa")
+	g := baseGroup(newMockSvc())
+	g.NamePrefix = "fleeting"
+	if _, err := g.newHostname(map[string]bool{"fleeting-aaaaaaaa": true}, time.Now()); err == nil {
+		t.Error("newHostname() expected error when every attempt collides, got nil")
+	}
+}
+
+func TestNewHostname_SuffixLength(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.NamePrefix = "fleeting"
+	g.SuffixLength = 12
+	h, err := g.newHostname(map[string]bool{}, time.Now())
+	if err != nil {
+		t.Fatalf("newHostname() unexpected error: %v", err)
+	}
+	if want := len("fleeting-") + 12; len(h) != want {
+		t.Errorf("newHostname() = %q, want length %d", h, want)
+	}
+}
+
+func TestIncrease_AvoidsHostnameCollisions(t *testing.T) {
+	stubSuffixes(t, "aaaaaaaa", "bbbbbbbb", "bbbbbbbb", "cccccccc")
+	var created []string
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{Hostname: "fleeting-aaaaaaaa"}}}, nil
+	}
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		created = append(created, r.Hostname)
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.NamePrefix = "fleeting"
+	if n, err := g.Increase(context.Background(), 2); n != 2 || err != nil {
+		t.Fatalf("Increase() = (%d, %v), want (2, nil)", n, err)
+	}
+	if len(created) != 2 || created[0] != "fleeting-bbbbbbbb" || created[1] != "fleeting-cccccccc" {
+		t.Errorf("created hostnames = %v, want [fleeting-bbbbbbbb fleeting-cccccccc]", created)
+	}
+}
+
+func TestIncrease_ListFailureDoesNotBlockCreation(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return nil, errors.New("api error")
+	}
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	if n, err := g.Increase(context.Background(), 1); n != 1 || err != nil {
+		t.Errorf("Increase() = (%d, %v), want (1, nil)", n, err)
+	}
+}
+
+func TestFormatHostname(t *testing.T) {
+	stubSuffixes(t, "abc123")
+	now := time.Date(2024, 3, 10, 1, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	for format, want := range map[string]string{
+		hostnameFormatRandom:     "fleeting-abc123",
+		hostnameFormatStructured: "fleeting-fi-hel1-20240309-abc123",
+	} {
+		g := baseGroup(newMockSvc())
+		g.NamePrefix = "fleeting"
+		g.HostnameFormat = format
+		if got := g.formatHostname(now); got != want {
+			t.Errorf("formatHostname() with %s format = %q, want %q", format, got, want)
+		}
+	}
+}
@@ -2,9 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
-	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
@@ -14,6 +24,7 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
 )
 
 // upcloudSvc is the subset of the UpCloud API used by InstanceGroup.
@@ -23,22 +34,69 @@ type upcloudSvc interface {
 	GetServersWithFilters(ctx context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error)
 	CreateServer(ctx context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error)
 	StopServer(ctx context.Context, r *request.StopServerRequest) (*upcloud.ServerDetails, error)
+	StartServer(ctx context.Context, r *request.StartServerRequest) (*upcloud.ServerDetails, error)
+	RestartServer(ctx context.Context, r *request.RestartServerRequest) (*upcloud.ServerDetails, error)
 	WaitForServerState(ctx context.Context, r *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error)
 	DeleteServerAndStorages(ctx context.Context, r *request.DeleteServerAndStoragesRequest) error
+	DeleteServer(ctx context.Context, r *request.DeleteServerRequest) error
 	GetServerDetails(ctx context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error)
+	GetIPAddressDetails(ctx context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error)
+	ModifyIPAddress(ctx context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error)
+	ModifyServer(ctx context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error)
+	GetStorageDetails(ctx context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error)
+	GetStorages(ctx context.Context, r *request.GetStoragesRequest) (*upcloud.Storages, error)
+	DeleteStorage(ctx context.Context, r *request.DeleteStorageRequest) error
+	ModifyStorage(ctx context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error)
+	TemplatizeStorage(ctx context.Context, r *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error)
+	WaitForStorageState(ctx context.Context, r *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error)
+	GetZones(ctx context.Context) (*upcloud.Zones, error)
+	GetPlans(ctx context.Context) (*upcloud.Plans, error)
+	GetHosts(ctx context.Context) (*upcloud.Hosts, error)
+	GetPricesByZone(ctx context.Context) (*upcloud.PricesByZone, error)
+	GetNetworkDetails(ctx context.Context, r *request.GetNetworkDetailsRequest) (*upcloud.Network, error)
+	CreateRouter(ctx context.Context, r *request.CreateRouterRequest) (*upcloud.Router, error)
+	AttachNetworkRouter(ctx context.Context, r *request.AttachNetworkRouterRequest) error
+	GetGateways(ctx context.Context, f ...request.QueryFilter) ([]upcloud.Gateway, error)
+	CreateGateway(ctx context.Context, r *request.CreateGatewayRequest) (*upcloud.Gateway, error)
+	GetNetworksInZone(ctx context.Context, r *request.GetNetworksInZoneRequest) (*upcloud.Networks, error)
+	CreateNetwork(ctx context.Context, r *request.CreateNetworkRequest) (*upcloud.Network, error)
 }
 
 // newUpcloudService constructs the production UpCloud service. Tests may replace this.
 var newUpcloudService = func(c *client.Client) upcloudSvc {
-	return service.New(c)
+	return problemSvc{next: service.New(c)}
 }
 
 const (
-	groupLabelKey      = "fleeting-group"
-	defaultPlan        = "1xCPU-2GB"
+	groupLabelKey = "fleeting-group"
+	defaultPlan   = "1xCPU-2GB"
 	// defaultStorageSize = 30
-	defaultNamePrefix  = "fleeting"
-	defaultMaxSize     = 100
+	defaultNamePrefix   = "fleeting"
+	defaultSuffixLength = 8
+	defaultMaxSize      = 100
+	defaultOS           = "linux"
+	defaultArch         = "amd64"
+
+	defaultPreDeleteTimeout = 2 * time.Minute
+	defaultReadinessTimeout = 10 * time.Minute
+
+	defaultDeleteConcurrency = 10
+)
+
+// Values accepted for default_os and default_arch; these follow the GOOS/GOARCH
+// naming the runner uses when picking fleeting helper binaries.
+var (
+	validOS   = []string{"linux", "windows", "darwin"}
+	validArch = []string{"amd64", "arm64", "386", "arm"}
+)
+
+// Server hardware options accepted by the UpCloud API.
+var (
+	validNICModels   = []string{"virtio", "e1000", "rtl8139"}
+	validVideoModels = []string{"vga", "cirrus"}
+	validBootDevices = []string{"disk", "cdrom", "network"}
+
+	validStorageTiers = []string{"maxiops", "standard", "hdd"}
 )
 
 // InstanceGroup implements provider.InstanceGroup for UpCloud.
@@ -51,116 +109,1141 @@ type InstanceGroup struct {
 
 	// Required config
 	Zone     string `json:"zone"`
-	Template string `json:"template"`
-	Name     string `json:"name"` // unique group name; used as UpCloud label value
+	Template string `json:"template"` // optional when Templates covers the instance arch
+	Name     string `json:"name"`     // unique group name; used as UpCloud label value
+
+	// Templates maps an architecture ("amd64", "arm64") to the template
+	// cloned for it, e.g. for UpCloud's ARM cloud-native plans. The arch is
+	// connector_config.arch, falling back to default_arch.
+	Templates map[string]string `json:"templates"`
+
+	// TemplatesByZone maps a zone to the template cloned there, since
+	// private templates only exist in the zone they were created in. It
+	// takes precedence over template and templates, and is how
+	// fallback_zones get a zone-local template.
+	TemplatesByZone map[string]string `json:"templates_by_zone"`
+
+	// TemplateFile holds a template UUID overriding template/templates. It is
+	// re-read before every scale-up, so a new image can be rolled out without
+	// restarting the runner; see the set-template command.
+	TemplateFile string `json:"template_file"`
+
+	// TemplateSelector picks the newest private template in the zone carrying
+	// all of these labels, e.g. {"image": "ci-runner"}, so nightly image
+	// builds are used without editing the config. It takes precedence over
+	// template/templates; template_file still overrides it.
+	TemplateSelector map[string]string `json:"template_selector"`
 
 	// Optional config
-	Plan              string `json:"plan"`               // default: "1xCPU-2GB"
-	StorageSize       int    `json:"storage_size"`       // GB, default: 30
-	StorageTier       string `json:"storage_tier"`       // "maxiops" or "standard"; default: inherit from template
-	NamePrefix        string `json:"name_prefix"`        // hostname prefix, default: "fleeting"
-	MaxSize           int    `json:"max_size"`           // default: 100
+	Plan              string `json:"plan"`                // default: "1xCPU-2GB"
+	StorageSize       int    `json:"storage_size"`        // GB, default: template size; raised to it if smaller
+	StorageTier       string `json:"storage_tier"`        // "maxiops", "standard" or "hdd"; default: inherit from template
+	NamePrefix        string `json:"name_prefix"`         // hostname prefix, default: "fleeting"
+	SuffixLength      int    `json:"suffix_length"`       // random hostname suffix length, default: 8
+	HostnameFormat    string `json:"hostname_format"`     // "random" or "structured" (prefix-zone-YYYYMMDD-suffix), default: "random"
+	MaxSize           int    `json:"max_size"`            // default: 100
+	MinSize           int    `json:"min_size"`            // warm instances kept alive whatever the demand; default: 0
 	UsePrivateNetwork bool   `json:"use_private_network"` // default: false (use public IP)
 	UserData          string `json:"user_data"`           // optional: URL or script body for server initialization
+	Bootstrap         bool   `json:"bootstrap"`           // default: false; install Docker and runner dependencies via built-in cloud-init
+	PrivateNetwork    string `json:"private_network"`     // SDN private network UUID for the private interface
+	UseUtilityNetwork bool   `json:"use_utility_network"` // default: false; attach a utility network interface
+	PrivateOnly       bool   `json:"private_only"`        // default: false; create servers without a public interface
+	NATGateway        string `json:"nat_gateway"`         // "require" or "create"; check or provision outbound internet for private_network
+	DefaultOS         string `json:"default_os"`          // default: "linux"; used when connector_config.os is unset
+	DefaultArch       string `json:"default_arch"`        // default: "amd64"; used when connector_config.arch is unset
+	Metadata          *bool  `json:"metadata"`            // default: true; enable the UpCloud metadata service
+	RemoteAccess      bool   `json:"remote_access"`       // default: false; VNC console stays explicitly disabled
+
+	// PrivateNetworkCIDR lets the plugin set up the private network itself
+	// when private_network is unset: a private network named
+	// PrivateNetworkName (default "<name>-network") is reused if it exists in
+	// the zone, or created with this IPv4 range and a router.
+	PrivateNetworkCIDR string `json:"private_network_cidr"`
+	PrivateNetworkName string `json:"private_network_name"`
+
+	// PrivateNetworks are further SDN private networks every server joins,
+	// after private_network. Connections use the first network in the list
+	// when private_network is unset.
+	PrivateNetworks []string `json:"private_networks"`
+
+	// InterfaceOrder sets the order of interface kinds ("public", "private",
+	// "utility") on new servers. Guest images usually take their default
+	// route from the first interface. Unlisted kinds follow in the default
+	// public, private, utility order.
+	InterfaceOrder []string `json:"interface_order"`
+
+	// PublicIPFamily selects the address families of the public interface:
+	// "ipv4" (default), "ipv6" for IPv6-only instances, or "dual".
+	PublicIPFamily string `json:"public_ip_family"`
+
+	// PreferAddress picks the address handed to the runner as ExternalAddr:
+	// "public_ipv4", "public_ipv6", "private" or "utility". When unset, or
+	// when the server has no such address, the public IPv4 address is used
+	// unless use_private_network or private_only is set.
+	PreferAddress string `json:"prefer_address"`
+
+	// ConnectDNSTemplate replaces the external address in ConnectInfo with a
+	// DNS name rendered from a Go template, e.g. "{{.Hostname}}.ci.example.com";
+	// .UUID, .Hostname, .Zone, .Group and .Address are available.
+	// ConnectReverseDNS uses the address's reverse DNS name instead.
+	ConnectDNSTemplate string `json:"connect_dns_template"`
+	ConnectReverseDNS  bool   `json:"connect_reverse_dns"`
+
+	// FallbackZones are tried in order, for the same instance, when creating
+	// it in Zone fails for lack of capacity. The template must be usable in
+	// every zone; zone-bound resources such as private networks and
+	// floating IPs cannot be combined with them.
+	FallbackZones []string `json:"fallback_zones"`
+
+	// DedicatedHost places every server on the private cloud host with this
+	// ID, for workloads that must not share hardware with other customers.
+	// The host must be in Zone.
+	DedicatedHost int `json:"dedicated_host"`
+
+	// PrivateIPRange assigns static addresses on the primary private network
+	// instead of DHCP, e.g. "10.0.0.100-10.0.0.199" or "10.0.0.128/25". The
+	// range should not overlap addresses used outside the group.
+	PrivateIPRange string `json:"private_ip_range"`
+
+	// PrivateMTU sets the MTU of the private network interfaces through
+	// injected cloud-init, for SDN networks where 1500 fragments against
+	// tunnelled destinations. 0 keeps the image default.
+	PrivateMTU int `json:"private_mtu"`
+
+	// FetchUserData makes the plugin download a user_data URL at create time
+	// and pass its content inline, instead of leaving the fetch to the
+	// instance. Setting UserDataSHA256 implies it and pins the content.
+	FetchUserData  bool   `json:"fetch_user_data"`
+	UserDataSHA256 string `json:"user_data_sha256"`
+
+	// TemplateUserData renders user_data as a Go template at create time,
+	// resolving {{ secret "NAME" }} from the environment or, failing that,
+	// from the file NAME in SecretsDir.
+	TemplateUserData bool   `json:"template_user_data"`
+	SecretsDir       string `json:"secrets_dir"`
+
+	// StaleInstanceTimeout removes servers that have not reached running this
+	// long after creation. Zero (the default) disables the check.
+	StaleInstanceTimeout Duration `json:"stale_instance_timeout"`
+
+	// ProvisioningTimeout reports servers that have not reached running this
+	// long after creation as timed out, leaving their removal to the runner.
+	// Zero (the default) disables the check.
+	ProvisioningTimeout Duration `json:"provisioning_timeout"`
+
+	// DeletionGracePeriod makes Decrease stop servers but only delete them
+	// this long afterwards, giving operators a window to inspect a VM whose
+	// job failed mysteriously. Held servers are hidden from the runner.
+	DeletionGracePeriod Duration `json:"deletion_grace_period"`
+
+	// DiagnosticsDir receives a JSON record of the final server details of
+	// every instance removed because it was unhealthy, for post-mortems.
+	// DiagnosticsCommand, if set, is run over SSH first on instances that
+	// are still running and its output included, e.g.
+	// "journalctl -b --no-pager -n 500".
+	DiagnosticsDir     string `json:"diagnostics_dir"`
+	DiagnosticsCommand string `json:"diagnostics_command"`
+
+	// KeepFailedInstances leaves instances that failed to come up or failed
+	// their heartbeat running, labelled fleeting-debug and hidden from the
+	// runner, instead of removing them, for debugging template and
+	// bootstrap problems. At most KeepFailedInstancesMax (default 1) are
+	// kept at a time; later failures are removed as usual. Kept instances
+	// must be deleted by hand.
+	KeepFailedInstances    bool `json:"keep_failed_instances"`
+	KeepFailedInstancesMax int  `json:"keep_failed_instances_max"`
+
+	// PreserveStorages deletes removed servers but keeps their disks,
+	// labelled fleeting-preserved, so they can be attached elsewhere and
+	// inspected. PreservedStorageRetention deletes them again once they are
+	// this old; zero keeps them until removed by hand.
+	PreserveStorages          bool     `json:"preserve_storages"`
+	PreservedStorageRetention Duration `json:"preserved_storage_retention"`
+
+	// OrphanedStorageGrace labels the disks of new servers as the group's
+	// and deletes such disks once their server has been gone this long,
+	// cleaning up after interrupted deletions. Zero disables it.
+	OrphanedStorageGrace Duration `json:"orphaned_storage_grace"`
+
+	// RecreateVanished replaces instances that disappeared without the
+	// plugin removing them, e.g. deleted in the console, as soon as Update
+	// notices. Such drift is always logged and counted.
+	RecreateVanished bool `json:"recreate_vanished"`
+
+	// ZoneMaintenancePause pauses creations in a zone for this long after
+	// the API reports it under maintenance with a maintenance error,
+	// instead of failing against it on every scale-up. Default: 15m.
+	// StatusPageURL is a Statuspage site, e.g. "https://status.upcloud.com",
+	// polled every 5 minutes; zones named by an active scheduled maintenance
+	// are paused until it is scheduled to end.
+	ZoneMaintenancePause Duration `json:"zone_maintenance_pause"`
+	StatusPageURL        string   `json:"status_page_url"`
+
+	// ScaleBlackout lists cron expressions ("minute hour day-of-month month
+	// day-of-week") selecting the minutes during which Increase creates no
+	// servers, e.g. "* 0-6,20-23 * * *" and "* * * * 6,0" to keep nightly
+	// and weekend pipelines from starting capacity outside business hours.
+	// They are evaluated in ScaleBlackoutTimezone, UTC by default.
+	ScaleBlackout         []string `json:"scale_blackout"`
+	ScaleBlackoutTimezone string   `json:"scale_blackout_timezone"`
+
+	// CreditWarnThreshold and CreditFloor watch the balance of prepaid
+	// accounts, in the account currency, checked at Init and every 15
+	// minutes. Below the threshold a warning is logged; below the floor
+	// Increase refuses to create servers, so the fleet stops growing before
+	// creations start failing mid-pipeline. Zero disables either check.
+	CreditWarnThreshold float64 `json:"credit_warn_threshold"`
+	CreditFloor         float64 `json:"credit_floor"`
+
+	// UsageReportInterval logs a summary of instance usage this often:
+	// instances created and deleted, and instance-hours by plan, for
+	// capacity planning. A final summary is always logged at shutdown.
+	// Zero disables the periodic reports.
+	UsageReportInterval Duration `json:"usage_report_interval"`
+
+	// KeepBackups keeps the backups of deleted storages. By default they
+	// are deleted along with the storage so account-level backup rules do
+	// not pile up snapshots of dead instances.
+	KeepBackups bool `json:"keep_backups"`
+
+	// DeleteErrorServers removes servers UpCloud reports in the error state
+	// as soon as Update or Heartbeat sees them, storages included.
+	DeleteErrorServers bool `json:"delete_error_servers"`
+
+	// HeartbeatRestart makes Heartbeat start a stopped server, or restart
+	// one in the error state, once before reporting it unhealthy. Many
+	// broken instances only need a reboot, and keeping them preserves
+	// their warm caches.
+	HeartbeatRestart bool `json:"heartbeat_restart"`
+
+	// HeartbeatFailureThreshold is the number of consecutive failed checks
+	// after which Heartbeat reports an instance unhealthy, so a single
+	// flaky state read does not replace it mid-job. Default: 1.
+	HeartbeatFailureThreshold int `json:"heartbeat_failure_threshold"`
+
+	// HeartbeatCacheTTL reuses an instance's heartbeat result for this long
+	// instead of fetching its details again, for large fleets where the
+	// runner checks many instances in quick succession. Zero disables it.
+	HeartbeatCacheTTL Duration `json:"heartbeat_cache_ttl"`
+
+	// ServerCacheTTL keeps server details for this long after they were
+	// fetched, refreshing their state from every Update, so ConnectInfo and
+	// Heartbeat can usually be served without a GetServerDetails call. Zero
+	// disables the cache.
+	ServerCacheTTL Duration `json:"server_cache_ttl"`
+
+	// ConnectInfoCache keeps the connection details of running instances
+	// until they are removed, since their addresses do not change after
+	// boot, so repeated ConnectInfo calls do not hit the API.
+	ConnectInfoCache bool `json:"connect_info_cache"`
+
+	// PreDeleteCommand is run on an instance over SSH before it is stopped,
+	// e.g. to ship logs off the machine. Failures are logged, not fatal.
+	PreDeleteCommand string   `json:"pre_delete_command"`
+	PreDeleteTimeout Duration `json:"pre_delete_timeout"` // default: 2m
+
+	// ReadinessCommand is run on new instances over SSH until it succeeds;
+	// until then they are reported as still creating.
+	ReadinessCommand string   `json:"readiness_command"`
+	ReadinessTimeout Duration `json:"readiness_timeout"` // default: 10m
+
+	// WaitForCloudInit keeps new instances "creating" until cloud-init has
+	// finished, checked over SSH before any ReadinessCommand. Instances where
+	// cloud-init failed are reported as timed out.
+	WaitForCloudInit bool `json:"wait_for_cloud_init"`
+
+	// LogLevel filters the plugin's logs (trace, debug, info, warn or error);
+	// unset passes everything on to the runner. LogLevels overrides it for
+	// the api, scaling, heartbeat and gc components, e.g. {"scaling":
+	// "debug"} with log_level "info".
+	LogLevel  string            `json:"log_level"`
+	LogLevels map[string]string `json:"log_levels"`
+
+	// PprofAddress serves net/http/pprof on a loopback address such as
+	// "localhost:6060", for goroutine and heap profiles of a wedged plugin.
+	PprofAddress string `json:"pprof_address"`
+
+	// DebugAPI logs every UpCloud API call (method, path, status, duration,
+	// correlation ID and redacted bodies) for troubleshooting.
+	DebugAPI bool `json:"debug_api"`
+
+	// CreateRetries is how often a CreateServer call failing with a transient
+	// error (rate limiting, 5xx, temporary resource shortage) is retried
+	// before the instance slot is given up. CreateRetryBackoff is the initial
+	// pause, doubled after every attempt and jittered. Defaults: 0 and 2s.
+	CreateRetries      int      `json:"create_retries"`
+	CreateRetryBackoff Duration `json:"create_retry_backoff"`
+
+	// CreatePacing is the minimum time between CreateServer calls, across
+	// scale-ups, to smooth API usage. CreateBurst additionally pauses
+	// creation for CreateCooldown after that many calls in a row, so large
+	// scale-ups do not start a herd of clone operations that slow every
+	// instance's boot.
+	CreatePacing   Duration `json:"create_pacing"`
+	CreateBurst    int      `json:"create_burst"`
+	CreateCooldown Duration `json:"create_cooldown"`
+
+	// BreakerThreshold is how many consecutive API failures (network errors,
+	// 429 and 5xx) open the circuit breaker; calls then fail fast with
+	// "provider degraded" for BreakerCooldown before a single probe call is
+	// let through. Defaults: 5 and 1m.
+	BreakerThreshold int      `json:"breaker_threshold"`
+	BreakerCooldown  Duration `json:"breaker_cooldown"`
+
+	// DeleteConcurrency caps how many instances Decrease removes at once, so
+	// large scale-downs do not trip the API rate limits. Default: 10.
+	DeleteConcurrency int `json:"delete_concurrency"`
+
+	// AuditLog is the path of an append-only JSONL file recording every
+	// create, stop and delete the plugin performs.
+	AuditLog string `json:"audit_log"`
+
+	// GroupLabelKey is the label key identifying group members, for aligning
+	// with an existing label taxonomy. Default: "fleeting-group".
+	GroupLabelKey string `json:"group_label_key"`
+
+	// LabelFilters are extra labels (e.g. environment=prod) that group members
+	// must carry besides the group label. New servers get them too.
+	LabelFilters map[string]string `json:"label_filters"`
+
+	// CostCenter is stamped as a label on every server and disk the group
+	// creates, so invoices can be split by team with label-based reporting.
+	// The label key is CostCenterLabelKey, "cost-center" by default.
+	CostCenter         string `json:"cost_center"`
+	CostCenterLabelKey string `json:"cost_center_label_key"`
+
+	// ExcludeLabel ("key" or "key=value", e.g. "fleeting-ignore=true") protects
+	// servers carrying it: they are never reported by Update nor removed,
+	// even if they match the group label.
+	ExcludeLabel string `json:"exclude_label"`
+
+	// AdoptByPrefix makes Init take over existing servers in the zone whose
+	// hostname starts with this prefix by adding the group label, e.g. when
+	// migrating from the docker-machine executor.
+	AdoptByPrefix string `json:"adopt_by_prefix"`
+
+	// StateFile persists in-flight creations and deletions so a restarted
+	// plugin can finish or clean them up instead of orphaning servers. The
+	// lifetimes of created servers, for the billing command, are appended to
+	// a history file next to it.
+	StateFile string `json:"state_file"`
+
+	// WebhookURL receives a POST for every instance created, deleted or failed.
+	// WebhookTemplate optionally replaces the default JSON body with a Go
+	// text/template rendered against the event.
+	WebhookURL      string `json:"webhook_url"`
+	WebhookTemplate string `json:"webhook_template"`
+
+	// StatsDAddress sends operational metrics to a StatsD agent, as
+	// "host:port" over UDP or "unix:///path" for a DogStatsD socket; nothing
+	// listens on the runner host. DogStatsD adds group and zone tags plus
+	// StatsDTags (e.g. "env:prod") to every metric.
+	StatsDAddress string   `json:"statsd_address"`
+	StatsDPrefix  string   `json:"statsd_prefix"` // default: "fleeting_upcloud"
+	DogStatsD     bool     `json:"dogstatsd"`
+	StatsDTags    []string `json:"statsd_tags"`
+
+	// Server hardware and clock settings passed through to CreateServer.
+	Timezone   string `json:"timezone"`    // e.g. "Europe/Helsinki"; default: UpCloud's (UTC)
+	NICModel   string `json:"nic_model"`   // "virtio", "e1000" or "rtl8139"; default: UpCloud's
+	VideoModel string `json:"video_model"` // "vga" or "cirrus"; default: UpCloud's
+	BootOrder  string `json:"boot_order"`  // comma-separated "disk", "cdrom", "network"
+
+	// FloatingIPs is a pool of pre-allocated UpCloud floating IPv4 addresses.
+	// Each new instance gets a free address from the pool attached to its
+	// public interface; the address is detached again when the instance is removed.
+	FloatingIPs []string `json:"floating_ips"`
+
+	// Passphrase for an encrypted connector_config.key_path; set at most one.
+	KeyPassphrase     string `json:"key_passphrase"`
+	KeyPassphraseFile string `json:"key_passphrase_file"`
+
+	// EphemeralSSHKeys generates a fresh SSH key pair for every instance instead
+	// of injecting the connector key. Private keys only live in plugin memory.
+	EphemeralSSHKeys bool `json:"ephemeral_ssh_keys"`
+
+	// ExtraSSHKeys are additional authorized_keys entries injected next to the
+	// connector key, e.g. for on-call engineers debugging an instance.
+	ExtraSSHKeys []string `json:"extra_ssh_keys"`
+
+	// BastionAddress routes connections to instances through an SSH jump
+	// host: ConnectInfo hands out a local port that the plugin forwards to
+	// the instance's internal address over the bastion.
+	BastionAddress string `json:"bastion_address"`  // host or host:port
+	BastionUser    string `json:"bastion_user"`     // default: connector_config username
+	BastionKeyFile string `json:"bastion_key_file"` // default: the connector_config key
+	BastionHostKey string `json:"bastion_host_key"` // authorized_keys format; unset skips verification
 
 	// Internal state
 	log       hclog.Logger
 	settings  provider.Settings
 	svc       upcloudSvc
-	publicKey string // SSH authorized_keys format, derived from settings.ConnectorConfig.Key
+	publicKey string     // SSH authorized_keys format, derived from settings.ConnectorConfig.Key
+	ipMu      sync.Mutex // serialises floating IP allocation
+
+	privateIPMu sync.Mutex
+	privateIPs  map[string][]netip.Addr // private addresses of group servers, by UUID
+
+	// connectorKey is the decrypted connector key handed to the runner when
+	// the configured key is passphrase-protected; nil otherwise.
+	connectorKey []byte
+
+	template templateInfo // metadata of the configured template, fetched at Init
+
+	// templateOverride is the template read from TemplateFile, last modified
+	// at templateFileMod. Both are only touched by Init and Increase.
+	templateOverride string
+	templateFileMod  time.Time
+
+	// templateSelected is the newest template matching TemplateSelector, as
+	// of templateSelectedAt.
+	templateSelected   string
+	templateSelectedAt time.Time
+
+	managerHostname string // runner manager host, recorded as a label on created servers
+	configHash      string // short hash of the non-secret plugin config
+
+	staleMu         sync.Mutex
+	createdAt       map[string]time.Time // creation time by server UUID
+	seenRunning     map[string]bool      // servers that reached running at least once
+	runningLabelled map[string]bool      // servers known to carry the running-at label
+	deleting        map[string]bool      // servers currently being removed
+	graceUntil      map[string]time.Time // deletion time of servers held by DeletionGracePeriod
+	kept            map[string]bool      // failed servers kept by KeepFailedInstances
+	storageGCAt     time.Time            // when Update last started a storage cleanup
+	orphans         map[string]time.Time // when each orphaned storage was first seen
+
+	heartbeatMu sync.Mutex
+	repaired    map[string]bool            // servers Heartbeat already restarted once
+	failures    map[string]int             // consecutive failed heartbeats by server UUID
+	heartbeats  map[string]heartbeatResult // last results by server UUID when HeartbeatCacheTTL is set
+	unhealthy   map[string]string          // why a server was found broken, by UUID
+
+	serverCacheMu sync.Mutex
+	serverCache   map[string]cachedServer         // server details by UUID when ServerCacheTTL is set
+	connectInfos  map[string]provider.ConnectInfo // connection details by UUID when ConnectInfoCache is set
+
+	zoneMu             sync.Mutex
+	zonePauses         map[string]zonePause // zones paused for maintenance
+	maintenanceCheckAt time.Time            // when the status page was last polled
+
+	desiredMu     sync.Mutex
+	desired       map[string]time.Time // servers the group should have, with when they joined
+	desiredSeeded bool                 // whether the first Update has seeded desired
+	inflight      int                  // creations requested but not yet owned or given up
+
+	createMu sync.Mutex // serializes creations
+
+	warmMu       sync.Mutex
+	warming      bool      // a warm capacity replenishment is running
+	warmFailedAt time.Time // when the last replenishment came up short
+
+	paceMu    sync.Mutex
+	paceNext  time.Time // earliest time of the next CreateServer call
+	paceLast  time.Time // time of the last CreateServer call
+	paceBurst int       // CreateServer calls in the current burst
+
+	creditMu      sync.Mutex
+	credits       float64   // account balance as of the last check
+	creditsKnown  bool      // whether credits has been read at all
+	creditCheckAt time.Time // when the balance was last checked
+
+	usageMu sync.Mutex
+	usage   usageTracker // instance lifetimes since the last usage report
+
+	readyMu  sync.Mutex
+	ready    map[string]bool // servers whose readiness command succeeded
+	notReady map[string]bool // servers whose readiness command timed out
+	probing  map[string]bool // servers with a readiness probe in flight
+
+	probeOnce   sync.Once
+	probeCtx    context.Context
+	probeCancel context.CancelFunc
+
+	webhookTmpl *template.Template
+	auditMu     sync.Mutex
+	store       *stateStore // nil unless StateFile is set
+
+	connectNameTmpl *template.Template // nil unless ConnectDNSTemplate is set
+
+	blackouts   []cronSpec     // parsed ScaleBlackout
+	blackoutLoc *time.Location // time zone of blackouts
+
+	background sync.WaitGroup // background removals, probes and webhooks; waited for in Shutdown
+
+	keysMu       sync.Mutex
+	instanceKeys map[string][]byte // PEM private keys by server UUID when EphemeralSSHKeys is set
+
+	bastion *bastion // nil unless BastionAddress is set
+
+	metrics *statsd // nil unless StatsDAddress is set
+
+	pprof *http.Server // nil unless PprofAddress is set
+
+	dumpMu     sync.Mutex
+	lastUpdate time.Time              // when Update last listed the group
+	lastCounts map[provider.State]int // instances by state at lastUpdate
+
+	logLevel        hclog.Level            // parsed LogLevel; NoLevel when unset
+	componentLevels map[string]hclog.Level // parsed LogLevels
 }
 
 // validate checks that required config fields are set and applies defaults.
 func (g *InstanceGroup) validate() error {
+	// Collect every problem so a broken config can be fixed in one go.
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
 	if g.Token == "" && (g.Username == "" || g.Password == "") {
-		return fmt.Errorf("either token or both username and password are required")
+		fail("either token or both username and password are required")
 	}
 	if g.Zone == "" {
-		return fmt.Errorf("zone is required")
+		fail("zone is required")
+	}
+	for i, zone := range g.FallbackZones {
+		if zone == "" || slices.Contains(g.zones()[:i+1], zone) {
+			fail("fallback_zones[%d] %q is empty or repeats an earlier zone", i, zone)
+		}
+	}
+	if len(g.FallbackZones) > 0 && (g.UsePrivateNetwork || len(g.FloatingIPs) > 0) {
+		fail("fallback_zones cannot be combined with use_private_network or floating_ips, which are bound to one zone")
+	}
+	if g.OrphanedStorageGrace < 0 {
+		fail("orphaned_storage_grace must not be negative")
+	}
+	if g.ZoneMaintenancePause == 0 {
+		g.ZoneMaintenancePause = Duration(defaultZoneMaintenancePause)
+	} else if g.ZoneMaintenancePause < 0 {
+		fail("zone_maintenance_pause must not be negative")
+	}
+	if g.StatusPageURL != "" {
+		if u, err := url.Parse(g.StatusPageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("status_page_url %q must be an http(s) URL", g.StatusPageURL)
+		}
+	}
+	if g.CreatePacing < 0 || g.CreateBurst < 0 || g.CreateCooldown < 0 {
+		fail("create_pacing, create_burst and create_cooldown must not be negative")
+	}
+	if (g.CreateBurst > 0) != (g.CreateCooldown > 0) {
+		fail("create_burst and create_cooldown must be set together")
 	}
-	if g.Template == "" {
-		return fmt.Errorf("template is required")
+	if g.CreditWarnThreshold < 0 || g.CreditFloor < 0 {
+		fail("credit_warn_threshold and credit_floor must not be negative")
+	}
+	if g.UsageReportInterval < 0 {
+		fail("usage_report_interval must not be negative")
+	}
+	if g.PreservedStorageRetention < 0 {
+		fail("preserved_storage_retention must not be negative")
+	}
+	if g.KeepFailedInstancesMax < 0 {
+		fail("keep_failed_instances_max must not be negative")
+	}
+	if g.DeletionGracePeriod < 0 {
+		fail("deletion_grace_period must not be negative")
+	}
+	if g.ServerCacheTTL < 0 {
+		fail("server_cache_ttl must not be negative")
+	}
+	if g.HeartbeatCacheTTL < 0 {
+		fail("heartbeat_cache_ttl must not be negative")
+	}
+	if g.HeartbeatFailureThreshold < 0 {
+		fail("heartbeat_failure_threshold must not be negative")
+	}
+	if g.DedicatedHost < 0 {
+		fail("dedicated_host must not be negative")
+	}
+	if g.DedicatedHost > 0 && len(g.FallbackZones) > 0 {
+		fail("dedicated_host cannot be combined with fallback_zones; the host is in one zone")
+	}
+	if g.Template == "" && len(g.Templates) == 0 && len(g.TemplateSelector) == 0 && g.TemplatesByZone[g.Zone] == "" {
+		fail("template, templates or template_selector is required")
+	}
+	for zone := range g.TemplatesByZone {
+		if !slices.Contains(g.zones(), zone) {
+			fail("templates_by_zone key %q is neither zone nor one of fallback_zones", zone)
+		}
+	}
+	for k := range g.TemplateSelector {
+		if !labelKeyPattern.MatchString(k) {
+			fail("template_selector key %q is not a valid label key", k)
+		}
+	}
+	// Selected templates are private to the primary zone.
+	if len(g.TemplateSelector) > 0 {
+		for _, zone := range g.FallbackZones {
+			if g.TemplatesByZone[zone] == "" {
+				fail("fallback zone %q needs a templates_by_zone entry when template_selector is set", zone)
+			}
+		}
+	}
+	for arch := range g.Templates {
+		if !slices.Contains(validArch, arch) {
+			fail("templates key %q is not one of %v", arch, validArch)
+		}
 	}
 	if g.Name == "" {
-		return fmt.Errorf("name is required")
+		fail("name is required")
 	}
 	if g.Plan == "" {
 		g.Plan = defaultPlan
 	}
+	if g.GroupLabelKey == "" {
+		g.GroupLabelKey = groupLabelKey
+	} else if !labelKeyPattern.MatchString(g.GroupLabelKey) {
+		fail("group_label_key %q must be 2-32 letters, digits, '-' or '_' and not start with '_'", g.GroupLabelKey)
+	}
+	if g.ExcludeLabel != "" {
+		if key, _, _ := strings.Cut(g.ExcludeLabel, "="); !labelKeyPattern.MatchString(key) {
+			fail("exclude_label key %q must be 2-32 letters, digits, '-' or '_' and not start with '_'", key)
+		}
+	}
+	for k := range g.LabelFilters {
+		if !labelKeyPattern.MatchString(k) {
+			fail("label_filters key %q must be 2-32 letters, digits, '-' or '_' and not start with '_'", k)
+		} else if k == g.GroupLabelKey || strings.HasPrefix(k, "fleeting-") {
+			fail("label_filters key %q clashes with a label managed by the plugin", k)
+		}
+	}
+	if g.CostCenter != "" {
+		if g.CostCenterLabelKey == "" {
+			g.CostCenterLabelKey = defaultCostCenterLabelKey
+		}
+		if !labelKeyPattern.MatchString(g.CostCenterLabelKey) {
+			fail("cost_center_label_key %q must be 2-32 letters, digits, '-' or '_' and not start with '_'", g.CostCenterLabelKey)
+		} else if _, ok := g.LabelFilters[g.CostCenterLabelKey]; ok || g.CostCenterLabelKey == g.GroupLabelKey || strings.HasPrefix(g.CostCenterLabelKey, "fleeting-") {
+			fail("cost_center_label_key %q clashes with another label of the group", g.CostCenterLabelKey)
+		}
+		if len(g.CostCenter) > 255 {
+			fail("cost_center must be at most 255 characters")
+		}
+	} else if g.CostCenterLabelKey != "" {
+		fail("cost_center_label_key requires cost_center")
+	}
 	// if g.StorageSize == 0 {
 	// 	g.StorageSize = defaultStorageSize
 	// }
+	if g.StorageSize < 0 {
+		fail("storage_size must not be negative")
+	}
+	if g.StorageTier != "" && !slices.Contains(validStorageTiers, g.StorageTier) {
+		fail("storage_tier %q is not one of %v", g.StorageTier, validStorageTiers)
+	}
 	if g.NamePrefix == "" {
 		g.NamePrefix = defaultNamePrefix
 	}
-	if g.MaxSize == 0 {
+	if g.SuffixLength == 0 {
+		g.SuffixLength = defaultSuffixLength
+	} else if g.SuffixLength < minSuffixLength || g.SuffixLength > maxSuffixLength {
+		fail("suffix_length must be between %d and %d", minSuffixLength, maxSuffixLength)
+	}
+	if g.HostnameFormat == "" {
+		g.HostnameFormat = hostnameFormatRandom
+	} else if !slices.Contains(validHostnameFormats, g.HostnameFormat) {
+		fail("hostname_format %q is not one of %v", g.HostnameFormat, validHostnameFormats)
+	}
+	if g.MaxSize == 0 && len(g.FloatingIPs) > 0 {
+		g.MaxSize = min(defaultMaxSize, len(g.FloatingIPs))
+	} else if g.MaxSize == 0 {
 		g.MaxSize = defaultMaxSize
+	} else if g.MaxSize < 0 {
+		fail("max_size must not be negative")
+	}
+	if g.MinSize < 0 || g.MinSize > g.MaxSize {
+		fail("min_size must be between 0 and max_size")
+	}
+	if g.DefaultOS == "" {
+		g.DefaultOS = defaultOS
+	} else if !slices.Contains(validOS, g.DefaultOS) {
+		fail("default_os %q is not one of %v", g.DefaultOS, validOS)
+	}
+	planArch := planArch(g.Plan)
+	switch {
+	case g.DefaultArch == "" && planArch != "":
+		g.DefaultArch = planArch
+	case g.DefaultArch == "":
+		g.DefaultArch = defaultArch
+	case !slices.Contains(validArch, g.DefaultArch):
+		fail("default_arch %q is not one of %v", g.DefaultArch, validArch)
+	case planArch != "" && g.DefaultArch != planArch:
+		fail("default_arch %q does not match the %s plan %q", g.DefaultArch, planArch, g.Plan)
+	}
+	if arch := g.settings.ConnectorConfig.Arch; planArch != "" && arch != "" && arch != planArch {
+		fail("connector_config arch %q does not match the %s plan %q", arch, planArch, g.Plan)
+	}
+	if g.PreDeleteTimeout == 0 {
+		g.PreDeleteTimeout = Duration(defaultPreDeleteTimeout)
+	}
+	if g.ReadinessTimeout == 0 {
+		g.ReadinessTimeout = Duration(defaultReadinessTimeout)
+	}
+	if g.CreateRetries < 0 {
+		fail("create_retries must not be negative")
+	}
+	if g.CreateRetryBackoff == 0 {
+		g.CreateRetryBackoff = Duration(defaultCreateRetryBackoff)
+	} else if g.CreateRetryBackoff < 0 {
+		fail("create_retry_backoff must not be negative")
+	}
+	if err := g.parseLogLevels(); err != nil {
+		errs = append(errs, err)
+	}
+	if g.PprofAddress != "" {
+		if err := checkPprofAddress(g.PprofAddress); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if g.StatsDPrefix == "" {
+		g.StatsDPrefix = defaultStatsDPrefix
+	}
+	if len(g.StatsDTags) > 0 && !g.DogStatsD {
+		fail("statsd_tags requires dogstatsd")
+	}
+	if g.DogStatsD && g.StatsDAddress == "" {
+		fail("dogstatsd requires statsd_address")
+	}
+	if g.BreakerThreshold == 0 {
+		g.BreakerThreshold = defaultBreakerThreshold
+	} else if g.BreakerThreshold < 0 {
+		fail("breaker_threshold must not be negative")
+	}
+	if g.BreakerCooldown == 0 {
+		g.BreakerCooldown = Duration(defaultBreakerCooldown)
+	} else if g.BreakerCooldown < 0 {
+		fail("breaker_cooldown must not be negative")
+	}
+	if g.DeleteConcurrency == 0 {
+		g.DeleteConcurrency = defaultDeleteConcurrency
+	} else if g.DeleteConcurrency < 0 {
+		fail("delete_concurrency must not be negative")
+	}
+	if g.WebhookURL != "" {
+		if u, err := url.Parse(g.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("webhook_url %q must be an http(s) URL", g.WebhookURL)
+		}
+	}
+	if err := g.parseWebhookTemplate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := g.parseConnectNameTemplate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := g.parseScaleBlackout(); err != nil {
+		errs = append(errs, err)
+	} else if g.ScaleBlackoutTimezone != "" && len(g.ScaleBlackout) == 0 {
+		fail("scale_blackout_timezone requires scale_blackout")
+	}
+	if g.ConnectDNSTemplate != "" && g.ConnectReverseDNS {
+		fail("connect_dns_template and connect_reverse_dns are mutually exclusive")
+	}
+	if g.StaleInstanceTimeout < 0 {
+		fail("stale_instance_timeout must not be negative")
+	}
+	if g.ProvisioningTimeout < 0 {
+		fail("provisioning_timeout must not be negative")
+	}
+	if g.NICModel != "" && !slices.Contains(validNICModels, g.NICModel) {
+		fail("nic_model %q is not one of %v", g.NICModel, validNICModels)
+	}
+	if g.VideoModel != "" && !slices.Contains(validVideoModels, g.VideoModel) {
+		fail("video_model %q is not one of %v", g.VideoModel, validVideoModels)
+	}
+	if g.BootOrder != "" {
+		for _, dev := range strings.Split(g.BootOrder, ",") {
+			if !slices.Contains(validBootDevices, dev) {
+				fail("boot_order device %q is not one of %v", dev, validBootDevices)
+			}
+		}
+	}
+	if g.PrivateOnly {
+		if !g.UsePrivateNetwork && !g.UseUtilityNetwork {
+			fail("private_only requires use_private_network or use_utility_network")
+		}
+		if len(g.FloatingIPs) > 0 {
+			fail("floating_ips cannot be used with private_only")
+		}
+	}
+	if g.PrivateNetworkCIDR != "" {
+		if prefix, err := netip.ParsePrefix(g.PrivateNetworkCIDR); err != nil || !prefix.Addr().Is4() {
+			fail("private_network_cidr %q is not an IPv4 CIDR", g.PrivateNetworkCIDR)
+		}
+		if !g.UsePrivateNetwork {
+			fail("private_network_cidr requires use_private_network")
+		}
+		if g.PrivateNetwork != "" {
+			fail("private_network and private_network_cidr are mutually exclusive")
+		}
+	} else if g.PrivateNetworkName != "" {
+		fail("private_network_name requires private_network_cidr")
+	}
+	for i, kind := range g.InterfaceOrder {
+		if !slices.Contains(defaultInterfaceOrder, kind) {
+			fail("interface_order[%d] %q is not one of %v", i, kind, defaultInterfaceOrder)
+		} else if slices.Index(g.InterfaceOrder, kind) != i {
+			fail("interface_order lists %q more than once", kind)
+		}
+	}
+	if g.PublicIPFamily == "" {
+		g.PublicIPFamily = publicIPFamilyIPv4
+	} else if !slices.Contains(validPublicIPFamilies, g.PublicIPFamily) {
+		fail("public_ip_family %q is not one of %v", g.PublicIPFamily, validPublicIPFamilies)
+	}
+	if g.PublicIPFamily == publicIPFamilyIPv6 && len(g.FloatingIPs) > 0 {
+		fail("floating_ips cannot be used with public_ip_family = %q", publicIPFamilyIPv6)
+	}
+	if g.PreferAddress != "" && !slices.Contains(validPreferAddresses, g.PreferAddress) {
+		fail("prefer_address %q is not one of %v", g.PreferAddress, validPreferAddresses)
+	}
+	if g.PrivateIPRange != "" {
+		if _, _, err := parseIPRange(g.PrivateIPRange); err != nil {
+			fail("private_ip_range: %w", err)
+		}
+		if !g.UsePrivateNetwork || (g.PrivateNetwork == "" && g.PrivateNetworkCIDR == "" && len(g.PrivateNetworks) == 0) {
+			fail("private_ip_range requires use_private_network and a private network")
+		}
+	}
+	if g.PrivateMTU != 0 {
+		if g.PrivateMTU < minPrivateMTU || g.PrivateMTU > maxPrivateMTU {
+			fail("private_mtu must be between %d and %d", minPrivateMTU, maxPrivateMTU)
+		}
+		if !g.UsePrivateNetwork {
+			fail("private_mtu requires use_private_network")
+		}
+	}
+	if len(g.PrivateNetworks) > 0 && !g.UsePrivateNetwork {
+		fail("private_networks requires use_private_network")
+	}
+	for i, n := range g.PrivateNetworks {
+		if n == "" {
+			fail("private_networks[%d] is empty", i)
+		}
+	}
+	if g.NATGateway != "" {
+		if !slices.Contains(validNATGatewayModes, g.NATGateway) {
+			fail("nat_gateway %q is not one of %v", g.NATGateway, validNATGatewayModes)
+		}
+		if !g.UsePrivateNetwork || (g.PrivateNetwork == "" && g.PrivateNetworkCIDR == "" && len(g.PrivateNetworks) == 0) {
+			fail("nat_gateway requires use_private_network and a private network")
+		}
+		// Only private-only groups get the network's DHCP default route, so
+		// elsewhere the gateway would never carry their traffic.
+		if !g.PrivateOnly {
+			fail("nat_gateway requires private_only: instances with a public interface reach the internet through it")
+		}
+	}
+	if g.UserDataSHA256 != "" {
+		if !sha256Pattern.MatchString(g.UserDataSHA256) {
+			fail("user_data_sha256 must be 64 hexadecimal characters")
+		}
+		g.FetchUserData = true
+	}
+	if g.FetchUserData && !isUserDataURL(g.UserData) {
+		fail("fetch_user_data and user_data_sha256 require user_data to be an http(s) URL")
+	}
+	if g.TemplateUserData && !g.FetchUserData {
+		if _, err := parseUserDataTemplate(g.UserData, nil); err != nil {
+			fail("user_data: %w", err)
+		}
+	} else if !g.FetchUserData {
+		if err := checkUserData(g.UserData); err != nil {
+			fail("user_data: %w", err)
+		}
+	}
+	if g.SecretsDir != "" && !g.TemplateUserData {
+		fail("secrets_dir requires template_user_data")
+	}
+	if g.KeyPassphrase != "" && g.KeyPassphraseFile != "" {
+		fail("key_passphrase and key_passphrase_file are mutually exclusive")
+	}
+	if g.BastionAddress == "" && (g.BastionUser != "" || g.BastionKeyFile != "" || g.BastionHostKey != "") {
+		fail("bastion_user, bastion_key_file and bastion_host_key require bastion_address")
+	}
+	for i, key := range g.ExtraSSHKeys {
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key)); err != nil {
+			fail("extra_ssh_keys[%d]: %w", i, err)
+		}
+	}
+	for _, ip := range g.FloatingIPs {
+		if net.ParseIP(ip) == nil {
+			fail("floating_ips: %q is not a valid IP address", ip)
+		}
+	}
+	// Every instance needs its own floating IP, so the pool caps the group
+	// size; unset, max_size defaults to the pool size.
+	if len(g.FloatingIPs) > 0 && g.MaxSize > len(g.FloatingIPs) {
+		fail("max_size %d exceeds the %d addresses in floating_ips", g.MaxSize, len(g.FloatingIPs))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid plugin config: %w", errors.Join(errs...))
 	}
 	return nil
 }
 
 // newClient creates an authenticated UpCloud API client.
 // Uses bearer token auth if Token is set, otherwise Basic Auth.
+// Requests identify the plugin version in their User-Agent.
 func (g *InstanceGroup) newClient() *client.Client {
+	var transport http.RoundTripper = client.NewDefaultHTTPTransport()
+	if g.DebugAPI {
+		transport = &apiLogTransport{next: transport, log: g.logger(logAPI)}
+	}
+	transport = &breakerTransport{
+		next:      transport,
+		log:       g.logger(logAPI).Named("breaker"),
+		threshold: g.BreakerThreshold,
+		cooldown:  time.Duration(g.BreakerCooldown),
+		now:       time.Now,
+	}
+	opts := []client.ConfigFn{
+		client.WithHTTPClient(&http.Client{Transport: &correlationTransport{next: transport}}),
+		client.WithTimeout(30 * time.Second),
+	}
+
+	var c *client.Client
 	if g.Token != "" {
-		return client.New("", "", client.WithBearerAuth(g.Token), client.WithTimeout(30*time.Second))
+		c = client.New("", "", append(opts, client.WithBearerAuth(g.Token))...)
+	} else {
+		c = client.New(g.Username, g.Password, opts...)
 	}
-	return client.New(g.Username, g.Password, client.WithTimeout(30*time.Second))
+	c.UserAgent = userAgent(c.UserAgent)
+	return c
+}
+
+// userAgent prefixes the SDK's User-Agent with the plugin name and version,
+// e.g. "fleeting-plugin-upcloud/v1.2.3 upcloud-go-api/8.34.3", so UpCloud and
+// egress logs can attribute API traffic to the plugin release.
+func userAgent(sdk string) string {
+	return strings.TrimSpace(fmt.Sprintf("%s/%s %s", Version.Name, Version.Version, sdk))
 }
 
 // Init is called once at startup. It validates config, derives the SSH public key,
 // creates the UpCloud client, and validates credentials.
-func (g *InstanceGroup) Init(ctx context.Context, log hclog.Logger, settings provider.Settings) (provider.ProviderInfo, error) {
+func (g *InstanceGroup) Init(ctx context.Context, log hclog.Logger, settings provider.Settings) (_ provider.ProviderInfo, err error) {
+	defer redactError(&err)
+	account, err := g.initCore(ctx, log, settings)
+	if err != nil {
+		return provider.ProviderInfo{}, err
+	}
+	log = g.log
+
+	if err := g.initMetrics(); err != nil {
+		return provider.ProviderInfo{}, err
+	}
+	if err := g.startPprof(); err != nil {
+		return provider.ProviderInfo{}, err
+	}
+	g.watchDumpSignal()
+
+	if g.store, err = loadStateStore(g.StateFile); err != nil {
+		return provider.ProviderInfo{}, err
+	}
+	if err := g.store.compactHistory(); err != nil {
+		log.Warn("failed to compact instance history", "error", err)
+	}
+
+	if n, err := g.adoptServers(ctx); err != nil {
+		log.Warn("failed to adopt existing servers", "error", err)
+	} else if n > 0 {
+		log.Info("adopted existing servers", "count", n, "prefix", g.AdoptByPrefix)
+	}
+
+	if err := g.resumeDeletions(ctx); err != nil {
+		log.Warn("failed to resume interrupted deletions", "error", err)
+	}
+	if err := g.recoverPending(ctx); err != nil {
+		log.Warn("failed to recover pending operations", "error", err)
+	}
+	if err := g.resumeGrace(ctx); err != nil {
+		log.Warn("failed to resume grace periods of stopped servers", "error", err)
+	}
+	if g.KeepFailedInstances {
+		if err := g.resumeKept(ctx); err != nil {
+			log.Warn("failed to find failed servers kept for debugging", "error", err)
+		}
+	}
+
+	g.initUsage()
+
+	if g.Metadata != nil && !*g.Metadata && g.hasUserData() {
+		log.Warn("metadata service is disabled; cloud-init based templates will not receive user_data")
+	}
+
+	log.Info("initialized", "account", account.UserName, "zone", g.Zone, "group", g.Name, "plan", g.Plan, "template", g.template.Title)
+
+	return provider.ProviderInfo{
+		// The account distinguishes groups with the same zone and name
+		// managed under different UpCloud accounts.
+		ID:        fmt.Sprintf("upcloud/%s/%s/%s", account.UserName, g.Zone, g.Name),
+		MaxSize:   g.MaxSize,
+		Version:   Version.Version,
+		BuildInfo: fmt.Sprintf("%s@%s built %s", Version.Name, Version.Revision, Version.BuiltAt),
+	}, nil
+}
+
+// initCore sets up what creating and removing servers needs: the validated
+// config, SSH key, API client, template and user data. Unlike Init it starts
+// no listeners or handlers and leaves the state file alone, so the scale
+// command can use it next to a running plugin.
+func (g *InstanceGroup) initCore(ctx context.Context, log hclog.Logger, settings provider.Settings) (*upcloud.Account, error) {
 	g.log = log
 	g.settings = settings
 
 	if err := g.validate(); err != nil {
-		return provider.ProviderInfo{}, err
+		return nil, err
 	}
+	g.registerSecrets()
+	g.log = withLevel(&redactingLogger{Logger: log}, g.logLevel)
+	log = g.log
 
 	// Derive SSH public key from the private key provided via connector_config.key_path
 	if len(settings.ConnectorConfig.Key) > 0 {
-		signer, err := ssh.ParsePrivateKey(settings.ConnectorConfig.Key)
+		passphrase, err := g.keyPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		signer, decrypted, err := parsePrivateKey(settings.ConnectorConfig.Key, passphrase)
 		if err != nil {
-			return provider.ProviderInfo{}, fmt.Errorf("parsing SSH private key from connector_config: %w", err)
+			return nil, fmt.Errorf("parsing SSH private key from connector_config: %w", err)
 		}
 		g.publicKey = string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
-	} else {
+		g.connectorKey = decrypted
+	} else if !g.EphemeralSSHKeys {
 		log.Warn("no SSH key configured in connector_config.key_path; instances will be created without SSH key injection")
 	}
+	if err := g.initBastion(); err != nil {
+		return nil, err
+	}
+	var err error
+	if g.managerHostname, err = os.Hostname(); err != nil {
+		log.Warn("failed to determine runner manager hostname", "error", err)
+	}
+	if g.configHash, err = g.hashConfig(); err != nil {
+		return nil, fmt.Errorf("hashing plugin config: %w", err)
+	}
 
 	g.svc = newUpcloudService(g.newClient())
 
 	// Validate credentials
-	if _, err := g.svc.GetAccount(ctx); err != nil {
-		return provider.ProviderInfo{}, fmt.Errorf("authenticating with UpCloud API: %w", err)
+	account, err := g.svc.GetAccount(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("authenticating with UpCloud API: %w", err)
 	}
 
-	log.Info("initialized", "zone", g.Zone, "group", g.Name, "plan", g.Plan)
+	if g.checksCredits() {
+		g.recordCredits(account)
+	}
 
-	return provider.ProviderInfo{
-		ID:        fmt.Sprintf("upcloud/%s/%s", g.Zone, g.Name),
-		MaxSize:   g.MaxSize,
-		Version:   Version.Version,
-		BuildInfo: fmt.Sprintf("%s@%s built %s", Version.Name, Version.Revision, Version.BuiltAt),
-	}, nil
+	if err := g.checkZone(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.checkPlan(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.checkDedicatedHost(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.ensurePrivateNetwork(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.ensureNATGateway(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.selectTemplate(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.checkZoneTemplates(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.checkTemplate(ctx); err != nil {
+		return nil, err
+	}
+	g.refreshTemplate(ctx)
+
+	// Fetched user data is only checked once it is downloaded at create time.
+	if !g.FetchUserData {
+		if _, err := g.userData(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.checkAuditLog(); err != nil {
+		return nil, err
+	}
+
+	return account, nil
 }
 
 // Update polls UpCloud for the current state of all instances in this group,
 // calling fn for each discovered instance.
-func (g *InstanceGroup) Update(ctx context.Context, fn func(instance string, state provider.State)) error {
+func (g *InstanceGroup) Update(ctx context.Context, fn func(instance string, state provider.State)) (err error) {
+	defer redactError(&err)
+	defer g.observe(opUpdate, time.Now(), &err)
+	listedAt := time.Now()
 	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
-		Filters: []request.QueryFilter{
-			request.FilterLabel{Label: upcloud.Label{Key: groupLabelKey, Value: g.Name}},
-		},
+		Filters: g.groupFilters(),
 	})
 	if err != nil {
 		return fmt.Errorf("listing group servers: %w", err)
 	}
+	excluded, err := g.excludedServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	g.trackUsage(servers.Servers)
 
+	counts := map[provider.State]int{}
+	listed := make(map[string]bool, len(servers.Servers))
 	for _, s := range servers.Servers {
-		fn(s.UUID, mapServerState(s.State))
+		listed[s.UUID] = true
+		if excluded[s.UUID] || g.isKept(s.UUID) {
+			continue
+		}
+		// Held servers were already removed as far as the runner knows.
+		if deleteAt, ok := g.graceDeadline(s.UUID); ok {
+			if !time.Now().Before(deleteAt) {
+				g.deleteInBackground(s.UUID)
+			}
+			continue
+		}
+		g.refreshServerCache(s)
+		state := mapServerState(s.State)
+		switch {
+		case g.isDeleting(s.UUID):
+			state = provider.StateDeleting
+		case s.State == upcloud.ServerStateError && g.DeleteErrorServers:
+			g.removeErrorServer(s.UUID)
+			state = provider.StateDeleting
+		case state == provider.StateRunning:
+			g.markRunning(s.UUID)
+			if g.StaleInstanceTimeout > 0 || g.ProvisioningTimeout > 0 {
+				g.labelRunning(ctx, s.UUID)
+			}
+			if g.checksReadiness() {
+				state = g.readinessState(s.UUID)
+			}
+		case state == provider.StateCreating && (g.StaleInstanceTimeout > 0 || g.ProvisioningTimeout > 0):
+			state = g.checkStale(ctx, s.UUID, state)
+		}
+		fn(s.UUID, state)
+		counts[state]++
 	}
+	g.pruneKept(listed)
+	g.reconcile(servers.Servers, func(uuid string) bool {
+		_, held := g.graceDeadline(uuid)
+		return excluded[uuid] || g.isKept(uuid) || held
+	}, listedAt)
+	g.maybeCollectStorages()
+	g.maybeReportUsage()
+	g.maybeCheckCredits()
+	g.maybeCheckMaintenance()
+	g.maybeReplenish(counts[provider.StateCreating] + counts[provider.StateRunning] + g.pendingCreates(listed, listedAt))
+	g.recordUpdate(counts)
 
 	return nil
 }
@@ -179,119 +1262,404 @@ func mapServerState(s string) provider.State {
 }
 
 // Increase creates n new UpCloud servers in this group.
-// It returns the number of servers successfully requested.
+// It returns the number of servers successfully requested, and stops early
+// with a *createAbortedError on authentication or quota failures. If every
+// creation fails, the joined failures are returned as the error.
 func (g *InstanceGroup) Increase(ctx context.Context, n int) (int, error) {
+	g.expectCreates(n)
+	return g.increase(ctx, n)
+}
+
+// increase creates n servers registered with expectCreates. Calls are
+// serialized, so concurrent creations never share template state or pick
+// the same floating or private IP.
+func (g *InstanceGroup) increase(ctx context.Context, n int) (created int, err error) {
+	defer redactError(&err)
+	defer g.observe(opIncrease, time.Now(), &err, "requested", n)
+	log := g.logger(logScaling)
+	if n <= 0 {
+		return 0, nil
+	}
+	defer func() { g.settleCreates(n - created) }()
+	g.createMu.Lock()
+	defer g.createMu.Unlock()
+	if expr, ok := g.blackoutAt(time.Now()); ok {
+		log.Info("not creating servers during a scale_blackout window", "requested", n, "window", expr)
+		return 0, nil
+	}
+	if p, paused := g.allZonesPaused(); paused {
+		log.Warn("not creating servers while the zone is under maintenance",
+			"requested", n, "zone", g.Zone, "until", p.until.Format(time.RFC3339), "reason", p.reason)
+		return 0, nil
+	}
+	if err := g.creditsBelowFloor(); err != nil {
+		log.Error("cannot create servers", "error", err)
+		return 0, err
+	}
+	g.refreshTemplate(ctx)
+	if err := g.selectTemplate(ctx); err != nil {
+		log.Warn("failed to select template; keeping the current one", "template", g.templateUUID(), "error", err)
+	}
+
+	userData, err := g.userData(ctx)
+	if err != nil {
+		log.Error("cannot create servers", "error", err)
+		return 0, err
+	}
+
+	var takenIPs map[netip.Addr]bool
+	if g.PrivateIPRange != "" {
+		if takenIPs, err = g.takenPrivateIPs(ctx); err != nil {
+			log.Error("cannot create servers", "error", err)
+			return 0, err
+		}
+	}
+
 	succeeded := 0
+	var failures []error
+	taken := g.takenHostnames(ctx)
 	for i := 0; i < n; i++ {
-		hostname := fmt.Sprintf("%s-%s", g.NamePrefix, randomSuffix(8))
+		now := time.Now()
+		hostname, err := g.newHostname(taken, now)
+		if err != nil {
+			log.Error("cannot create server", "error", err)
+			failures = append(failures, err)
+			continue
+		}
+		ilog := withInstance(log, "", hostname)
 
 		storageDevices := request.CreateServerStorageDeviceSlice{
 			{
 				Action:  request.CreateServerStorageDeviceActionClone,
-				Storage: g.Template,
+				Storage: g.templateUUID(),
 				Title:   "disk1",
-				Size:    g.StorageSize,
+				Size:    g.rootStorageSize(),
 				Tier:    g.StorageTier, // empty = inherit tier from template
 			},
 		}
 
-		networking := &request.CreateServerNetworking{
-			Interfaces: request.CreateServerInterfaceSlice{
-				{
-					IPAddresses: request.CreateServerIPAddressSlice{
-						{Family: upcloud.IPAddressFamilyIPv4},
-					},
-					Type: upcloud.NetworkTypePublic,
-				},
-			},
-		}
-
-		if g.UsePrivateNetwork {
-			networking.Interfaces = append(networking.Interfaces, request.CreateServerInterface{
-				IPAddresses: request.CreateServerIPAddressSlice{
-					{Family: upcloud.IPAddressFamilyIPv4},
-				},
-				Type: upcloud.NetworkTypePrivate,
-			})
-		}
-
 		createReq := &request.CreateServerRequest{
 			Hostname: hostname,
 			Title:    fmt.Sprintf("fleeting-plugin-upcloud - %s", hostname),
 			Plan:     g.Plan,
 			Zone:     g.Zone,
-			Metadata: upcloud.True,
-			Labels: &upcloud.LabelSlice{
-				{Key: groupLabelKey, Value: g.Name},
-			},
-			StorageDevices: storageDevices,
-			Networking:     networking,
+			Host:     g.DedicatedHost,
+			Metadata: upcloud.FromBool(g.Metadata == nil || *g.Metadata),
+			// Always sent explicitly so throwaway CI VMs never expose a console
+			// unless asked for.
+			RemoteAccessEnabled: upcloud.FromBool(g.RemoteAccess),
+			TimeZone:            g.Timezone,
+			NICModel:            g.NICModel,
+			VideoModel:          g.VideoModel,
+			BootOrder:           g.BootOrder,
+			Labels:              g.serverLabels(now),
+			StorageDevices:      storageDevices,
+			Networking:          g.networking(),
+		}
+
+		var privateIP netip.Addr
+		if takenIPs != nil {
+			if privateIP, err = g.allocatePrivateIP(takenIPs); err != nil {
+				ilog.Error("cannot create server", "error", err)
+				failures = append(failures, err)
+				break
+			}
+			g.assignPrivateIP(createReq, privateIP)
+		}
+
+		var instanceKey []byte
+		sshKeys := request.SSHKeySlice{}
+		if g.EphemeralSSHKeys {
+			pub, priv, err := generateSSHKeyPair()
+			if err != nil {
+				ilog.Error("failed to generate SSH key pair", "error", err)
+				failures = append(failures, fmt.Errorf("%s: generating SSH key pair: %w", hostname, err))
+				continue
+			}
+			instanceKey = priv
+			sshKeys = append(sshKeys, pub)
+		} else if g.publicKey != "" {
+			sshKeys = append(sshKeys, g.publicKey)
 		}
+		sshKeys = append(sshKeys, g.ExtraSSHKeys...)
 
-		if g.publicKey != "" {
+		if len(sshKeys) > 0 {
 			createReq.LoginUser = &request.LoginUser{
 				Username: g.settings.ConnectorConfig.Username,
-				SSHKeys:  request.SSHKeySlice{g.publicKey},
+				SSHKeys:  sshKeys,
 			}
 		}
 
-		if g.UserData != "" {
-			createReq.UserData = g.UserData
+		if userData != "" {
+			createReq.UserData = userData
 		}
 
-		_, err := g.svc.CreateServer(ctx, createReq)
+		var floatingIP string
+		if len(g.FloatingIPs) > 0 {
+			ip, err := g.freeFloatingIP(ctx)
+			if err != nil {
+				// Without a pool address the instance would be unreachable through
+				// allow-listing firewalls, so stop creating until one frees up.
+				ilog.Error("cannot create server", "error", err)
+				failures = append(failures, err)
+				break
+			}
+			floatingIP = ip
+		}
+
+		g.track(hostname, pendingOp{Op: pendingCreate, Hostname: hostname, Started: now})
+		details, err := g.createInZones(ctx, createReq)
 		if err != nil {
-			g.log.Error("failed to create server", "hostname", hostname, "error", err)
+			ilog.Error("failed to create server", "error", err)
+			g.notify(eventInstanceFailed, "", hostname, err)
+			g.audit(auditCreate, "", hostname, createReq.Zone, err)
+			g.untrack(hostname)
+			if class := permanentFailure(err); class != "" {
+				return succeeded, &createAbortedError{Class: class, Err: err}
+			}
+			failures = append(failures, fmt.Errorf("%s: %w", hostname, err))
+			if _, paused := g.allZonesPaused(); paused {
+				break
+			}
 			continue
 		}
 
-		g.log.Info("created server", "hostname", hostname)
+		ilog = ilog.With("uuid", details.UUID)
+		g.observeInstance("create_request", details.UUID, time.Since(now))
+		if privateIP.IsValid() {
+			g.recordPrivateIPs(details.UUID, privateIP)
+		}
+		if g.OrphanedStorageGrace > 0 || g.CostCenter != "" {
+			g.labelStorages(ctx, ilog, details)
+		}
+		g.usageStart(details.UUID, details.Plan, true)
+		g.recordInstance(details, now)
+
+		if floatingIP != "" {
+			if err := g.attachFloatingIP(ctx, floatingIP, details); err != nil {
+				// Services allow-listing the pool would refuse the instance, so it
+				// is removed and counted as a failed creation.
+				ilog.Error("failed to attach floating IP; removing server", "ip", floatingIP, "error", err)
+				g.notify(eventInstanceFailed, details.UUID, hostname, err)
+				g.audit(auditCreate, details.UUID, hostname, createReq.Zone, err)
+				g.untrack(hostname)
+				g.deleteInBackground(details.UUID)
+				failures = append(failures, fmt.Errorf("%s: %w", hostname, err))
+				continue
+			}
+			ilog.Info("attached floating IP", "ip", floatingIP)
+		}
+
+		if instanceKey != nil {
+			g.storeInstanceKey(details.UUID, instanceKey)
+		}
+		g.recordCreated(details.UUID, now)
+		g.own(details.UUID)
+
+		g.untrack(hostname)
+		ilog.Info("created server")
+		g.notify(eventInstanceCreated, details.UUID, hostname, nil)
+		g.audit(auditCreate, details.UUID, hostname, createReq.Zone, nil)
 		succeeded++
 	}
 
+	// Partial success is reported through the count alone, but when nothing
+	// could be created the runner must be able to tell the provider is broken.
+	if succeeded == 0 && len(failures) > 0 {
+		return 0, fmt.Errorf("all %d server creations failed: %w", n, errors.Join(failures...))
+	}
 	return succeeded, nil
 }
 
 // Decrease stops and deletes the specified instances in parallel.
 // It returns the UUIDs of instances that were successfully removed.
-func (g *InstanceGroup) Decrease(ctx context.Context, instances []string) ([]string, error) {
+func (g *InstanceGroup) Decrease(ctx context.Context, instances []string) (_ []string, err error) {
+	defer redactError(&err)
+	defer g.observe(opDecrease, time.Now(), &err, "requested", len(instances))
+	log := g.logger(logScaling)
 	var (
 		mu        sync.Mutex
 		succeeded []string
-		firstErr  error
-		wg        sync.WaitGroup
+		eg        errgroup.Group
 	)
 
-	for _, id := range instances {
-		wg.Add(1)
-		go func(uuid string) {
-			defer wg.Done()
-			if err := g.stopAndDelete(ctx, uuid); err != nil {
-				g.log.Error("failed to remove instance", "uuid", uuid, "error", err)
-				mu.Lock()
-				if firstErr == nil {
-					firstErr = err
+	// The runner retries held removals, and they go through once warm
+	// capacity is above MinSize again.
+	instances, held := g.holdForMinSize(instances)
+	var heldErrs []error
+	for _, uuid := range held {
+		withInstance(log, uuid, "").Info("keeping instance to stay at min_size", "min_size", g.MinSize)
+		heldErrs = append(heldErrs, fmt.Errorf("removing server %s: %w", uuid, errMinSize))
+	}
+
+	// A plain Group rather than WithContext: one failed removal must not
+	// abort the others half-way through.
+	eg.SetLimit(max(g.DeleteConcurrency, 1))
+	for _, uuid := range instances {
+		ilog := withInstance(log, uuid, "")
+		eg.Go(func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("removing server %s: panic: %v", uuid, r)
+					ilog.Error("panic while removing instance", "panic", r, "stack", string(debug.Stack()))
+					g.setDeleting(uuid, false)
+				}
+				if err != nil {
+					g.notify(eventInstanceFailed, uuid, "", err)
 				}
-				mu.Unlock()
-				return
+			}()
+
+			if err := ctx.Err(); err != nil {
+				g.setDeleting(uuid, false)
+				return fmt.Errorf("removing server %s: %w", uuid, err)
+			}
+			if err := g.stopAndDelete(ctx, uuid); err != nil {
+				ilog.Error("failed to remove instance", "error", err)
+				return err
 			}
+
 			mu.Lock()
 			succeeded = append(succeeded, uuid)
 			mu.Unlock()
-		}(id)
+			return nil
+		})
 	}
 
-	wg.Wait()
-	return succeeded, firstErr
+	err = errors.Join(append(heldErrs, eg.Wait())...)
+	return succeeded, err
 }
 
-// stopAndDelete hard-stops a server, waits for it to reach the stopped state,
-// then deletes it along with all its storage devices.
-func (g *InstanceGroup) stopAndDelete(ctx context.Context, uuid string) error {
+// stopAndDelete labels a server as deletion-pending, hard-stops it, waits for
+// it to reach the stopped state, then deletes it along with all its storage devices.
+func (g *InstanceGroup) stopAndDelete(ctx context.Context, uuid string) (err error) {
+	log := withInstance(g.logger(logScaling), uuid, "")
+	start := time.Now()
+	g.setDeleting(uuid, true)
+	// A server that survives a failed removal stays desired; one kept or held
+	// for its grace period is gone for the runner all the same.
+	defer func() {
+		if err != nil {
+			g.setDeleting(uuid, false)
+		} else {
+			g.disown(uuid)
+		}
+	}()
+
+	// Never trust the UUID alone: a mix-up between runner managers must not
+	// remove somebody else's server.
+	details, err := g.deletableServer(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	hostname := details.Hostname
+	log = log.With("hostname", hostname)
+
+	if g.isKept(uuid) {
+		g.setDeleting(uuid, false)
+		return nil
+	}
+	deleteAt, held := g.graceDeadline(uuid)
+	if !held {
+		g.captureDiagnostics(ctx, log, uuid, details)
+		if reason, failed := g.unhealthyReason(uuid); failed && g.keepFailed(ctx, log, uuid, reason, details) {
+			g.setDeleting(uuid, false)
+			g.forgetReadiness(uuid)
+			return nil
+		}
+	}
+	if held && time.Now().Before(deleteAt) {
+		g.setDeleting(uuid, false)
+		return nil
+	}
+	if !held && g.DeletionGracePeriod > 0 {
+		g.runPreDeleteCommand(ctx, log, uuid)
+		if err := g.holdForGrace(ctx, log, uuid, details); err != nil {
+			return err
+		}
+		g.setDeleting(uuid, false)
+		return nil
+	}
+
+	if err := g.labelDeleting(ctx, details); err != nil {
+		// The label only helps observers and crash recovery; removal goes ahead.
+		log.Warn("failed to label server for deletion", "error", err)
+	}
+	g.track(uuid, pendingOp{Op: pendingDelete, UUID: uuid, Hostname: hostname, Started: time.Now()})
+
+	// Servers held for inspection already ran it before they were stopped.
+	if !held {
+		g.runPreDeleteCommand(ctx, log, uuid)
+	}
+
+	// A server in the error state cannot be stopped, only deleted.
+	if details.State != upcloud.ServerStateError && details.State != upcloud.ServerStateStopped {
+		if err := g.stopServer(ctx, uuid, hostname, details.Zone); err != nil {
+			return err
+		}
+	}
+
+	if len(g.FloatingIPs) > 0 {
+		if err := g.detachFloatingIPs(ctx, uuid); err != nil {
+			// Not fatal: the address can still be reclaimed manually, and leaving
+			// the server behind would be worse than a stuck pool entry.
+			log.Warn("failed to detach floating IPs", "error", err)
+		}
+	}
+
+	if g.PreserveStorages {
+		err = g.deleteServerKeepStorages(ctx, log, uuid, details)
+	} else {
+		err = g.svc.DeleteServerAndStorages(ctx, &request.DeleteServerAndStoragesRequest{
+			UUID:    uuid,
+			Backups: g.backupsMode(),
+		})
+	}
+	g.audit(auditDelete, uuid, hostname, details.Zone, err)
+	if err != nil {
+		return fmt.Errorf("deleting server %s: %w", uuid, err)
+	}
+
+	// Before forgetServer clears the deleting mark, so reconcile never sees
+	// the server as vanished.
+	g.disown(uuid)
+	g.forgetInstanceKey(uuid)
+	g.forgetServer(uuid)
+	g.usageStop(uuid)
+	g.recordDeleted(uuid)
+	g.forgetReadiness(uuid)
+	if g.bastion != nil {
+		g.bastion.close(uuid)
+	}
+	g.untrack(uuid)
+
+	g.observeInstance("delete", uuid, time.Since(start))
+	log.Info("removed instance", "duration", time.Since(start).Round(time.Millisecond))
+	g.notify(eventInstanceDeleted, uuid, hostname, nil)
+	return nil
+}
+
+// runPreDeleteCommand runs PreDeleteCommand on an instance, if set. Failures
+// are logged; they never keep a server from being removed.
+func (g *InstanceGroup) runPreDeleteCommand(ctx context.Context, log hclog.Logger, uuid string) {
+	if g.PreDeleteCommand == "" {
+		return
+	}
+	out, err := g.runOnInstance(ctx, uuid, g.PreDeleteCommand, time.Duration(g.PreDeleteTimeout))
+	if err != nil {
+		log.Warn("pre-delete command failed", "error", err, "output", string(out))
+	} else {
+		log.Info("pre-delete command finished")
+	}
+}
+
+// stopServer hard-stops a server in zone and waits for it to reach the
+// stopped state.
+func (g *InstanceGroup) stopServer(ctx context.Context, uuid, hostname, zone string) error {
 	_, err := g.svc.StopServer(ctx, &request.StopServerRequest{
 		UUID:     uuid,
 		StopType: request.ServerStopTypeHard,
 	})
+	g.audit(auditStop, uuid, hostname, zone, err)
 	if err != nil {
 		return fmt.Errorf("stopping server %s: %w", uuid, err)
 	}
@@ -303,86 +1671,172 @@ func (g *InstanceGroup) stopAndDelete(ctx context.Context, uuid string) error {
 	if err != nil {
 		return fmt.Errorf("waiting for server %s to stop: %w", uuid, err)
 	}
+	return nil
+}
+
+// ConnectInfo returns connection details for a specific instance.
+func (g *InstanceGroup) ConnectInfo(ctx context.Context, id string) (_ provider.ConnectInfo, err error) {
+	defer redactError(&err)
+	defer g.observe(opConnectInfo, time.Now(), &err, "uuid", id)
+	info, ok := g.cachedConnectInfo(id)
+	if !ok {
+		if info, err = g.connectInfo(ctx, id); err != nil {
+			return info, err
+		}
+	}
 
-	if err := g.svc.DeleteServerAndStorages(ctx, &request.DeleteServerAndStoragesRequest{
-		UUID: uuid,
-	}); err != nil {
-		return fmt.Errorf("deleting server %s: %w", uuid, err)
+	if g.bastion != nil {
+		if err := g.routeThroughBastion(&info); err != nil {
+			return info, err
+		}
 	}
 
-	g.log.Info("removed instance", "uuid", uuid)
-	return nil
+	return info, nil
 }
 
-// ConnectInfo returns connection details for a specific instance.
-func (g *InstanceGroup) ConnectInfo(ctx context.Context, id string) (provider.ConnectInfo, error) {
+// connectInfo builds the connection details of an instance as the runner
+// would dial it directly; ConnectInfo routes them through the bastion.
+func (g *InstanceGroup) connectInfo(ctx context.Context, id string) (provider.ConnectInfo, error) {
 	// Start with defaults from runner's connector_config (includes key, username, protocol, etc.)
 	info := provider.ConnectInfo{ConnectorConfig: g.settings.ConnectorConfig}
 	info.ID = id
 
-	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: id})
+	details, err := g.serverDetails(ctx, id)
 	if err != nil {
 		return info, fmt.Errorf("getting server details for %s: %w", id, err)
 	}
+	if err := g.checkMember(id, details); err != nil {
+		return info, err
+	}
+
+	if g.EphemeralSSHKeys {
+		key, ok := g.instanceKey(id)
+		if !ok {
+			// Keys are not persisted, so instances created before a plugin
+			// restart cannot be reached and have to be replaced.
+			return info, fmt.Errorf("no ephemeral SSH key known for server %s", id)
+		}
+		info.Key = key
+	} else if g.connectorKey != nil {
+		info.Key = g.connectorKey
+	}
 
 	// Apply defaults only if not already set by the runner's connector_config
 	if info.OS == "" {
-		info.OS = "linux"
+		info.OS = g.DefaultOS
 	}
 	if info.Arch == "" {
-		info.Arch = "amd64"
+		info.Arch = g.arch()
 	}
 	if info.Protocol == "" {
 		info.Protocol = provider.ProtocolSSH
 	}
 
-	// Extract IPv4 addresses
-	for _, ip := range details.IPAddresses {
-		if ip.Family != upcloud.IPAddressFamilyIPv4 {
-			continue
-		}
-		switch ip.Access {
-		case upcloud.IPAddressAccessPublic:
-			info.ExternalAddr = ip.Address
-		case upcloud.IPAddressAccessPrivate:
-			info.InternalAddr = ip.Address
+	info.ExternalAddr, info.InternalAddr = g.connectAddresses(details)
+	if g.bastion == nil {
+		// A bastion rewrites the address to a local forward; names only
+		// apply when the runner dials the instance directly.
+		if info.ExternalAddr, err = g.connectName(id, details, info.ExternalAddr); err != nil {
+			return info, err
 		}
 	}
 
-	if g.UsePrivateNetwork && info.InternalAddr != "" {
-		info.ExternalAddr = info.InternalAddr
-	}
-
+	g.cacheConnectInfo(details, info)
 	return info, nil
 }
 
 // Heartbeat checks whether a specific instance is still healthy.
-func (g *InstanceGroup) Heartbeat(ctx context.Context, id string) error {
-	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: id})
+func (g *InstanceGroup) Heartbeat(ctx context.Context, id string) (err error) {
+	defer redactError(&err)
+	if r, ok := g.cachedHeartbeat(id); ok {
+		return r.err
+	}
+	defer g.cacheHeartbeat(id, &err)
+	log := withInstance(g.logger(logHeartbeat), id, "")
+	details, err := g.serverDetails(ctx, id)
 	if err != nil {
 		// Treat transient API errors as healthy to avoid premature instance replacement
-		g.log.Warn("heartbeat API error (treating as healthy)", "uuid", id, "error", err)
+		log.Warn("heartbeat API error (treating as healthy)", "error", err)
+		return nil
+	}
+	// A foreign server is never healthy from this group's point of view.
+	if err := g.checkMember(id, details); err != nil {
+		return err
+	}
+
+	healthy := true
+	switch details.State {
+	case upcloud.ServerStateError:
+		healthy = false
+	case upcloud.ServerStateStopped:
+		// Servers stopped by Decrease are on their way out; any other
+		// stopped server, e.g. one stopped from the console, cannot run jobs.
+		healthy = g.removing(id, details)
+	}
+	if healthy {
+		g.resetFailures(id)
+		return nil
+	}
+	if n := g.countFailure(id); n < g.failureThreshold() {
+		log.Warn("heartbeat check failed; not reporting it yet", "state", details.State, "failures", n, "threshold", g.failureThreshold())
+		return nil
+	}
+	if g.tryRepair(ctx, log, id, details) {
 		return nil
 	}
 
+	g.markUnhealthy(id, "heartbeat: server "+details.State)
 	if details.State == upcloud.ServerStateError {
+		if g.DeleteErrorServers {
+			g.removeErrorServer(id)
+		}
 		return fmt.Errorf("server %s is in error state", id)
 	}
-
-	return nil
+	return fmt.Errorf("server %s is stopped", id)
 }
 
-// Shutdown performs cleanup before the plugin exits.
-func (g *InstanceGroup) Shutdown(_ context.Context) error {
-	return nil
+// Shutdown performs cleanup before the plugin exits. It cancels readiness
+// probes and waits for background removals to finish, or for ctx to expire.
+func (g *InstanceGroup) Shutdown(ctx context.Context) error {
+	g.probeContext()
+	g.probeCancel()
+	if g.bastion != nil {
+		defer g.bastion.closeAll()
+	}
+	defer g.metrics.close()
+	defer g.stopPprof(ctx)
+	g.reportUsage("shutdown")
+
+	done := make(chan struct{})
+	go func() {
+		g.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // randomSuffix generates a random lowercase alphanumeric string of length n.
+// It draws from crypto/rand so plugin processes started at the same moment
+// do not produce correlated hostnames.
 func randomSuffix(n int) string {
 	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = chars[rand.Intn(len(chars))]
+	// Bytes at or above limit are rejected so every character is equally likely.
+	const limit = 256 - 256%len(chars)
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		rand.Read(buf) // never returns an error
+		for _, c := range buf {
+			if int(c) < limit && len(b) < n {
+				b = append(b, chars[int(c)%len(chars)])
+			}
+		}
 	}
 	return string(b)
 }
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
 	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/client"
@@ -24,9 +26,32 @@ type mockSvc struct {
 	getServersWithFilters   func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error)
 	createServer            func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error)
 	stopServer              func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error)
+	startServer             func(context.Context, *request.StartServerRequest) (*upcloud.ServerDetails, error)
+	restartServer           func(context.Context, *request.RestartServerRequest) (*upcloud.ServerDetails, error)
 	waitForServerState      func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error)
 	deleteServerAndStorages func(context.Context, *request.DeleteServerAndStoragesRequest) error
+	deleteServer            func(context.Context, *request.DeleteServerRequest) error
+	deleteStorage           func(context.Context, *request.DeleteStorageRequest) error
 	getServerDetails        func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error)
+	getIPAddressDetails     func(context.Context, *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error)
+	modifyIPAddress         func(context.Context, *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error)
+	modifyServer            func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error)
+	getStorageDetails       func(context.Context, *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error)
+	getStorages             func(context.Context, *request.GetStoragesRequest) (*upcloud.Storages, error)
+	modifyStorage           func(context.Context, *request.ModifyStorageRequest) (*upcloud.StorageDetails, error)
+	templatizeStorage       func(context.Context, *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error)
+	waitForStorageState     func(context.Context, *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error)
+	getZones                func(context.Context) (*upcloud.Zones, error)
+	getPlans                func(context.Context) (*upcloud.Plans, error)
+	getHosts                func(context.Context) (*upcloud.Hosts, error)
+	getPricesByZone         func(context.Context) (*upcloud.PricesByZone, error)
+	getNetworkDetails       func(context.Context, *request.GetNetworkDetailsRequest) (*upcloud.Network, error)
+	createRouter            func(context.Context, *request.CreateRouterRequest) (*upcloud.Router, error)
+	attachNetworkRouter     func(context.Context, *request.AttachNetworkRouterRequest) error
+	getGateways             func(context.Context, ...request.QueryFilter) ([]upcloud.Gateway, error)
+	createGateway           func(context.Context, *request.CreateGatewayRequest) (*upcloud.Gateway, error)
+	getNetworksInZone       func(context.Context, *request.GetNetworksInZoneRequest) (*upcloud.Networks, error)
+	createNetwork           func(context.Context, *request.CreateNetworkRequest) (*upcloud.Network, error)
 }
 
 func (m *mockSvc) GetAccount(ctx context.Context) (*upcloud.Account, error) {
@@ -45,6 +70,12 @@ func (m *mockSvc) StopServer(ctx context.Context, r *request.StopServerRequest)
 	defer m.mu.Unlock()
 	return m.stopServer(ctx, r)
 }
+func (m *mockSvc) StartServer(ctx context.Context, r *request.StartServerRequest) (*upcloud.ServerDetails, error) {
+	return m.startServer(ctx, r)
+}
+func (m *mockSvc) RestartServer(ctx context.Context, r *request.RestartServerRequest) (*upcloud.ServerDetails, error) {
+	return m.restartServer(ctx, r)
+}
 func (m *mockSvc) WaitForServerState(ctx context.Context, r *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -55,9 +86,88 @@ func (m *mockSvc) DeleteServerAndStorages(ctx context.Context, r *request.Delete
 	defer m.mu.Unlock()
 	return m.deleteServerAndStorages(ctx, r)
 }
+func (m *mockSvc) DeleteServer(ctx context.Context, r *request.DeleteServerRequest) error {
+	return m.deleteServer(ctx, r)
+}
+func (m *mockSvc) DeleteStorage(ctx context.Context, r *request.DeleteStorageRequest) error {
+	return m.deleteStorage(ctx, r)
+}
 func (m *mockSvc) GetServerDetails(ctx context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
 	return m.getServerDetails(ctx, r)
 }
+func (m *mockSvc) GetIPAddressDetails(ctx context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+	return m.getIPAddressDetails(ctx, r)
+}
+func (m *mockSvc) ModifyIPAddress(ctx context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.modifyIPAddress(ctx, r)
+}
+func (m *mockSvc) ModifyServer(ctx context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.modifyServer(ctx, r)
+}
+func (m *mockSvc) GetStorageDetails(ctx context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+	return m.getStorageDetails(ctx, r)
+}
+func (m *mockSvc) GetStorages(ctx context.Context, r *request.GetStoragesRequest) (*upcloud.Storages, error) {
+	return m.getStorages(ctx, r)
+}
+func (m *mockSvc) ModifyStorage(ctx context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.modifyStorage(ctx, r)
+}
+func (m *mockSvc) TemplatizeStorage(ctx context.Context, r *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.templatizeStorage(ctx, r)
+}
+func (m *mockSvc) WaitForStorageState(ctx context.Context, r *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error) {
+	return m.waitForStorageState(ctx, r)
+}
+func (m *mockSvc) GetZones(ctx context.Context) (*upcloud.Zones, error) {
+	return m.getZones(ctx)
+}
+func (m *mockSvc) GetPlans(ctx context.Context) (*upcloud.Plans, error) {
+	return m.getPlans(ctx)
+}
+func (m *mockSvc) GetHosts(ctx context.Context) (*upcloud.Hosts, error) {
+	return m.getHosts(ctx)
+}
+func (m *mockSvc) GetPricesByZone(ctx context.Context) (*upcloud.PricesByZone, error) {
+	return m.getPricesByZone(ctx)
+}
+func (m *mockSvc) GetNetworkDetails(ctx context.Context, r *request.GetNetworkDetailsRequest) (*upcloud.Network, error) {
+	return m.getNetworkDetails(ctx, r)
+}
+func (m *mockSvc) CreateRouter(ctx context.Context, r *request.CreateRouterRequest) (*upcloud.Router, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createRouter(ctx, r)
+}
+func (m *mockSvc) AttachNetworkRouter(ctx context.Context, r *request.AttachNetworkRouterRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attachNetworkRouter(ctx, r)
+}
+func (m *mockSvc) GetGateways(ctx context.Context, f ...request.QueryFilter) ([]upcloud.Gateway, error) {
+	return m.getGateways(ctx, f...)
+}
+func (m *mockSvc) CreateGateway(ctx context.Context, r *request.CreateGatewayRequest) (*upcloud.Gateway, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createGateway(ctx, r)
+}
+func (m *mockSvc) GetNetworksInZone(ctx context.Context, r *request.GetNetworksInZoneRequest) (*upcloud.Networks, error) {
+	return m.getNetworksInZone(ctx, r)
+}
+func (m *mockSvc) CreateNetwork(ctx context.Context, r *request.CreateNetworkRequest) (*upcloud.Network, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createNetwork(ctx, r)
+}
 
 // newMockSvc returns a mock where every method panics unless overridden.
 func newMockSvc() *mockSvc {
@@ -67,22 +177,99 @@ func newMockSvc() *mockSvc {
 		getServersWithFilters:   func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) { panic("GetServersWithFilters"); return nil, nil },
 		createServer:            func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) { panic("CreateServer"); return nil, nil },
 		stopServer:              func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) { panic("StopServer"); return nil, nil },
+		startServer:             func(context.Context, *request.StartServerRequest) (*upcloud.ServerDetails, error) { panic("StartServer"); return nil, nil },
+		restartServer:           func(context.Context, *request.RestartServerRequest) (*upcloud.ServerDetails, error) { panic("RestartServer"); return nil, nil },
 		waitForServerState:      func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) { panic("WaitForServerState"); return nil, nil },
 		deleteServerAndStorages: func(context.Context, *request.DeleteServerAndStoragesRequest) error { panic("DeleteServerAndStorages"); return nil },
+		deleteServer:            func(context.Context, *request.DeleteServerRequest) error { panic("DeleteServer"); return nil },
+		deleteStorage:           func(context.Context, *request.DeleteStorageRequest) error { panic("DeleteStorage"); return nil },
 		getServerDetails:        func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) { panic("GetServerDetails"); return nil, nil },
+		getIPAddressDetails:     func(context.Context, *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) { panic("GetIPAddressDetails"); return nil, nil },
+		modifyIPAddress:         func(context.Context, *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) { panic("ModifyIPAddress"); return nil, nil },
+		modifyServer:            func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) { panic("ModifyServer"); return nil, nil },
+		getStorageDetails:       func(context.Context, *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) { panic("GetStorageDetails"); return nil, nil },
+		getStorages:             func(context.Context, *request.GetStoragesRequest) (*upcloud.Storages, error) { panic("GetStorages"); return nil, nil },
+		modifyStorage:           func(context.Context, *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) { panic("ModifyStorage"); return nil, nil },
+		templatizeStorage:       func(context.Context, *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error) { panic("TemplatizeStorage"); return nil, nil },
+		waitForStorageState:     func(context.Context, *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error) { panic("WaitForStorageState"); return nil, nil },
+		getZones:                func(context.Context) (*upcloud.Zones, error) { panic("GetZones"); return nil, nil },
+		getPlans:                func(context.Context) (*upcloud.Plans, error) { panic("GetPlans"); return nil, nil },
+		getHosts:                func(context.Context) (*upcloud.Hosts, error) { panic("GetHosts"); return nil, nil },
+		getPricesByZone:         func(context.Context) (*upcloud.PricesByZone, error) { panic("GetPricesByZone"); return nil, nil },
+		getNetworkDetails:       func(context.Context, *request.GetNetworkDetailsRequest) (*upcloud.Network, error) { panic("GetNetworkDetails"); return nil, nil },
+		createRouter:            func(context.Context, *request.CreateRouterRequest) (*upcloud.Router, error) { panic("CreateRouter"); return nil, nil },
+		attachNetworkRouter:     func(context.Context, *request.AttachNetworkRouterRequest) error { panic("AttachNetworkRouter"); return nil },
+		getGateways:             func(context.Context, ...request.QueryFilter) ([]upcloud.Gateway, error) { panic("GetGateways"); return nil, nil },
+		createGateway:           func(context.Context, *request.CreateGatewayRequest) (*upcloud.Gateway, error) { panic("CreateGateway"); return nil, nil },
+		getNetworksInZone:       func(context.Context, *request.GetNetworksInZoneRequest) (*upcloud.Networks, error) { panic("GetNetworksInZone"); return nil, nil },
+		createNetwork:           func(context.Context, *request.CreateNetworkRequest) (*upcloud.Network, error) { panic("CreateNetwork"); return nil, nil },
+	}
+}
+
+// allowDeletionLabel lets stopAndDelete read and update server labels.
+// Tests that need specific server details override getServerDetails afterwards.
+func allowDeletionLabel(m *mockSvc) {
+	m.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", ""), nil
+	}
+	m.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+}
+
+// noServers makes GetServersWithFilters return an empty list.
+func noServers(m *mockSvc) {
+	m.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{}, nil
+	}
+}
+
+// knownZone makes GetZones list zone as the only existing zone.
+func knownZone(m *mockSvc, zone string) {
+	m.getZones = func(context.Context) (*upcloud.Zones, error) {
+		return &upcloud.Zones{Zones: []upcloud.Zone{{ID: zone}}}, nil
+	}
+}
+
+// knownPlan makes GetPlans list only the default plan, offered in every zone.
+func knownPlan(m *mockSvc) {
+	m.getPlans = func(context.Context) (*upcloud.Plans, error) {
+		return &upcloud.Plans{Plans: []upcloud.Plan{{Name: defaultPlan}}}, nil
+	}
+	m.getPricesByZone = func(context.Context) (*upcloud.PricesByZone, error) {
+		return &upcloud.PricesByZone{}, nil
+	}
+}
+
+// validTemplate makes GetStorageDetails return a public cloud-init template
+// usable in any zone.
+func validTemplate(m *mockSvc) {
+	m.getStorageDetails = func(_ context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+		return &upcloud.StorageDetails{Storage: upcloud.Storage{
+			UUID:         r.UUID,
+			Title:        "Debian 13",
+			Type:         upcloud.StorageTypeTemplate,
+			Access:       upcloud.StorageAccessPublic,
+			TemplateType: upcloud.StorageTemplateTypeCloudInit,
+			Size:         10,
+		}}, nil
 	}
 }
 
 // baseGroup returns a minimal valid InstanceGroup with a pre-set mock service.
 func baseGroup(svc *mockSvc) *InstanceGroup {
 	g := &InstanceGroup{
-		Token:    "test-token",
-		Zone:     "fi-hel1",
-		Template: "template-uuid",
-		Name:     "test-group",
-		Plan:     defaultPlan,
-		svc:      svc,
-		log:      hclog.NewNullLogger(),
+		Token:         "test-token",
+		Zone:          "fi-hel1",
+		Template:      "template-uuid",
+		Name:          "test-group",
+		Plan:          defaultPlan,
+		DefaultOS:     defaultOS,
+		DefaultArch:   defaultArch,
+		GroupLabelKey: groupLabelKey,
+		SuffixLength:  defaultSuffixLength,
+		svc:           svc,
+		log:           hclog.NewNullLogger(),
 	}
 	return g
 }
@@ -152,6 +339,135 @@ func TestValidate(t *testing.T) {
 			wantPrefix:  "ci",
 			wantMaxSize: defaultMaxSize,
 		},
+		{
+			name:    "invalid floating IP",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", FloatingIPs: []string{"not-an-ip"}},
+			wantErr: true,
+		},
+		{
+			name:        "floating IP pool caps max size",
+			g:           InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", FloatingIPs: []string{"5.6.7.8", "5.6.7.9"}},
+			wantPlan:    defaultPlan,
+			wantMaxSize: 2,
+		},
+		{
+			name:    "max size above the floating IP pool",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", MaxSize: 3, FloatingIPs: []string{"5.6.7.8", "5.6.7.9"}},
+			wantErr: true,
+		},
+		{
+			name:    "private only without a private interface",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", PrivateOnly: true},
+			wantErr: true,
+		},
+		{
+			name:    "private only with floating IPs",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", PrivateOnly: true, UsePrivateNetwork: true, FloatingIPs: []string{"5.6.7.8"}},
+			wantErr: true,
+		},
+		{
+			name:        "private only with utility network",
+			g:           InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", PrivateOnly: true, UseUtilityNetwork: true},
+			wantPlan:    defaultPlan,
+			wantMaxSize: defaultMaxSize,
+		},
+		{
+			name:    "invalid extra SSH key",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", ExtraSSHKeys: []string{"not-a-key"}},
+			wantErr: true,
+		},
+		{
+			name:    "both key passphrase sources",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", KeyPassphrase: "p", KeyPassphraseFile: "/f"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown default OS",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", DefaultOS: "plan9"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown default arch",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", DefaultArch: "x86_64"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown NIC model",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", NICModel: "ne2000"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown video model",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", VideoModel: "qxl"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown boot device",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", BootOrder: "disk,floppy"},
+			wantErr: true,
+		},
+		{
+			name:        "server tuning fields",
+			g:           InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", NICModel: "virtio", VideoModel: "vga", BootOrder: "disk,network"},
+			wantPlan:    defaultPlan,
+			wantMaxSize: defaultMaxSize,
+		},
+		{
+			name:    "webhook URL without scheme",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", WebhookURL: "hooks.example.com/x"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid webhook template",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", WebhookURL: "https://hooks.example.com/x", WebhookTemplate: "{{.Event"},
+			wantErr: true,
+		},
+		{
+			name:        "per-arch templates instead of template",
+			g:           InstanceGroup{Token: "tok", Zone: "z", Name: "n", Templates: map[string]string{"arm64": "tmpl-arm"}},
+			wantPlan:    defaultPlan,
+			wantMaxSize: defaultMaxSize,
+		},
+		{
+			name:    "unknown templates arch",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", Templates: map[string]string{"aarch64": "tmpl-arm"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown storage tier",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", StorageTier: "ssd"},
+			wantErr: true,
+		},
+		{
+			name:    "negative max size",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", MaxSize: -1},
+			wantErr: true,
+		},
+		{
+			name:    "negative create retries",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", CreateRetries: -1},
+			wantErr: true,
+		},
+		{
+			name:    "negative delete concurrency",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", DeleteConcurrency: -1},
+			wantErr: true,
+		},
+		{
+			name:    "unknown hostname format",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", HostnameFormat: "fancy"},
+			wantErr: true,
+		},
+		{
+			name:    "suffix length too short",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", SuffixLength: 2},
+			wantErr: true,
+		},
+		{
+			name:    "suffix length too long",
+			g:       InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", SuffixLength: 64},
+			wantErr: true,
+		},
 		{
 			name:        "explicit max size preserved",
 			g:           InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", MaxSize: 5},
@@ -160,7 +476,8 @@ func TestValidate(t *testing.T) {
 		},
 	}
 
-	for _, tc := range tests {
+	for i := range tests {
+		tc := &tests[i]
 		t.Run(tc.name, func(t *testing.T) {
 			err := tc.g.validate()
 			if (err != nil) != tc.wantErr {
@@ -182,6 +499,19 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestValidate_ReportsAllErrors(t *testing.T) {
+	g := InstanceGroup{Token: "tok", StorageTier: "ssd", MaxSize: -3, NICModel: "ne2000"}
+	err := g.validate()
+	if err == nil {
+		t.Fatal("validate() expected error, got nil")
+	}
+	for _, want := range []string{"zone is required", "template, templates or template_selector is required", "name is required", "storage_tier", "max_size", "nic_model"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validate() error = %q, missing %q", err, want)
+		}
+	}
+}
+
 // ─── mapServerState ───────────────────────────────────────────────────────────
 
 func TestMapServerState(t *testing.T) {
@@ -280,6 +610,7 @@ func TestUpdate_APIError(t *testing.T) {
 func TestIncrease_AllSucceed(t *testing.T) {
 	var created []string
 	mock := newMockSvc()
+	noServers(mock)
 	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
 		created = append(created, r.Hostname)
 		return &upcloud.ServerDetails{}, nil
@@ -302,6 +633,7 @@ func TestIncrease_AllSucceed(t *testing.T) {
 func TestIncrease_PartialFailure(t *testing.T) {
 	calls := 0
 	mock := newMockSvc()
+	noServers(mock)
 	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
 		calls++
 		if calls%2 == 0 {
@@ -313,7 +645,7 @@ func TestIncrease_PartialFailure(t *testing.T) {
 	g := baseGroup(mock)
 	n, err := g.Increase(context.Background(), 4)
 
-	// Increase never returns an error; it logs failures and counts successes.
+	// Non-permanent failures are logged, not returned; successes are counted.
 	if err != nil {
 		t.Fatalf("Increase() unexpected error: %v", err)
 	}
@@ -322,6 +654,28 @@ func TestIncrease_PartialFailure(t *testing.T) {
 	}
 }
 
+func TestIncrease_AllFail(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, _ *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		return nil, errQuota
+	}
+
+	g := baseGroup(mock)
+	n, err := g.Increase(context.Background(), 3)
+
+	if n != 0 {
+		t.Errorf("Increase() = %d, want 0", n)
+	}
+	if !errors.Is(err, errQuota) {
+		t.Fatalf("Increase() error = %v, want it to wrap the creation failures", err)
+	}
+	if got := strings.Count(err.Error(), "quota exceeded"); got != 3 {
+		t.Errorf("error mentions %d failures, want 3: %v", got, err)
+	}
+}
+
 func TestIncrease_Zero(t *testing.T) {
 	g := baseGroup(newMockSvc())
 	n, err := g.Increase(context.Background(), 0)
@@ -333,6 +687,7 @@ func TestIncrease_Zero(t *testing.T) {
 func TestIncrease_SetsUserData(t *testing.T) {
 	var got string
 	mock := newMockSvc()
+	noServers(mock)
 	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
 		got = r.UserData
 		return &upcloud.ServerDetails{}, nil
@@ -347,10 +702,129 @@ func TestIncrease_SetsUserData(t *testing.T) {
 	}
 }
 
+func TestIncrease_ExtraSSHKeys(t *testing.T) {
+	var got request.SSHKeySlice
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		got = r.LoginUser.SSHKeys
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.publicKey = "ssh-ed25519 AAAA-connector"
+	g.ExtraSSHKeys = []string{"ssh-ed25519 AAAA-oncall-1", "ssh-ed25519 AAAA-oncall-2"}
+	g.Increase(context.Background(), 1)
+
+	want := []string{g.publicKey, g.ExtraSSHKeys[0], g.ExtraSSHKeys[1]}
+	if len(got) != len(want) {
+		t.Fatalf("SSHKeys = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SSHKeys[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIncrease_ExtraSSHKeysWithoutConnectorKey(t *testing.T) {
+	var got *request.LoginUser
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		got = r.LoginUser
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.ExtraSSHKeys = []string{"ssh-ed25519 AAAA-oncall"}
+	g.Increase(context.Background(), 1)
+
+	if got == nil || len(got.SSHKeys) != 1 || got.SSHKeys[0] != "ssh-ed25519 AAAA-oncall" {
+		t.Errorf("LoginUser = %+v, want only the extra key", got)
+	}
+}
+
+func TestIncrease_Metadata(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name     string
+		metadata *bool
+		want     upcloud.Boolean
+	}{
+		{name: "default enabled", want: upcloud.True},
+		{name: "explicitly disabled", metadata: &disabled, want: upcloud.False},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got upcloud.Boolean
+			mock := newMockSvc()
+			noServers(mock)
+			mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+				got = r.Metadata
+				return &upcloud.ServerDetails{}, nil
+			}
+
+			g := baseGroup(mock)
+			g.Metadata = tc.metadata
+			g.Increase(context.Background(), 1)
+
+			if got != tc.want {
+				t.Errorf("CreateServer Metadata = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIncrease_RemoteAccess(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var got upcloud.Boolean
+		mock := newMockSvc()
+		noServers(mock)
+		mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+			got = r.RemoteAccessEnabled
+			return &upcloud.ServerDetails{}, nil
+		}
+
+		g := baseGroup(mock)
+		g.RemoteAccess = enabled
+		g.Increase(context.Background(), 1)
+
+		if want := upcloud.FromBool(enabled); got != want {
+			t.Errorf("RemoteAccess=%v: CreateServer RemoteAccessEnabled = %v, want %v", enabled, got, want)
+		}
+	}
+}
+
+func TestIncrease_ServerTuning(t *testing.T) {
+	var got *request.CreateServerRequest
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		got = r
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.Timezone = "Europe/Helsinki"
+	g.NICModel = "virtio"
+	g.VideoModel = "cirrus"
+	g.BootOrder = "disk,network"
+	g.Increase(context.Background(), 1)
+
+	if got.TimeZone != g.Timezone || got.NICModel != g.NICModel || got.VideoModel != g.VideoModel || got.BootOrder != g.BootOrder {
+		t.Errorf("CreateServer tuning = (%q, %q, %q, %q), want (%q, %q, %q, %q)",
+			got.TimeZone, got.NICModel, got.VideoModel, got.BootOrder,
+			g.Timezone, g.NICModel, g.VideoModel, g.BootOrder)
+	}
+}
+
 // ─── Decrease ─────────────────────────────────────────────────────────────────
 
 func TestDecrease_AllSucceed(t *testing.T) {
 	mock := newMockSvc()
+	allowDeletionLabel(mock)
 	mock.stopServer = func(_ context.Context, _ *request.StopServerRequest) (*upcloud.ServerDetails, error) {
 		return &upcloud.ServerDetails{}, nil
 	}
@@ -375,6 +849,7 @@ func TestDecrease_AllSucceed(t *testing.T) {
 
 func TestDecrease_PartialFailure(t *testing.T) {
 	mock := newMockSvc()
+	allowDeletionLabel(mock)
 	mock.stopServer = func(_ context.Context, r *request.StopServerRequest) (*upcloud.ServerDetails, error) {
 		if r.UUID == "uuid-bad" {
 			return nil, errors.New("stop failed")
@@ -399,6 +874,97 @@ func TestDecrease_PartialFailure(t *testing.T) {
 	}
 }
 
+func TestDecrease_RecoversFromPanic(t *testing.T) {
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.stopServer = func(_ context.Context, r *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		if r.UUID == "uuid-bad" {
+			panic("boom")
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, _ *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, _ *request.DeleteServerAndStoragesRequest) error {
+		return nil
+	}
+
+	g := baseGroup(mock)
+	succeeded, err := g.Decrease(context.Background(), []string{"uuid-ok", "uuid-bad"})
+
+	if err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Fatalf("Decrease() error = %v, want panic error", err)
+	}
+	if len(succeeded) != 1 || succeeded[0] != "uuid-ok" {
+		t.Errorf("Decrease() succeeded = %v, want [uuid-ok]", succeeded)
+	}
+	if g.isDeleting("uuid-bad") {
+		t.Error("panicked server still marked as deleting")
+	}
+}
+
+func TestDecrease_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The mock panics on any call, so nothing may reach the API.
+	g := baseGroup(newMockSvc())
+	succeeded, err := g.Decrease(ctx, []string{"uuid-1"})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Decrease() error = %v, want context.Canceled", err)
+	}
+	if len(succeeded) != 0 {
+		t.Errorf("Decrease() succeeded = %v, want none", succeeded)
+	}
+}
+
+func TestDecrease_BoundedConcurrency(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.stopServer = func(_ context.Context, _ *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, _ *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, _ *request.DeleteServerAndStoragesRequest) error {
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.DeleteConcurrency = 3
+
+	ids := make([]string, 12)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("uuid-%d", i)
+	}
+	succeeded, err := g.Decrease(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	if len(succeeded) != len(ids) {
+		t.Errorf("Decrease() removed %d, want %d", len(succeeded), len(ids))
+	}
+	if peak > 3 {
+		t.Errorf("peak concurrent removals = %d, want at most 3", peak)
+	}
+}
+
 func TestDecrease_Empty(t *testing.T) {
 	g := baseGroup(newMockSvc())
 	succeeded, err := g.Decrease(context.Background(), nil)
@@ -411,6 +977,7 @@ func TestDecrease_Empty(t *testing.T) {
 
 func makeDetails(publicIP, privateIP string) *upcloud.ServerDetails {
 	d := &upcloud.ServerDetails{}
+	d.Labels = upcloud.LabelSlice{{Key: groupLabelKey, Value: "test-group"}}
 	if publicIP != "" {
 		d.IPAddresses = append(d.IPAddresses, upcloud.IPAddress{
 			Family:  upcloud.IPAddressFamilyIPv4,
@@ -477,6 +1044,25 @@ func TestConnectInfo_PreservesConnectorConfig(t *testing.T) {
 	}
 }
 
+func TestConnectInfo_ConfiguredDefaults(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	g := baseGroup(mock)
+	g.DefaultOS = "windows"
+	g.DefaultArch = "arm64"
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.OS != "windows" || info.Arch != "arm64" {
+		t.Errorf("OS/Arch = %s/%s, want windows/arm64", info.OS, info.Arch)
+	}
+}
+
 func TestConnectInfo_UsePrivateNetwork(t *testing.T) {
 	mock := newMockSvc()
 	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
@@ -512,7 +1098,9 @@ func TestConnectInfo_APIError(t *testing.T) {
 func TestHeartbeat_HealthyServer(t *testing.T) {
 	mock := newMockSvc()
 	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
-		return &upcloud.ServerDetails{Server: upcloud.Server{State: upcloud.ServerStateStarted}}, nil
+		d := makeDetails("", "")
+		d.State = upcloud.ServerStateStarted
+		return d, nil
 	}
 
 	g := baseGroup(mock)
@@ -580,8 +1168,12 @@ func TestInit_GetAccountError(t *testing.T) {
 func TestInit_Success(t *testing.T) {
 	mock := newMockSvc()
 	mock.getAccount = func(context.Context) (*upcloud.Account, error) {
-		return &upcloud.Account{}, nil
+		return &upcloud.Account{UserName: "acct"}, nil
 	}
+	noServers(mock)
+	knownZone(mock, "fi-hel1")
+	knownPlan(mock)
+	validTemplate(mock)
 
 	orig := newUpcloudService
 	newUpcloudService = func(_ *client.Client) upcloudSvc { return mock }
@@ -599,4 +1191,16 @@ func TestInit_Success(t *testing.T) {
 	if !strings.Contains(info.ID, "fi-hel1") {
 		t.Errorf("ProviderInfo.ID = %q, expected to contain zone", info.ID)
 	}
+	if info.ID != "upcloud/acct/fi-hel1/n" {
+		t.Errorf("ProviderInfo.ID = %q, want upcloud/acct/fi-hel1/n", info.ID)
+	}
+}
+
+func TestNewClient_UserAgent(t *testing.T) {
+	g := &InstanceGroup{Token: "tok"}
+	g.log = hclog.NewNullLogger()
+	ua := g.newClient().UserAgent
+	if !strings.HasPrefix(ua, Version.Name+"/"+Version.Version+" upcloud-go-api/") {
+		t.Errorf("User-Agent = %q, want the plugin version before the SDK's", ua)
+	}
 }
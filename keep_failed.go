@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// debugLabelKey marks failed instances kept for debugging; its value is the
+// Unix time at which the plugin gave the instance up.
+const debugLabelKey = "fleeting-debug"
+
+// defaultKeepFailedInstancesMax caps the failed instances kept at once.
+const defaultKeepFailedInstancesMax = 1
+
+// keepFailedMax returns how many failed instances may be kept at once.
+func (g *InstanceGroup) keepFailedMax() int {
+	if g.KeepFailedInstancesMax > 0 {
+		return g.KeepFailedInstancesMax
+	}
+	return defaultKeepFailedInstancesMax
+}
+
+// isKept reports whether a server is kept for debugging.
+func (g *InstanceGroup) isKept(uuid string) bool {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	return g.kept[uuid]
+}
+
+// reserveKept claims one of the KeepFailedInstancesMax slots for a server.
+func (g *InstanceGroup) reserveKept(uuid string) bool {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if len(g.kept) >= g.keepFailedMax() {
+		return false
+	}
+	if g.kept == nil {
+		g.kept = make(map[string]bool)
+	}
+	g.kept[uuid] = true
+	return true
+}
+
+// releaseKept frees the slot of a kept server.
+func (g *InstanceGroup) releaseKept(uuid string) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	delete(g.kept, uuid)
+}
+
+// keepFailed labels a failed server with debugLabelKey and leaves it running
+// instead of removing it, while fewer than KeepFailedInstancesMax servers are
+// kept. It reports whether the server was kept; the runner no longer sees
+// it, and deleting it is left to the operator.
+func (g *InstanceGroup) keepFailed(ctx context.Context, log hclog.Logger, uuid, reason string, details *upcloud.ServerDetails) bool {
+	if !g.KeepFailedInstances || !g.reserveKept(uuid) {
+		return false
+	}
+	labels := upcloud.LabelSlice{}
+	for _, l := range details.Labels {
+		if l.Key != debugLabelKey {
+			labels = append(labels, l)
+		}
+	}
+	labels = append(labels, upcloud.Label{Key: debugLabelKey, Value: strconv.FormatInt(time.Now().Unix(), 10)})
+	if _, err := g.svc.ModifyServer(ctx, &request.ModifyServerRequest{UUID: uuid, Labels: &labels}); err != nil {
+		// Unlabelled, the server would be lost track of after a restart.
+		log.Warn("failed to label failed instance for debugging; removing it", "error", err)
+		g.releaseKept(uuid)
+		return false
+	}
+	log.Warn("keeping failed instance for debugging; delete it manually when done", "reason", reason, "label", debugLabelKey)
+	return true
+}
+
+// resumeKept picks up the failed servers kept by an earlier plugin process,
+// so they stay hidden from the runner and count against the cap.
+func (g *InstanceGroup) resumeKept(ctx context.Context) error {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: append(g.groupFilters(), request.FilterLabelKey{Key: debugLabelKey}),
+	})
+	if err != nil {
+		return fmt.Errorf("listing failed servers kept for debugging: %w", err)
+	}
+
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	for _, s := range servers.Servers {
+		if g.kept == nil {
+			g.kept = make(map[string]bool)
+		}
+		g.kept[s.UUID] = true
+	}
+	return nil
+}
+
+// pruneKept frees the slots of kept servers that no longer exist, i.e. that
+// the operator has deleted. listed holds the servers Update saw.
+func (g *InstanceGroup) pruneKept(listed map[string]bool) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	for uuid := range g.kept {
+		if !listed[uuid] {
+			delete(g.kept, uuid)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── keep failed instances ────────────────────────────────────────────────────
+
+func TestDecrease_KeepsFailedInstances(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		labelled []string
+		deleted  []string
+		listed   = []upcloud.Server{{UUID: "uuid-1"}, {UUID: "uuid-2"}, {UUID: "uuid-3"}}
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.modifyServer = func(_ context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := labelValue(*r.Labels, debugLabelKey); ok {
+			labelled = append(labelled, r.UUID)
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: listed}, nil
+	}
+
+	g := baseGroup(mock)
+	g.KeepFailedInstances = true
+	g.markUnhealthy("uuid-1", "readiness timed out")
+	g.markUnhealthy("uuid-2", "readiness timed out")
+	// Sequential removals, so the first failed instance takes the only slot.
+	for _, uuid := range []string{"uuid-1", "uuid-2", "uuid-3"} {
+		if _, err := g.Decrease(context.Background(), []string{uuid}); err != nil {
+			t.Fatalf("Decrease(%s) unexpected error: %v", uuid, err)
+		}
+	}
+	if len(labelled) != 1 || labelled[0] != "uuid-1" {
+		t.Errorf("labelled = %v, want [uuid-1]", labelled)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("deleted = %v, want uuid-2 and uuid-3", deleted)
+	}
+
+	var reported []string
+	g.Update(context.Background(), func(id string, _ provider.State) { reported = append(reported, id) })
+	for _, id := range reported {
+		if id == "uuid-1" {
+			t.Errorf("Update() reported the kept instance")
+		}
+	}
+
+	// Once the operator deletes the kept instance, its slot is free again.
+	listed = nil
+	g.Update(context.Background(), func(string, provider.State) {})
+	if g.isKept("uuid-1") {
+		t.Error("kept instance still tracked after it disappeared")
+	}
+}
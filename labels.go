@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// Labels recording which runner manager, plugin build and template created a
+// server.
+const (
+	managerLabelKey    = "fleeting-manager"
+	versionLabelKey    = "fleeting-plugin-version"
+	configHashLabelKey = "fleeting-config-hash"
+	templateLabelKey   = "fleeting-template"
+)
+
+// defaultCostCenterLabelKey is the label key cost_center is stamped under
+// unless cost_center_label_key says otherwise.
+const defaultCostCenterLabelKey = "cost-center"
+
+// labelKeyPattern matches the label keys accepted by the UpCloud API.
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9-][a-zA-Z0-9_-]{1,31}$`)
+
+// secretConfigKeys are plugin_config keys excluded from the config hash:
+// credentials, and URLs or bodies that often embed one, such as webhook
+// URLs and templates or user data fetched from a signed URL.
+var secretConfigKeys = []string{
+	"token", "username", "password", "key_passphrase",
+	"webhook_url", "webhook_template", "status_page_url", "user_data",
+}
+
+// serverLabels returns the labels applied to every server created by this group.
+func (g *InstanceGroup) serverLabels(createdAt time.Time) *upcloud.LabelSlice {
+	labels := upcloud.LabelSlice{
+		{Key: g.GroupLabelKey, Value: g.Name},
+		{Key: versionLabelKey, Value: Version.Version},
+		{Key: createdAtLabelKey, Value: strconv.FormatInt(createdAt.Unix(), 10)},
+		{Key: templateLabelKey, Value: g.templateUUID()},
+	}
+	// Servers must match the filters Update lists them with.
+	for _, k := range slices.Sorted(maps.Keys(g.LabelFilters)) {
+		labels = append(labels, upcloud.Label{Key: k, Value: g.LabelFilters[k]})
+	}
+	if g.CostCenter != "" {
+		labels = append(labels, upcloud.Label{Key: g.CostCenterLabelKey, Value: g.CostCenter})
+	}
+	if g.managerHostname != "" {
+		labels = append(labels, upcloud.Label{Key: managerLabelKey, Value: g.managerHostname})
+	}
+	if g.configHash != "" {
+		labels = append(labels, upcloud.Label{Key: configHashLabelKey, Value: g.configHash})
+	}
+	return &labels
+}
+
+// groupFilters select the servers belonging to this group: the group label
+// plus any configured label_filters.
+func (g *InstanceGroup) groupFilters() []request.QueryFilter {
+	filters := []request.QueryFilter{
+		request.FilterLabel{Label: upcloud.Label{Key: g.GroupLabelKey, Value: g.Name}},
+	}
+	for _, k := range slices.Sorted(maps.Keys(g.LabelFilters)) {
+		filters = append(filters, request.FilterLabel{Label: upcloud.Label{Key: k, Value: g.LabelFilters[k]}})
+	}
+	return filters
+}
+
+// hashConfig returns a short, stable hash of the plugin config with credentials
+// removed, so servers built from different configs can be told apart.
+func (g *InstanceGroup) hashConfig() (string, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+
+	// Round-trip through a map: it drops the secrets and gives sorted keys.
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	for _, k := range secretConfigKeys {
+		delete(m, k)
+	}
+	if b, err = json.Marshal(m); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12], nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// labelValue returns the value of key in labels and whether it was present.
+func labelValue(labels upcloud.LabelSlice, key string) (string, bool) {
+	for _, l := range labels {
+		if l.Key == key {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// ─── server labels ────────────────────────────────────────────────────────────
+
+func TestIncrease_ManagerLabels(t *testing.T) {
+	var got upcloud.LabelSlice
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		got = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.managerHostname = "runner-manager-1"
+	g.configHash = "abc123def456"
+	g.Increase(context.Background(), 1)
+
+	want := map[string]string{
+		groupLabelKey:      g.Name,
+		managerLabelKey:    "runner-manager-1",
+		versionLabelKey:    Version.Version,
+		configHashLabelKey: "abc123def456",
+	}
+	if _, ok := labelValue(got, createdAtLabelKey); !ok {
+		t.Errorf("label %s missing", createdAtLabelKey)
+	}
+	for k, v := range want {
+		if gotV, ok := labelValue(got, k); !ok || gotV != v {
+			t.Errorf("label %s = %q (present %v), want %q", k, gotV, ok, v)
+		}
+	}
+}
+
+func TestCustomGroupLabelKey(t *testing.T) {
+	var (
+		created upcloud.LabelSlice
+		filters []request.QueryFilter
+	)
+	mock := newMockSvc()
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		created = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.getServersWithFilters = func(_ context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		filters = r.Filters
+		return &upcloud.Servers{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.GroupLabelKey = "ci-pool"
+	g.Increase(context.Background(), 1)
+	g.Update(context.Background(), func(string, provider.State) {})
+
+	if v, ok := labelValue(created, "ci-pool"); !ok || v != g.Name {
+		t.Errorf("label ci-pool = %q (present %v), want %q", v, ok, g.Name)
+	}
+	if _, ok := labelValue(created, groupLabelKey); ok {
+		t.Errorf("default label %s still set", groupLabelKey)
+	}
+	want := request.FilterLabel{Label: upcloud.Label{Key: "ci-pool", Value: g.Name}}
+	if len(filters) != 1 || filters[0] != want {
+		t.Errorf("Update filters = %v, want [%v]", filters, want)
+	}
+}
+
+func TestValidate_GroupLabelKey(t *testing.T) {
+	for key, wantErr := range map[string]bool{
+		"":           false, // default
+		"ci-pool":    false,
+		"team_label": false,
+		"_hidden":    true,
+		"has space":  true,
+		"x":          true,
+	} {
+		g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", GroupLabelKey: key}
+		if err := g.validate(); (err != nil) != wantErr {
+			t.Errorf("validate() with group_label_key %q error = %v, wantErr = %v", key, err, wantErr)
+		}
+	}
+}
+
+func TestHashConfig(t *testing.T) {
+	a := baseGroup(newMockSvc())
+	b := baseGroup(newMockSvc())
+	b.Token = "a-different-token"
+	b.WebhookURL = "https://hooks.example.com/T0K3N"
+	b.WebhookTemplate = `{"token": "T0K3N"}`
+	b.StatusPageURL = "https://status.example.com/?key=T0K3N"
+	b.UserData = "https://bucket.example.com/user-data?signature=T0K3N"
+
+	ha, err := a.hashConfig()
+	if err != nil {
+		t.Fatalf("hashConfig() unexpected error: %v", err)
+	}
+	hb, _ := b.hashConfig()
+	if ha != hb {
+		t.Errorf("hash changed with credentials only: %q vs %q", ha, hb)
+	}
+	if len(ha) != 12 {
+		t.Errorf("hash %q has length %d, want 12", ha, len(ha))
+	}
+
+	b.Plan = "2xCPU-4GB"
+	if hc, _ := b.hashConfig(); hc == ha {
+		t.Error("hash did not change when the plan changed")
+	}
+}
+
+func TestLabelFilters(t *testing.T) {
+	var (
+		created upcloud.LabelSlice
+		filters []request.QueryFilter
+	)
+	mock := newMockSvc()
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		created = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.getServersWithFilters = func(_ context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		filters = r.Filters
+		return &upcloud.Servers{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.LabelFilters = map[string]string{"environment": "prod", "cluster": "eu"}
+	g.Increase(context.Background(), 1)
+	g.Update(context.Background(), func(string, provider.State) {})
+
+	for k, v := range g.LabelFilters {
+		if got, ok := labelValue(created, k); !ok || got != v {
+			t.Errorf("created label %s = %q (present %v), want %q", k, got, ok, v)
+		}
+	}
+	want := []request.QueryFilter{
+		request.FilterLabel{Label: upcloud.Label{Key: groupLabelKey, Value: g.Name}},
+		request.FilterLabel{Label: upcloud.Label{Key: "cluster", Value: "eu"}},
+		request.FilterLabel{Label: upcloud.Label{Key: "environment", Value: "prod"}},
+	}
+	if !slices.Equal(filters, want) {
+		t.Errorf("Update filters = %v, want %v", filters, want)
+	}
+}
+
+func TestValidate_LabelFilters(t *testing.T) {
+	for key, wantErr := range map[string]bool{
+		"environment":    false,
+		"fleeting-group": true,
+		"fleeting-state": true,
+		"bad key":        true,
+	} {
+		g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", LabelFilters: map[string]string{key: "v"}}
+		if err := g.validate(); (err != nil) != wantErr {
+			t.Errorf("validate() with label_filters key %q error = %v, wantErr = %v", key, err, wantErr)
+		}
+	}
+}
+
+func TestIncrease_CostCenter(t *testing.T) {
+	var server, storage upcloud.LabelSlice
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		server = *r.Labels
+		d := &upcloud.ServerDetails{}
+		d.UUID = "uuid-1"
+		d.StorageDevices = upcloud.ServerStorageDeviceSlice{{UUID: "disk-1", Type: upcloud.StorageTypeDisk}}
+		return d, nil
+	}
+	mock.modifyStorage = func(_ context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+		storage = *r.Labels
+		return &upcloud.StorageDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.CostCenter, g.CostCenterLabelKey = "team-ci", defaultCostCenterLabelKey
+	g.Increase(context.Background(), 1)
+
+	for name, labels := range map[string]upcloud.LabelSlice{"server": server, "storage": storage} {
+		if v, _ := labelValue(labels, "cost-center"); v != "team-ci" {
+			t.Errorf("%s label cost-center = %q, want team-ci", name, v)
+		}
+	}
+}
+
+func TestValidate_CostCenter(t *testing.T) {
+	tests := []struct {
+		center, key string
+		wantErr     bool
+	}{
+		{center: "team-ci"},
+		{center: "team-ci", key: "project"},
+		{center: "team-ci", key: "fleeting-project", wantErr: true},
+		{center: "team-ci", key: "environment", wantErr: true},
+		{key: "project", wantErr: true},
+	}
+	for _, tc := range tests {
+		g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", CostCenter: tc.center, CostCenterLabelKey: tc.key,
+			LabelFilters: map[string]string{"environment": "prod"}}
+		if err := g.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("validate() with cost_center %q under %q error = %v, wantErr = %v", tc.center, tc.key, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Components with their own sub-logger, whose level can be set separately
+// through log_levels.
+const (
+	logAPI       = "api"
+	logScaling   = "scaling"
+	logHeartbeat = "heartbeat"
+	logGC        = "gc"
+)
+
+var logComponents = []string{logAPI, logScaling, logHeartbeat, logGC}
+
+// parseLogLevels checks log_level and log_levels and records the parsed
+// levels.
+func (g *InstanceGroup) parseLogLevels() error {
+	if g.LogLevel != "" {
+		if g.logLevel = hclog.LevelFromString(g.LogLevel); g.logLevel == hclog.NoLevel {
+			return fmt.Errorf("log_level %q is not one of trace, debug, info, warn, error", g.LogLevel)
+		}
+	}
+	g.componentLevels = map[string]hclog.Level{}
+	for component, level := range g.LogLevels {
+		if !slices.Contains(logComponents, component) {
+			return fmt.Errorf("log_levels: unknown component %q; want one of %v", component, logComponents)
+		}
+		l := hclog.LevelFromString(level)
+		if l == hclog.NoLevel {
+			return fmt.Errorf("log_levels.%s: %q is not one of trace, debug, info, warn, error", component, level)
+		}
+		g.componentLevels[component] = l
+	}
+	return nil
+}
+
+// logger returns the named sub-logger of a component, filtered at its
+// log_levels entry or else at log_level.
+func (g *InstanceGroup) logger(component string) hclog.Logger {
+	base := g.log
+	if l, ok := base.(*leveledLogger); ok {
+		// Components may be more verbose than the plugin as a whole.
+		base = l.Logger
+	}
+	if level, ok := g.componentLevels[component]; ok {
+		return withLevel(base.Named(component), level)
+	}
+	return withLevel(base.Named(component), g.logLevel)
+}
+
+// withInstance attaches an instance's UUID and hostname, where known, to
+// every line logged through log, so the lifecycle of a single VM can be
+// followed with one grep.
+func withInstance(log hclog.Logger, uuid, hostname string) hclog.Logger {
+	var args []interface{}
+	if uuid != "" {
+		args = append(args, "uuid", uuid)
+	}
+	if hostname != "" {
+		args = append(args, "hostname", hostname)
+	}
+	return log.With(args...)
+}
+
+// withLevel filters log below level. The logger handed over by the runner
+// logs everything and shares its level with all sub-loggers, so levels are
+// applied here rather than with SetLevel. NoLevel returns log unchanged.
+func withLevel(log hclog.Logger, level hclog.Level) hclog.Logger {
+	if level == hclog.NoLevel {
+		return log
+	}
+	return &leveledLogger{Logger: log, level: level}
+}
+
+// leveledLogger drops messages below level before passing them on.
+type leveledLogger struct {
+	hclog.Logger
+	level hclog.Level
+}
+
+func (l *leveledLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	if level >= l.level {
+		l.Logger.Log(level, msg, args...)
+	}
+}
+
+func (l *leveledLogger) Trace(msg string, args ...interface{}) { l.Log(hclog.Trace, msg, args...) }
+func (l *leveledLogger) Debug(msg string, args ...interface{}) { l.Log(hclog.Debug, msg, args...) }
+func (l *leveledLogger) Info(msg string, args ...interface{})  { l.Log(hclog.Info, msg, args...) }
+func (l *leveledLogger) Warn(msg string, args ...interface{})  { l.Log(hclog.Warn, msg, args...) }
+func (l *leveledLogger) Error(msg string, args ...interface{}) { l.Log(hclog.Error, msg, args...) }
+
+func (l *leveledLogger) IsTrace() bool { return l.level <= hclog.Trace && l.Logger.IsTrace() }
+func (l *leveledLogger) IsDebug() bool { return l.level <= hclog.Debug && l.Logger.IsDebug() }
+func (l *leveledLogger) IsInfo() bool  { return l.level <= hclog.Info && l.Logger.IsInfo() }
+func (l *leveledLogger) IsWarn() bool  { return l.level <= hclog.Warn && l.Logger.IsWarn() }
+func (l *leveledLogger) IsError() bool { return l.level <= hclog.Error && l.Logger.IsError() }
+
+func (l *leveledLogger) GetLevel() hclog.Level      { return l.level }
+func (l *leveledLogger) SetLevel(level hclog.Level) { l.level = level }
+
+func (l *leveledLogger) With(args ...interface{}) hclog.Logger {
+	return &leveledLogger{Logger: l.Logger.With(args...), level: l.level}
+}
+
+func (l *leveledLogger) Named(name string) hclog.Logger {
+	return &leveledLogger{Logger: l.Logger.Named(name), level: l.level}
+}
+
+func (l *leveledLogger) ResetNamed(name string) hclog.Logger {
+	return &leveledLogger{Logger: l.Logger.ResetNamed(name), level: l.level}
+}
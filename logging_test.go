@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// ─── log levels ───────────────────────────────────────────────────────────────
+
+func TestLogger_ComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	root := hclog.New(&hclog.LoggerOptions{Name: "plugin", Level: hclog.Trace, Output: &buf})
+
+	g := baseGroup(newMockSvc())
+	g.LogLevel = "warn"
+	g.LogLevels = map[string]string{logScaling: "debug"}
+	if err := g.parseLogLevels(); err != nil {
+		t.Fatal(err)
+	}
+	g.log = withLevel(root, g.logLevel)
+
+	g.log.Info("root info")
+	g.log.Warn("root warn")
+	g.logger(logScaling).Debug("scaling debug")
+	g.logger(logHeartbeat).Info("heartbeat info")
+	g.logger(logHeartbeat).Named("sub").Error("heartbeat error")
+
+	out := buf.String()
+	for _, want := range []string{"root warn", "plugin.scaling: scaling debug", "plugin.heartbeat.sub: heartbeat error"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output is missing %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"root info", "heartbeat info"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("log output contains filtered %q:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestValidate_LogLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		levels  map[string]string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "valid", level: "info", levels: map[string]string{logGC: "trace"}},
+		{name: "bad level", level: "loud", wantErr: true},
+		{name: "bad component", levels: map[string]string{"db": "debug"}, wantErr: true},
+		{name: "bad component level", levels: map[string]string{logAPI: "loud"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			g.LogLevel, g.LogLevels = tc.level, tc.levels
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstanceLoggers(t *testing.T) {
+	var buf bytes.Buffer
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		return nil, errors.New("boom")
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return nil, errors.New("api down")
+	}
+
+	g := baseGroup(mock)
+	g.log = hclog.New(&hclog.LoggerOptions{Output: &buf})
+	g.Increase(context.Background(), 1)
+	g.Heartbeat(context.Background(), "uuid-7")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, want := range []struct{ msg, field string }{
+		{"failed to create server", "hostname="},
+		{"heartbeat API error", "uuid=uuid-7"},
+	} {
+		found := false
+		for _, l := range lines {
+			if strings.Contains(l, want.msg) {
+				found = true
+				if !strings.Contains(l, want.field) {
+					t.Errorf("%q line lacks %s: %s", want.msg, want.field, l)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no %q line in:\n%s", want.msg, buf.String())
+		}
+	}
+}
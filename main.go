@@ -1,7 +1,23 @@
 package main
 
-import "gitlab.com/gitlab-org/fleeting/fleeting/plugin"
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/plugin"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(context.Background(), os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], secrets.redact(err.Error()))
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	plugin.Main(&InstanceGroup{}, Version)
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// Zone maintenance defaults.
+const (
+	defaultZoneMaintenancePause = 15 * time.Minute
+	maintenanceCheckInterval    = 5 * time.Minute
+	maintenanceCheckTimeout     = 30 * time.Second
+)
+
+// errZonePaused is returned instead of creating a server in a zone paused
+// for maintenance.
+var errZonePaused = errors.New("zone paused for maintenance")
+
+// zonePause records why and until when creations in a zone are paused.
+type zonePause struct {
+	until  time.Time
+	reason string
+}
+
+// isMaintenanceError reports whether err says the zone is down for
+// maintenance, going by its error code or title. Other 503 responses are
+// left to the retries.
+func isMaintenanceError(err error) bool {
+	var p *upcloud.Problem
+	if !errors.As(err, &p) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(p.ErrorCode()+" "+p.Title), "maintenance")
+}
+
+// pauseZone stops creations in zone until the given time. Pauses are only
+// ever extended, and logged when they start.
+func (g *InstanceGroup) pauseZone(zone string, until time.Time, reason string) {
+	g.zoneMu.Lock()
+	prev, paused := g.zonePauses[zone]
+	if paused && !until.After(prev.until) {
+		g.zoneMu.Unlock()
+		return
+	}
+	if g.zonePauses == nil {
+		g.zonePauses = make(map[string]zonePause)
+	}
+	g.zonePauses[zone] = zonePause{until: until, reason: reason}
+	g.zoneMu.Unlock()
+
+	if !paused {
+		g.logger(logScaling).Warn("pausing server creation in zone under maintenance",
+			"zone", zone, "until", until.Format(time.RFC3339), "reason", reason)
+	}
+}
+
+// zonePaused returns the pause of zone if one is in effect, dropping and
+// logging pauses that have run out.
+func (g *InstanceGroup) zonePaused(zone string) (zonePause, bool) {
+	g.zoneMu.Lock()
+	p, ok := g.zonePauses[zone]
+	expired := ok && !time.Now().Before(p.until)
+	if expired {
+		delete(g.zonePauses, zone)
+	}
+	g.zoneMu.Unlock()
+
+	if expired {
+		g.logger(logScaling).Info("resuming server creation in zone", "zone", zone)
+		return zonePause{}, false
+	}
+	return p, ok
+}
+
+// allZonesPaused reports whether every zone the group creates servers in is
+// paused, returning the pause of the primary zone.
+func (g *InstanceGroup) allZonesPaused() (zonePause, bool) {
+	var first zonePause
+	for i, zone := range g.zones() {
+		p, ok := g.zonePaused(zone)
+		if !ok {
+			return zonePause{}, false
+		}
+		if i == 0 {
+			first = p
+		}
+	}
+	return first, true
+}
+
+// statusMaintenances is the part of a Statuspage
+// /api/v2/scheduled-maintenances/active.json response the plugin reads.
+type statusMaintenances struct {
+	ScheduledMaintenances []struct {
+		Name           string    `json:"name"`
+		ScheduledUntil time.Time `json:"scheduled_until"`
+		Components     []struct {
+			Name string `json:"name"`
+		} `json:"components"`
+	} `json:"scheduled_maintenances"`
+}
+
+// maybeCheckMaintenance polls StatusPageURL in the background if the last
+// poll is at least maintenanceCheckInterval old. Update calls it on every
+// cycle.
+func (g *InstanceGroup) maybeCheckMaintenance() {
+	if g.StatusPageURL == "" {
+		return
+	}
+	g.zoneMu.Lock()
+	if time.Since(g.maintenanceCheckAt) < maintenanceCheckInterval {
+		g.zoneMu.Unlock()
+		return
+	}
+	g.maintenanceCheckAt = time.Now()
+	g.zoneMu.Unlock()
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		ctx, cancel := context.WithTimeout(g.probeContext(), maintenanceCheckTimeout)
+		defer cancel()
+		if err := g.checkMaintenance(ctx); err != nil {
+			g.logger(logScaling).Warn("failed to check the status page for maintenance", "error", err)
+		}
+	}()
+}
+
+// checkMaintenance pauses every zone named by an active maintenance on the
+// status page, in its title or affected components, until the maintenance
+// is scheduled to end.
+func (g *InstanceGroup) checkMaintenance(ctx context.Context) error {
+	url := strings.TrimSuffix(g.StatusPageURL, "/") + "/api/v2/scheduled-maintenances/active.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	var active statusMaintenances
+	if err := json.NewDecoder(resp.Body).Decode(&active); err != nil {
+		return fmt.Errorf("decoding %s: %w", url, err)
+	}
+
+	for _, m := range active.ScheduledMaintenances {
+		names := []string{m.Name}
+		for _, c := range m.Components {
+			names = append(names, c.Name)
+		}
+		until := m.ScheduledUntil
+		if until.Before(time.Now()) {
+			// Overrunning maintenance: check again at the next poll.
+			until = time.Now().Add(maintenanceCheckInterval)
+		}
+		for _, zone := range g.zones() {
+			if mentionsZone(names, zone) {
+				g.pauseZone(zone, until, "scheduled maintenance: "+m.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// mentionsZone reports whether any of names contains the zone ID.
+func mentionsZone(names []string, zone string) bool {
+	for _, n := range names {
+		if strings.Contains(strings.ToLower(n), strings.ToLower(zone)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── zone maintenance ─────────────────────────────────────────────────────────
+
+// underMaintenance is a problem reporting a zone down for maintenance.
+var underMaintenance = &upcloud.Problem{Status: 503, Type: "https://developers.upcloud.com/1.3/errors#ERROR_ZONE_MAINTENANCE", Title: "Zone is under maintenance."}
+
+func TestIncrease_PausesZoneUnderMaintenance(t *testing.T) {
+	var zones []string
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		zones = append(zones, r.Zone)
+		if r.Zone == "fi-hel1" {
+			return nil, underMaintenance
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FallbackZones = []string{"fi-hel2"}
+	g.CreateRetries = 3 // maintenance is not retried
+	g.ZoneMaintenancePause = Duration(time.Hour)
+	if n, err := g.Increase(context.Background(), 2); n != 2 {
+		t.Fatalf("Increase() = %d, %v, want 2", n, err)
+	}
+	if want := []string{"fi-hel1", "fi-hel2", "fi-hel2"}; !slices.Equal(zones, want) {
+		t.Errorf("zones tried = %v, want %v", zones, want)
+	}
+
+	// With the fallback paused too, nothing is attempted.
+	g.pauseZone("fi-hel2", time.Now().Add(time.Hour), "test")
+	zones = nil
+	if n, err := g.Increase(context.Background(), 1); n != 0 || err != nil || len(zones) != 0 {
+		t.Errorf("Increase() = %d, %v after trying %v, want 0, nil and no attempts", n, err, zones)
+	}
+}
+
+func TestZonePaused_Expires(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.pauseZone("fi-hel1", time.Now().Add(-time.Second), "over")
+	if _, paused := g.zonePaused("fi-hel1"); paused {
+		t.Error("zonePaused() = true for an expired pause")
+	}
+}
+
+func TestCheckMaintenance(t *testing.T) {
+	until := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/scheduled-maintenances/active.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"scheduled_maintenances": [
+			{"name": "Network maintenance", "scheduled_until": "` + until.Format(time.RFC3339) + `",
+			 "components": [{"name": "FI-HEL1 Helsinki"}]},
+			{"name": "DE-FRA1 storage upgrade", "scheduled_until": "` + until.Format(time.RFC3339) + `"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	g := baseGroup(newMockSvc())
+	g.FallbackZones = []string{"fi-hel2"}
+	g.StatusPageURL = srv.URL + "/"
+	if err := g.checkMaintenance(context.Background()); err != nil {
+		t.Fatalf("checkMaintenance() unexpected error: %v", err)
+	}
+	if p, paused := g.zonePaused("fi-hel1"); !paused || !p.until.Equal(until) {
+		t.Errorf("fi-hel1 pause = %+v (paused %v), want until %s", p, paused, until)
+	}
+	if _, paused := g.zonePaused("fi-hel2"); paused {
+		t.Error("fi-hel2 paused by maintenance of other zones")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// notInGroupError is returned when a server handed to the plugin does not
+// carry this group's label, e.g. after a UUID mix-up between runner managers.
+type notInGroupError struct {
+	UUID  string
+	Group string
+}
+
+func (e *notInGroupError) Error() string {
+	return fmt.Sprintf("server %s does not belong to group %s", e.UUID, e.Group)
+}
+
+// isMember reports whether labels mark a server as a member of this group:
+// they must carry the group label and every label_filters entry, the same
+// labels Update lists servers by.
+func (g *InstanceGroup) isMember(labels upcloud.LabelSlice) bool {
+	if v, ok := labelValueOf(labels, g.GroupLabelKey); !ok || v != g.Name {
+		return false
+	}
+	for k, want := range g.LabelFilters {
+		if v, ok := labelValueOf(labels, k); !ok || v != want {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMember returns a *notInGroupError unless the server uuid belongs to
+// this group by isMember, so ConnectInfo and Heartbeat never answer for a
+// server another manager with the same group name owns.
+func (g *InstanceGroup) checkMember(uuid string, details *upcloud.ServerDetails) error {
+	if !g.isMember(details.Labels) {
+		return &notInGroupError{UUID: uuid, Group: g.Name}
+	}
+	return nil
+}
+
+// deletableServer fetches a server and verifies it may be removed: it must
+// be a group member and must not carry the exclusion label.
+func (g *InstanceGroup) deletableServer(ctx context.Context, uuid string) (*upcloud.ServerDetails, error) {
+	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid})
+	if err != nil {
+		return nil, fmt.Errorf("getting server details for %s: %w", uuid, err)
+	}
+	if err := g.checkMember(uuid, details); err != nil {
+		return nil, fmt.Errorf("refusing to remove server: %w", err)
+	}
+	if g.isExcluded(details.Labels) {
+		return nil, fmt.Errorf("refusing to remove server %s: %w", uuid, errExcluded)
+	}
+	return details, nil
+}
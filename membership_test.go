@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── group membership ─────────────────────────────────────────────────────────
+
+func TestDecrease_RefusesForeignServer(t *testing.T) {
+	for name, labels := range map[string]upcloud.LabelSlice{
+		"unlabelled":  nil,
+		"other group": {{Key: groupLabelKey, Value: "someone-else"}},
+		// Same group name under another manager's label_filters.
+		"other environment": {{Key: groupLabelKey, Value: "test-group"}, {Key: "env", Value: "staging"}},
+		"missing filter":    {{Key: groupLabelKey, Value: "test-group"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+				return &upcloud.ServerDetails{Labels: labels}, nil
+			}
+			// Any stop, label or delete call panics in the mock.
+
+			g := baseGroup(mock)
+			g.LabelFilters = map[string]string{"env": "prod"}
+			g.own("uuid-foreign")
+			succeeded, err := g.Decrease(context.Background(), []string{"uuid-foreign"})
+			var notOurs *notInGroupError
+			if !errors.As(err, &notOurs) || notOurs.UUID != "uuid-foreign" {
+				t.Errorf("Decrease() error = %v, want notInGroupError", err)
+			}
+			if len(succeeded) != 0 {
+				t.Errorf("Decrease() succeeded = %v, want none", succeeded)
+			}
+			if g.isDeleting("uuid-foreign") {
+				t.Error("server left marked as deleting")
+			}
+			if _, ok := g.desired["uuid-foreign"]; !ok {
+				t.Error("refused server dropped from the desired set")
+			}
+		})
+	}
+}
+
+func TestDecrease_RefusesWhenLookupFails(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return nil, errors.New("api error")
+	}
+
+	g := baseGroup(mock)
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err == nil {
+		t.Error("Decrease() expected error when membership cannot be verified, got nil")
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
+
+func TestConnectInfoAndHeartbeat_RejectForeignServer(t *testing.T) {
+	for name, labels := range map[string]upcloud.LabelSlice{
+		"other group":       {{Key: groupLabelKey, Value: "someone-else"}, {Key: "env", Value: "prod"}},
+		"other environment": {{Key: groupLabelKey, Value: "test-group"}, {Key: "env", Value: "staging"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+				d := makeDetails("1.2.3.4", "")
+				d.Labels = labels
+				return d, nil
+			}
+
+			g := baseGroup(mock)
+			g.LabelFilters = map[string]string{"env": "prod"}
+			var notOurs *notInGroupError
+			if _, err := g.ConnectInfo(context.Background(), "uuid-foreign"); !errors.As(err, &notOurs) {
+				t.Errorf("ConnectInfo() error = %v, want notInGroupError", err)
+			}
+			if err := g.Heartbeat(context.Background(), "uuid-foreign"); !errors.As(err, &notOurs) {
+				t.Errorf("Heartbeat() error = %v, want notInGroupError", err)
+			}
+		})
+	}
+}
+
+func TestDecrease_KeepsDesiredWhenDeleteFails(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", ""), nil
+	}
+	mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(context.Context, *request.DeleteServerAndStoragesRequest) error {
+		return errors.New("api error")
+	}
+
+	g := baseGroup(mock)
+	g.own("uuid-1")
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err == nil {
+		t.Fatal("Decrease() expected error, got nil")
+	}
+	if _, ok := g.desired["uuid-1"]; !ok {
+		t.Error("server that failed to delete dropped from the desired set")
+	}
+
+	mock.deleteServerAndStorages = func(context.Context, *request.DeleteServerAndStoragesRequest) error { return nil }
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	if _, ok := g.desired["uuid-1"]; ok {
+		t.Error("removed server still in the desired set")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// defaultStatsDPrefix namespaces every metric name.
+const defaultStatsDPrefix = "fleeting_upcloud"
+
+// statsd emits metrics to a StatsD or DogStatsD agent. Sends are
+// fire-and-forget datagrams, so an absent agent never slows the plugin
+// down. A nil *statsd discards everything.
+type statsd struct {
+	conn   net.Conn
+	prefix string
+	// tags are appended in DogStatsD format; nil for plain StatsD, which
+	// has no tag support.
+	tags []string
+	log  hclog.Logger
+}
+
+// newStatsd connects to address: "host:port" for UDP, or "unix:///path" for
+// a DogStatsD Unix domain socket.
+func newStatsd(address, prefix string, tags []string, log hclog.Logger) (*statsd, error) {
+	network := "udp"
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		network, address = "unixgram", path
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to StatsD at %s: %w", address, err)
+	}
+	return &statsd{conn: conn, prefix: prefix, tags: tags, log: log}, nil
+}
+
+// initMetrics sets up the StatsD emitter if statsd_address is set.
+func (g *InstanceGroup) initMetrics() error {
+	if g.StatsDAddress == "" {
+		return nil
+	}
+	var tags []string
+	if g.DogStatsD {
+		tags = append([]string{"group:" + g.Name, "zone:" + g.Zone}, g.StatsDTags...)
+	}
+	m, err := newStatsd(g.StatsDAddress, g.StatsDPrefix, tags, g.log.Named("metrics"))
+	if err != nil {
+		return err
+	}
+	g.metrics = m
+	return nil
+}
+
+// count adds n to a counter.
+func (s *statsd) count(name string, n int64) {
+	s.send(name, fmt.Sprint(n), "c")
+}
+
+// gauge sets a gauge.
+func (s *statsd) gauge(name string, v float64) {
+	s.send(name, fmt.Sprint(v), "g")
+}
+
+// timing records a duration in milliseconds.
+func (s *statsd) timing(name string, d time.Duration) {
+	s.send(name, fmt.Sprint(d.Milliseconds()), "ms")
+}
+
+func (s *statsd) send(name, value, kind string) {
+	if s == nil {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s.%s:%s|%s", s.prefix, name, value, kind)
+	if len(s.tags) > 0 {
+		fmt.Fprintf(&sb, "|#%s", strings.Join(s.tags, ","))
+	}
+	if _, err := s.conn.Write([]byte(sb.String())); err != nil {
+		s.log.Debug("sending metric failed", "metric", name, "error", err)
+	}
+}
+
+func (s *statsd) close() {
+	if s != nil {
+		s.conn.Close()
+	}
+}
+
+// instanceStates are the provider states reported as instance gauges.
+var instanceStates = []provider.State{
+	provider.StateCreating,
+	provider.StateRunning,
+	provider.StateDeleting,
+	provider.StateDeleted,
+}
+
+// gaugeInstances reports how many instances Update found in each state.
+func (g *InstanceGroup) gaugeInstances(counts map[provider.State]int) {
+	for _, state := range instanceStates {
+		g.metrics.gauge("instances."+string(state), float64(counts[state]))
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── StatsD metrics ───────────────────────────────────────────────────────────
+
+// statsdListener returns a UDP address and a function reading the
+// datagrams received so far.
+func statsdListener(t *testing.T) (string, func() []string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() []string {
+		var got []string
+		buf := make([]byte, 1024)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return got
+			}
+			got = append(got, string(buf[:n]))
+		}
+	}
+}
+
+func TestMetrics_Update(t *testing.T) {
+	addr, received := statsdListener(t)
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "a", State: upcloud.ServerStateStarted},
+			{UUID: "b", State: upcloud.ServerStateStarted},
+			{UUID: "c", State: upcloud.ServerStateMaintenance},
+		}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.StatsDAddress, g.StatsDPrefix, g.DogStatsD, g.StatsDTags = addr, "fu", true, []string{"env:test"}
+	if err := g.initMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.metrics.close()
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatal(err)
+	}
+	g.notify(eventInstanceCreated, "a", "h", nil)
+
+	got := received()
+	tags := "|#group:" + g.Name + ",zone:" + g.Zone + ",env:test"
+	for _, want := range []string{
+		"fu.instances.running:2|g" + tags,
+		"fu.instances.creating:1|g" + tags,
+		"fu.instances.deleted:0|g" + tags,
+		"fu.events.instance_created:1|c" + tags,
+	} {
+		if !slices.Contains(got, want) {
+			t.Errorf("metric %q not sent; got:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestMetrics_PlainStatsD(t *testing.T) {
+	addr, received := statsdListener(t)
+	m, err := newStatsd(addr, "fu", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.close()
+	m.timing("op", 1500*time.Millisecond)
+
+	if got := received(); len(got) != 1 || got[0] != "fu.op:1500|ms" {
+		t.Errorf("sent %q, want [fu.op:1500|ms]", got)
+	}
+}
+
+func TestMetrics_Disabled(t *testing.T) {
+	var m *statsd
+	m.count("x", 1) // must not panic
+	m.close()
+}
+
+func TestMetrics_OperationDurations(t *testing.T) {
+	addr, received := statsdListener(t)
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "new"}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.StatsDAddress, g.StatsDPrefix = addr, "fu"
+	if err := g.initMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.metrics.close()
+	if n, err := g.Increase(context.Background(), 1); n != 1 || err != nil {
+		t.Fatalf("Increase() = (%d, %v)", n, err)
+	}
+	g.markRunning("new")
+	g.markRunning("new")
+
+	got := received()
+	for _, prefix := range []string{"fu.ops.increase:", "fu.ops.increase.ok:1|c", "fu.instances.create_request:", "fu.instances.time_to_running:"} {
+		n := 0
+		for _, m := range got {
+			if strings.HasPrefix(m, prefix) {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("metric %q sent %d times, want once; got:\n%s", prefix, n, strings.Join(got, "\n"))
+		}
+	}
+}
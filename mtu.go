@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// Bounds for private_mtu. The API has no MTU setting, so the value is
+// applied inside the guest.
+const (
+	minPrivateMTU = 1280
+	maxPrivateMTU = 9000
+)
+
+// mtuUserData returns a cloud-config part that sets private_mtu on the
+// private network interfaces at every boot. Guests see NICs in PCI slot
+// order, which follows the interface index given at creation, so the
+// private interfaces are picked by position rather than by name.
+func (g *InstanceGroup) mtuUserData() string {
+	var positions []string
+	for _, iface := range g.networking().Interfaces {
+		if iface.Type == upcloud.NetworkTypePrivate {
+			positions = append(positions, fmt.Sprint(iface.Index))
+		}
+	}
+	if g.PrivateMTU == 0 || len(positions) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#cloud-config\nbootcmd:\n  - |\n")
+	sb.WriteString("    n=0\n")
+	sb.WriteString("    for dev in $(for d in /sys/class/net/*/device; do echo \"$(readlink -f \"$d\") ${d%/device}\"; done | sort | cut -d' ' -f2); do\n")
+	sb.WriteString("      n=$((n+1))\n")
+	fmt.Fprintf(&sb, "      case \" %s \" in *\" $n \"*) ip link set dev \"${dev##*/}\" mtu %d ;; esac\n", strings.Join(positions, " "), g.PrivateMTU)
+	sb.WriteString("    done\n")
+	return sb.String()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// Accepted values for nat_gateway.
+const (
+	natGatewayRequire = "require"
+	natGatewayCreate  = "create"
+)
+
+var validNATGatewayModes = []string{natGatewayRequire, natGatewayCreate}
+
+// ensureNATGateway checks that the primary private network gives instances outbound
+// internet access through a NAT gateway: the network needs a router, a
+// default route handed out by DHCP, and a started gateway with the NAT
+// feature on that router. In "create" mode missing pieces are provisioned.
+func (g *InstanceGroup) ensureNATGateway(ctx context.Context) error {
+	if g.NATGateway == "" {
+		return nil
+	}
+	create := g.NATGateway == natGatewayCreate
+	primary := g.primaryPrivateNetwork()
+
+	network, err := g.svc.GetNetworkDetails(ctx, &request.GetNetworkDetailsRequest{UUID: primary})
+	if err != nil {
+		return fmt.Errorf("getting private network %s: %w", primary, err)
+	}
+	for _, ipn := range network.IPNetworks {
+		if ipn.Family == upcloud.IPAddressFamilyIPv4 && !ipn.DHCPDefaultRoute.Bool() {
+			return fmt.Errorf("private network %s does not hand out a default route over DHCP; enable dhcp_default_route so instances can reach the internet", primary)
+		}
+	}
+
+	router := network.Router
+	if router == "" {
+		if !create {
+			return fmt.Errorf("private network %s has no router, so instances have no outbound internet access; attach a router with a NAT gateway or set nat_gateway = %q", primary, natGatewayCreate)
+		}
+		if router, err = g.createRouter(ctx, primary); err != nil {
+			return err
+		}
+	}
+
+	gateways, err := g.svc.GetGateways(ctx)
+	if err != nil {
+		return fmt.Errorf("listing network gateways: %w", err)
+	}
+	for _, gw := range gateways {
+		if !slices.Contains(gw.Features, upcloud.GatewayFeatureNAT) || !gatewayOnRouter(gw, router) {
+			continue
+		}
+		if gw.ConfiguredStatus != upcloud.GatewayConfiguredStatusStarted {
+			return fmt.Errorf("NAT gateway %s for private network %s is %s", gw.UUID, primary, gw.ConfiguredStatus)
+		}
+		g.log.Debug("found NAT gateway", "gateway", gw.UUID, "router", router)
+		return nil
+	}
+
+	if !create {
+		return fmt.Errorf("router %s of private network %s has no NAT gateway, so instances have no outbound internet access; create one or set nat_gateway = %q", router, primary, natGatewayCreate)
+	}
+	gw, err := g.svc.CreateGateway(ctx, &request.CreateGatewayRequest{
+		Name:             g.Name + "-nat",
+		Zone:             g.Zone,
+		Features:         []upcloud.GatewayFeature{upcloud.GatewayFeatureNAT},
+		Routers:          []request.GatewayRouter{{UUID: router}},
+		ConfiguredStatus: upcloud.GatewayConfiguredStatusStarted,
+		Labels:           []upcloud.Label{{Key: g.GroupLabelKey, Value: g.Name}},
+	})
+	if err != nil {
+		return fmt.Errorf("creating NAT gateway: %w", err)
+	}
+	g.log.Info("created NAT gateway", "gateway", gw.UUID, "router", router, "network", primary)
+	return nil
+}
+
+// createRouter creates a router for the group and attaches it to network,
+// returning its UUID.
+func (g *InstanceGroup) createRouter(ctx context.Context, network string) (string, error) {
+	router, err := g.newRouter(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = g.svc.AttachNetworkRouter(ctx, &request.AttachNetworkRouterRequest{
+		NetworkUUID: network,
+		RouterUUID:  router,
+	})
+	if err != nil {
+		return "", fmt.Errorf("attaching router %s to private network %s: %w", router, network, err)
+	}
+	return router, nil
+}
+
+// newRouter creates a router labelled with the group and returns its UUID.
+func (g *InstanceGroup) newRouter(ctx context.Context) (string, error) {
+	router, err := g.svc.CreateRouter(ctx, &request.CreateRouterRequest{
+		Name:   g.Name + "-router",
+		Labels: []upcloud.Label{{Key: g.GroupLabelKey, Value: g.Name}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating router: %w", err)
+	}
+	g.log.Info("created router", "router", router.UUID)
+	return router.UUID, nil
+}
+
+// gatewayOnRouter reports whether gw serves router.
+func gatewayOnRouter(gw upcloud.Gateway, router string) bool {
+	for _, r := range gw.Routers {
+		if r.UUID == router {
+			return true
+		}
+	}
+	return false
+}
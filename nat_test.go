@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── NAT gateway ──────────────────────────────────────────────────────────────
+
+// natMock returns a mock private network attached to router (none if empty)
+// and the given gateways.
+func natMock(router string, gateways ...upcloud.Gateway) *mockSvc {
+	mock := newMockSvc()
+	mock.getNetworkDetails = func(_ context.Context, r *request.GetNetworkDetailsRequest) (*upcloud.Network, error) {
+		return &upcloud.Network{
+			UUID:   r.UUID,
+			Router: router,
+			IPNetworks: upcloud.IPNetworkSlice{
+				{Family: upcloud.IPAddressFamilyIPv4, Address: "10.0.0.0/24", DHCPDefaultRoute: upcloud.True},
+			},
+		}, nil
+	}
+	mock.getGateways = func(context.Context, ...request.QueryFilter) ([]upcloud.Gateway, error) {
+		return gateways, nil
+	}
+	return mock
+}
+
+func natGroup(mock *mockSvc, mode string) *InstanceGroup {
+	g := baseGroup(mock)
+	g.UsePrivateNetwork = true
+	g.PrivateNetwork = "net-uuid"
+	g.NATGateway = mode
+	return g
+}
+
+func TestEnsureNATGateway_Require(t *testing.T) {
+	natGW := upcloud.Gateway{
+		UUID:             "gw-uuid",
+		Features:         []upcloud.GatewayFeature{upcloud.GatewayFeatureNAT},
+		Routers:          []upcloud.GatewayRouter{{UUID: "router-uuid"}},
+		ConfiguredStatus: upcloud.GatewayConfiguredStatusStarted,
+	}
+	stopped := natGW
+	stopped.ConfiguredStatus = "stopped"
+	vpnOnly := natGW
+	vpnOnly.Features = []upcloud.GatewayFeature{upcloud.GatewayFeatureVPN}
+
+	tests := []struct {
+		name    string
+		mock    *mockSvc
+		wantErr string
+	}{
+		{name: "gateway present", mock: natMock("router-uuid", natGW)},
+		{name: "no router", mock: natMock(""), wantErr: "has no router"},
+		{name: "no gateway", mock: natMock("router-uuid", vpnOnly), wantErr: "has no NAT gateway"},
+		{name: "gateway on another router", mock: natMock("other-router", natGW), wantErr: "has no NAT gateway"},
+		{name: "gateway stopped", mock: natMock("router-uuid", stopped), wantErr: "is stopped"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := natGroup(tc.mock, natGatewayRequire).ensureNATGateway(context.Background())
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ensureNATGateway() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("ensureNATGateway() error = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnsureNATGateway_NoDefaultRoute(t *testing.T) {
+	mock := natMock("router-uuid")
+	mock.getNetworkDetails = func(context.Context, *request.GetNetworkDetailsRequest) (*upcloud.Network, error) {
+		return &upcloud.Network{IPNetworks: upcloud.IPNetworkSlice{{Family: upcloud.IPAddressFamilyIPv4, DHCPDefaultRoute: upcloud.False}}}, nil
+	}
+	err := natGroup(mock, natGatewayCreate).ensureNATGateway(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "default route") {
+		t.Fatalf("ensureNATGateway() error = %v, want default route error", err)
+	}
+}
+
+func TestEnsureNATGateway_Create(t *testing.T) {
+	mock := natMock("")
+	var attached *request.AttachNetworkRouterRequest
+	var created *request.CreateGatewayRequest
+	mock.createRouter = func(context.Context, *request.CreateRouterRequest) (*upcloud.Router, error) {
+		return &upcloud.Router{UUID: "new-router"}, nil
+	}
+	mock.attachNetworkRouter = func(_ context.Context, r *request.AttachNetworkRouterRequest) error {
+		attached = r
+		return nil
+	}
+	mock.createGateway = func(_ context.Context, r *request.CreateGatewayRequest) (*upcloud.Gateway, error) {
+		created = r
+		return &upcloud.Gateway{UUID: "new-gw"}, nil
+	}
+
+	if err := natGroup(mock, natGatewayCreate).ensureNATGateway(context.Background()); err != nil {
+		t.Fatalf("ensureNATGateway() unexpected error: %v", err)
+	}
+	if attached == nil || attached.NetworkUUID != "net-uuid" || attached.RouterUUID != "new-router" {
+		t.Errorf("AttachNetworkRouter request = %+v", attached)
+	}
+	if created == nil || created.Zone != "fi-hel1" || len(created.Routers) != 1 || created.Routers[0].UUID != "new-router" ||
+		len(created.Features) != 1 || created.Features[0] != upcloud.GatewayFeatureNAT {
+		t.Errorf("CreateGateway request = %+v", created)
+	}
+	if v, _ := labelValue(created.Labels, groupLabelKey); v != "test-group" {
+		t.Errorf("gateway group label = %q, want test-group", v)
+	}
+}
+
+func TestValidate_NATGateway(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "with private network", mod: func(g *InstanceGroup) {
+			g.NATGateway, g.UsePrivateNetwork, g.PrivateNetwork, g.PrivateOnly = natGatewayRequire, true, "net", true
+		}},
+		{name: "without private network", mod: func(g *InstanceGroup) { g.NATGateway = natGatewayCreate }, wantErr: true},
+		{name: "without private only", mod: func(g *InstanceGroup) {
+			g.NATGateway, g.UsePrivateNetwork, g.PrivateNetwork = natGatewayRequire, true, "net"
+		}, wantErr: true},
+		{name: "unknown mode", mod: func(g *InstanceGroup) {
+			g.NATGateway, g.UsePrivateNetwork, g.PrivateNetwork, g.PrivateOnly = "yes", true, "net", true
+		}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
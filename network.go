@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// Interface kinds accepted in interface_order.
+const (
+	interfacePublic  = "public"
+	interfacePrivate = "private"
+	interfaceUtility = "utility"
+)
+
+// Accepted values for public_ip_family.
+const (
+	publicIPFamilyIPv4 = "ipv4"
+	publicIPFamilyIPv6 = "ipv6"
+	publicIPFamilyDual = "dual"
+)
+
+var validPublicIPFamilies = []string{publicIPFamilyIPv4, publicIPFamilyIPv6, publicIPFamilyDual}
+
+// publicAddresses returns the addresses requested on the public interface.
+func (g *InstanceGroup) publicAddresses() request.CreateServerIPAddressSlice {
+	switch g.PublicIPFamily {
+	case publicIPFamilyIPv6:
+		return request.CreateServerIPAddressSlice{{Family: upcloud.IPAddressFamilyIPv6}}
+	case publicIPFamilyDual:
+		return request.CreateServerIPAddressSlice{{Family: upcloud.IPAddressFamilyIPv4}, {Family: upcloud.IPAddressFamilyIPv6}}
+	default:
+		return request.CreateServerIPAddressSlice{{Family: upcloud.IPAddressFamilyIPv4}}
+	}
+}
+
+// defaultInterfaceOrder is the interface layout unless interface_order says
+// otherwise.
+var defaultInterfaceOrder = []string{interfacePublic, interfacePrivate, interfaceUtility}
+
+// interfaceOrder returns the order of interface kinds on new servers:
+// interface_order first, then any remaining kinds in the default order.
+func (g *InstanceGroup) interfaceOrder() []string {
+	order := slices.Clone(g.InterfaceOrder)
+	for _, kind := range defaultInterfaceOrder {
+		if !slices.Contains(order, kind) {
+			order = append(order, kind)
+		}
+	}
+	return order
+}
+
+// networking builds the network interface layout for a new server.
+// The public interface is omitted entirely in private-only mode so the
+// instance is never reachable from the internet. Interfaces are numbered
+// explicitly, since guest images pick their default route by index.
+func (g *InstanceGroup) networking() *request.CreateServerNetworking {
+	networking := &request.CreateServerNetworking{}
+
+	for _, kind := range g.interfaceOrder() {
+		switch kind {
+		case interfacePublic:
+			if !g.PrivateOnly {
+				networking.Interfaces = append(networking.Interfaces, request.CreateServerInterface{
+					IPAddresses: g.publicAddresses(),
+					Type:        upcloud.NetworkTypePublic,
+				})
+			}
+		case interfacePrivate:
+			if g.UsePrivateNetwork {
+				networks := g.privateNetworks()
+				if len(networks) == 0 {
+					networks = []string{""}
+				}
+				for _, network := range networks {
+					networking.Interfaces = append(networking.Interfaces, request.CreateServerInterface{
+						IPAddresses: request.CreateServerIPAddressSlice{
+							{Family: upcloud.IPAddressFamilyIPv4},
+						},
+						Type:    upcloud.NetworkTypePrivate,
+						Network: network,
+					})
+				}
+			}
+		case interfaceUtility:
+			if g.UseUtilityNetwork {
+				networking.Interfaces = append(networking.Interfaces, request.CreateServerInterface{
+					IPAddresses: request.CreateServerIPAddressSlice{
+						{Family: upcloud.IPAddressFamilyIPv4},
+					},
+					Type: upcloud.NetworkTypeUtility,
+				})
+			}
+		}
+	}
+
+	for i := range networking.Interfaces {
+		networking.Interfaces[i].Index = i + 1
+	}
+	return networking
+}
+
+// privateNetworks returns the SDN private networks new servers join, in
+// interface order: private_network first, then private_networks.
+func (g *InstanceGroup) privateNetworks() []string {
+	var networks []string
+	if g.PrivateNetwork != "" {
+		networks = append(networks, g.PrivateNetwork)
+	}
+	for _, n := range g.PrivateNetworks {
+		if !slices.Contains(networks, n) {
+			networks = append(networks, n)
+		}
+	}
+	return networks
+}
+
+// primaryPrivateNetwork returns the private network used to connect to
+// instances, or "" if none is configured.
+func (g *InstanceGroup) primaryPrivateNetwork() string {
+	if networks := g.privateNetworks(); len(networks) > 0 {
+		return networks[0]
+	}
+	return ""
+}
+
+// primaryPrivateAddress returns the IPv4 address of the server's interface on
+// the primary private network, if it has one. With several private networks
+// attached, this keeps the runner on the network meant for it.
+func (g *InstanceGroup) primaryPrivateAddress(details *upcloud.ServerDetails) string {
+	primary := g.primaryPrivateNetwork()
+	if primary == "" {
+		return ""
+	}
+	for _, iface := range details.Networking.Interfaces {
+		if iface.Type != upcloud.NetworkTypePrivate || iface.Network != primary {
+			continue
+		}
+		for _, ip := range iface.IPAddresses {
+			if ip.Family == upcloud.IPAddressFamilyIPv4 {
+				return ip.Address
+			}
+		}
+	}
+	return ""
+}
+
+// Accepted values for prefer_address.
+const (
+	preferPublicIPv4 = "public_ipv4"
+	preferPublicIPv6 = "public_ipv6"
+	preferPrivate    = "private"
+	preferUtility    = "utility"
+)
+
+var validPreferAddresses = []string{preferPublicIPv4, preferPublicIPv6, preferPrivate, preferUtility}
+
+// connectAddresses picks the external and internal addresses reported in
+// ConnectInfo. A floating IP takes precedence over the server's own public
+// IPv4 address, and the SDN private address over the utility one.
+func (g *InstanceGroup) connectAddresses(details *upcloud.ServerDetails) (external, internal string) {
+	floating := false
+	var publicV4, publicV6, private, utility string
+	for _, ip := range details.IPAddresses {
+		if ip.Family == upcloud.IPAddressFamilyIPv6 {
+			if ip.Access == upcloud.IPAddressAccessPublic && publicV6 == "" {
+				publicV6 = ip.Address
+			}
+			continue
+		}
+		if ip.Family != upcloud.IPAddressFamilyIPv4 {
+			continue
+		}
+		switch ip.Access {
+		case upcloud.IPAddressAccessPublic:
+			if floating {
+				continue
+			}
+			publicV4 = ip.Address
+			floating = ip.Floating.Bool()
+		case upcloud.IPAddressAccessPrivate:
+			private = ip.Address
+		case upcloud.IPAddressAccessUtility:
+			utility = ip.Address
+		}
+	}
+	if addr := g.primaryPrivateAddress(details); addr != "" {
+		private = addr
+	}
+
+	// The utility network is only used when there is no SDN private address.
+	internal = private
+	if internal == "" {
+		internal = utility
+	}
+
+	switch g.PreferAddress {
+	case preferPublicIPv4:
+		external = publicV4
+	case preferPublicIPv6:
+		external = publicV6
+	case preferPrivate:
+		external = private
+	case preferUtility:
+		external = utility
+	}
+	if external != "" {
+		return external, internal
+	}
+
+	// A public IPv6 address is only used when there is no public IPv4 one.
+	external = publicV4
+	if external == "" {
+		external = publicV6
+	}
+	// Private-only servers have no external address at all, so the runner has
+	// to dial the internal one.
+	if (g.UsePrivateNetwork || g.PrivateOnly) && internal != "" {
+		external = internal
+	}
+	return external, internal
+}
+
+// privateNetworkName returns the name of the SDN network created from
+// private_network_cidr.
+func (g *InstanceGroup) privateNetworkName() string {
+	if g.PrivateNetworkName != "" {
+		return g.PrivateNetworkName
+	}
+	return g.Name + "-network"
+}
+
+// ensurePrivateNetwork resolves the private network when only
+// private_network_cidr is configured: an existing private network with the
+// configured name in the zone is reused, otherwise one is created together
+// with a router. PrivateNetwork holds the UUID afterwards.
+func (g *InstanceGroup) ensurePrivateNetwork(ctx context.Context) error {
+	if g.PrivateNetwork != "" || g.PrivateNetworkCIDR == "" {
+		return nil
+	}
+	name := g.privateNetworkName()
+
+	networks, err := g.svc.GetNetworksInZone(ctx, &request.GetNetworksInZoneRequest{Zone: g.Zone})
+	if err != nil {
+		return fmt.Errorf("listing networks in %s: %w", g.Zone, err)
+	}
+	for _, n := range networks.Networks {
+		if n.Type == upcloud.NetworkTypePrivate && n.Name == name {
+			g.log.Debug("using existing private network", "network", n.UUID, "name", name)
+			g.PrivateNetwork = n.UUID
+			return nil
+		}
+	}
+
+	router, err := g.newRouter(ctx)
+	if err != nil {
+		return err
+	}
+	network, err := g.svc.CreateNetwork(ctx, &request.CreateNetworkRequest{
+		Name:   name,
+		Zone:   g.Zone,
+		Router: router,
+		IPNetworks: upcloud.IPNetworkSlice{{
+			Address: g.PrivateNetworkCIDR,
+			Family:  upcloud.IPAddressFamilyIPv4,
+			DHCP:    upcloud.True,
+			// Servers with a public interface keep their default route there.
+			DHCPDefaultRoute: upcloud.FromBool(g.PrivateOnly),
+		}},
+		Labels: []upcloud.Label{{Key: g.GroupLabelKey, Value: g.Name}},
+	})
+	if err != nil {
+		return fmt.Errorf("creating private network %s: %w", name, err)
+	}
+	g.log.Info("created private network", "network", network.UUID, "name", name, "cidr", g.PrivateNetworkCIDR, "router", router)
+	g.PrivateNetwork = network.UUID
+	return nil
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── networking ───────────────────────────────────────────────────────────────
+
+func interfaceTypes(n *request.CreateServerNetworking) []string {
+	var types []string
+	for _, iface := range n.Interfaces {
+		types = append(types, iface.Type)
+	}
+	return types
+}
+
+func TestNetworking(t *testing.T) {
+	tests := []struct {
+		name    string
+		private bool
+		utility bool
+		only    bool
+		order   []string
+		want    []string
+	}{
+		{name: "public only", want: []string{"public"}},
+		{name: "public and private", private: true, want: []string{"public", "private"}},
+		{name: "public and utility", utility: true, want: []string{"public", "utility"}},
+		{name: "private only", private: true, only: true, want: []string{"private"}},
+		{name: "private and utility only", private: true, utility: true, only: true, want: []string{"private", "utility"}},
+		{name: "private first", private: true, utility: true, order: []string{"private"}, want: []string{"private", "public", "utility"}},
+		{name: "full order", private: true, utility: true, order: []string{"utility", "private", "public"}, want: []string{"utility", "private", "public"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := baseGroup(newMockSvc())
+			g.UsePrivateNetwork = tc.private
+			g.UseUtilityNetwork = tc.utility
+			g.PrivateOnly = tc.only
+			g.InterfaceOrder = tc.order
+
+			n := g.networking()
+			for i, iface := range n.Interfaces {
+				if iface.Index != i+1 {
+					t.Errorf("interface %d has index %d, want %d", i, iface.Index, i+1)
+				}
+			}
+			got := interfaceTypes(n)
+			if len(got) != len(tc.want) {
+				t.Fatalf("interfaces = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("interfaces = %v, want %v", got, tc.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestValidate_InterfaceOrder(t *testing.T) {
+	for _, order := range [][]string{{"public", "wan"}, {"private", "private"}} {
+		g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", InterfaceOrder: order}
+		if err := g.validate(); err == nil {
+			t.Errorf("validate() with interface_order %v: expected error, got nil", order)
+		}
+	}
+}
+
+func TestNetworking_PrivateNetworkUUID(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UsePrivateNetwork = true
+	g.PrivateNetwork = "net-uuid"
+
+	n := g.networking()
+	if got := n.Interfaces[1].Network; got != "net-uuid" {
+		t.Errorf("private interface Network = %q, want net-uuid", got)
+	}
+}
+
+func TestNetworking_MultiplePrivateNetworks(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UsePrivateNetwork = true
+	g.PrivateNetwork = "net-ci"
+	g.PrivateNetworks = []string{"net-db", "net-ci"}
+
+	var networks []string
+	for _, iface := range g.networking().Interfaces[1:] {
+		networks = append(networks, iface.Network)
+	}
+	if len(networks) != 2 || networks[0] != "net-ci" || networks[1] != "net-db" {
+		t.Errorf("private interface networks = %v, want [net-ci net-db]", networks)
+	}
+}
+
+func TestConnectInfo_PrimaryPrivateNetwork(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		ci := upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPrivate, Address: "10.0.0.5"}
+		db := upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessPrivate, Address: "10.9.0.5"}
+		d.IPAddresses = upcloud.IPAddressSlice{ci, db}
+		d.Networking.Interfaces = upcloud.ServerInterfaceSlice{
+			{Type: upcloud.NetworkTypePrivate, Network: "net-ci", IPAddresses: upcloud.IPAddressSlice{ci}},
+			{Type: upcloud.NetworkTypePrivate, Network: "net-db", IPAddresses: upcloud.IPAddressSlice{db}},
+		}
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.UsePrivateNetwork = true
+	g.PrivateNetworks = []string{"net-ci", "net-db"}
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.InternalAddr != "10.0.0.5" {
+		t.Errorf("InternalAddr = %q, want the address on the first network, 10.0.0.5", info.InternalAddr)
+	}
+}
+
+func TestNetworking_PublicIPFamily(t *testing.T) {
+	tests := []struct {
+		family string
+		want   []string
+	}{
+		{family: "", want: []string{upcloud.IPAddressFamilyIPv4}},
+		{family: publicIPFamilyIPv6, want: []string{upcloud.IPAddressFamilyIPv6}},
+		{family: publicIPFamilyDual, want: []string{upcloud.IPAddressFamilyIPv4, upcloud.IPAddressFamilyIPv6}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.family, func(t *testing.T) {
+			g := baseGroup(newMockSvc())
+			g.PublicIPFamily = tc.family
+
+			var got []string
+			for _, ip := range g.networking().Interfaces[0].IPAddresses {
+				got = append(got, ip.Family)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("public interface families = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConnectInfo_IPv6Only(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.IPAddresses = upcloud.IPAddressSlice{
+			{Family: upcloud.IPAddressFamilyIPv6, Access: upcloud.IPAddressAccessPublic, Address: "2a04:3540:1000:310::1"},
+		}
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.PublicIPFamily = publicIPFamilyIPv6
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.ExternalAddr != "2a04:3540:1000:310::1" {
+		t.Errorf("ExternalAddr = %q, want the public IPv6 address", info.ExternalAddr)
+	}
+}
+
+func TestConnectAddresses_PreferAddress(t *testing.T) {
+	details := makeDetails("1.2.3.4", "10.0.0.5")
+	details.IPAddresses = append(details.IPAddresses,
+		upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv6, Access: upcloud.IPAddressAccessPublic, Address: "2a04::1"},
+		upcloud.IPAddress{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessUtility, Address: "10.1.0.7"},
+	)
+
+	tests := []struct {
+		prefer     string
+		usePrivate bool
+		want       string
+	}{
+		{prefer: "", want: "1.2.3.4"},
+		{prefer: "", usePrivate: true, want: "10.0.0.5"},
+		{prefer: preferPublicIPv4, usePrivate: true, want: "1.2.3.4"},
+		{prefer: preferPublicIPv6, want: "2a04::1"},
+		{prefer: preferPrivate, want: "10.0.0.5"},
+		{prefer: preferUtility, want: "10.1.0.7"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.prefer, func(t *testing.T) {
+			g := baseGroup(newMockSvc())
+			g.PreferAddress = tc.prefer
+			g.UsePrivateNetwork = tc.usePrivate
+			external, internal := g.connectAddresses(details)
+			if external != tc.want || internal != "10.0.0.5" {
+				t.Errorf("connectAddresses() = (%q, %q), want (%q, 10.0.0.5)", external, internal, tc.want)
+			}
+		})
+	}
+}
+
+func TestConnectAddresses_PreferredMissing(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.PreferAddress = preferPublicIPv6
+	if external, _ := g.connectAddresses(makeDetails("1.2.3.4", "")); external != "1.2.3.4" {
+		t.Errorf("external = %q, want fallback to the public IPv4 address", external)
+	}
+}
+
+func TestConnectInfo_PrivateOnlyUtility(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.IPAddresses = upcloud.IPAddressSlice{
+			{Family: upcloud.IPAddressFamilyIPv4, Access: upcloud.IPAddressAccessUtility, Address: "10.1.0.7"},
+		}
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.UseUtilityNetwork = true
+	g.PrivateOnly = true
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.InternalAddr != "10.1.0.7" || info.ExternalAddr != "10.1.0.7" {
+		t.Errorf("addrs = (%q, %q), want utility IP 10.1.0.7 for both", info.InternalAddr, info.ExternalAddr)
+	}
+}
+
+func TestConnectInfo_DNSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		reverse bool
+		ptr     string
+		want    string
+	}{
+		{name: "ip", want: "1.2.3.4"},
+		{name: "template", tmpl: "{{.Hostname}}.ci.example.com", want: "runner-1.ci.example.com"},
+		{name: "reverse", reverse: true, ptr: "1-2-3-4.example.net.", want: "1-2-3-4.example.net"},
+		{name: "reverse missing", reverse: true, want: "1.2.3.4"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+				d := makeDetails("1.2.3.4", "10.0.0.5")
+				d.Hostname = "runner-1"
+				for i := range d.IPAddresses {
+					if d.IPAddresses[i].Address == "1.2.3.4" {
+						d.IPAddresses[i].PTRRecord = tc.ptr
+					}
+				}
+				return d, nil
+			}
+
+			g := baseGroup(mock)
+			g.ConnectDNSTemplate = tc.tmpl
+			g.ConnectReverseDNS = tc.reverse
+			if err := g.parseConnectNameTemplate(); err != nil {
+				t.Fatal(err)
+			}
+			info, err := g.ConnectInfo(context.Background(), "uuid-1")
+			if err != nil {
+				t.Fatalf("ConnectInfo() unexpected error: %v", err)
+			}
+			if info.ExternalAddr != tc.want || info.InternalAddr != "10.0.0.5" {
+				t.Errorf("addrs = (%q, %q), want (%q, 10.0.0.5)", info.ExternalAddr, info.InternalAddr, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidate_ConnectDNS(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "template", mod: func(g *InstanceGroup) { g.ConnectDNSTemplate = "{{.Hostname}}.example.com" }},
+		{name: "bad template", mod: func(g *InstanceGroup) { g.ConnectDNSTemplate = "{{.Hostname" }, wantErr: true},
+		{name: "both", mod: func(g *InstanceGroup) {
+			g.ConnectDNSTemplate, g.ConnectReverseDNS = "{{.Hostname}}.example.com", true
+		}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// ─── private network provisioning ─────────────────────────────────────────────
+
+func TestEnsurePrivateNetwork_ReusesExisting(t *testing.T) {
+	mock := newMockSvc() // CreateNetwork panics if reached
+	mock.getNetworksInZone = func(_ context.Context, r *request.GetNetworksInZoneRequest) (*upcloud.Networks, error) {
+		if r.Zone != "fi-hel1" {
+			t.Errorf("zone = %q", r.Zone)
+		}
+		return &upcloud.Networks{Networks: []upcloud.Network{
+			{UUID: "utility", Name: "test-group-network", Type: upcloud.NetworkTypeUtility},
+			{UUID: "existing", Name: "test-group-network", Type: upcloud.NetworkTypePrivate},
+		}}, nil
+	}
+	g := baseGroup(mock)
+	g.UsePrivateNetwork = true
+	g.PrivateNetworkCIDR = "10.20.0.0/24"
+
+	if err := g.ensurePrivateNetwork(context.Background()); err != nil {
+		t.Fatalf("ensurePrivateNetwork() unexpected error: %v", err)
+	}
+	if g.PrivateNetwork != "existing" {
+		t.Errorf("PrivateNetwork = %q, want existing", g.PrivateNetwork)
+	}
+}
+
+func TestEnsurePrivateNetwork_Creates(t *testing.T) {
+	mock := newMockSvc()
+	mock.getNetworksInZone = func(context.Context, *request.GetNetworksInZoneRequest) (*upcloud.Networks, error) {
+		return &upcloud.Networks{}, nil
+	}
+	mock.createRouter = func(context.Context, *request.CreateRouterRequest) (*upcloud.Router, error) {
+		return &upcloud.Router{UUID: "router-uuid"}, nil
+	}
+	var created *request.CreateNetworkRequest
+	mock.createNetwork = func(_ context.Context, r *request.CreateNetworkRequest) (*upcloud.Network, error) {
+		created = r
+		return &upcloud.Network{UUID: "new-net"}, nil
+	}
+	g := baseGroup(mock)
+	g.UsePrivateNetwork = true
+	g.PrivateOnly = true
+	g.PrivateNetworkCIDR = "10.20.0.0/24"
+	g.PrivateNetworkName = "ci"
+
+	if err := g.ensurePrivateNetwork(context.Background()); err != nil {
+		t.Fatalf("ensurePrivateNetwork() unexpected error: %v", err)
+	}
+	if g.PrivateNetwork != "new-net" {
+		t.Errorf("PrivateNetwork = %q, want new-net", g.PrivateNetwork)
+	}
+	if created.Name != "ci" || created.Zone != "fi-hel1" || created.Router != "router-uuid" || len(created.IPNetworks) != 1 {
+		t.Fatalf("CreateNetwork request = %+v", created)
+	}
+	ipn := created.IPNetworks[0]
+	if ipn.Address != "10.20.0.0/24" || !ipn.DHCP.Bool() || !ipn.DHCPDefaultRoute.Bool() {
+		t.Errorf("IP network = %+v, want DHCP with a default route for a private-only group", ipn)
+	}
+}
+
+func TestValidate_PrivateNetworkCIDR(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "valid", mod: func(g *InstanceGroup) { g.UsePrivateNetwork, g.PrivateNetworkCIDR = true, "10.0.0.0/24" }},
+		{name: "not a CIDR", mod: func(g *InstanceGroup) { g.UsePrivateNetwork, g.PrivateNetworkCIDR = true, "10.0.0.0" }, wantErr: true},
+		{name: "IPv6", mod: func(g *InstanceGroup) { g.UsePrivateNetwork, g.PrivateNetworkCIDR = true, "fd00::/64" }, wantErr: true},
+		{name: "with private_network", mod: func(g *InstanceGroup) {
+			g.UsePrivateNetwork, g.PrivateNetworkCIDR, g.PrivateNetwork = true, "10.0.0.0/24", "net"
+		}, wantErr: true},
+		{name: "without use_private_network", mod: func(g *InstanceGroup) { g.PrivateNetworkCIDR = "10.0.0.0/24" }, wantErr: true},
+		{name: "name without CIDR", mod: func(g *InstanceGroup) { g.PrivateNetworkName = "ci" }, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// Provider operations whose duration and outcome are recorded.
+const (
+	opUpdate      = "update"
+	opIncrease    = "increase"
+	opDecrease    = "decrease"
+	opConnectInfo = "connect_info"
+)
+
+// observe logs the duration and outcome of a provider call and records them
+// as the ops.<op> timing and the ops.<op>.ok or ops.<op>.error counter. It
+// is deferred at the top of the call with start = time.Now(). Update and
+// ConnectInfo run constantly, so they are only logged at debug level.
+func (g *InstanceGroup) observe(op string, start time.Time, err *error, args ...interface{}) {
+	duration := time.Since(start)
+	outcome := "ok"
+	if *err != nil {
+		outcome = "error"
+	}
+	g.metrics.timing("ops."+op, duration)
+	g.metrics.count("ops."+op+"."+outcome, 1)
+
+	level := hclog.Info
+	if op == opUpdate || op == opConnectInfo {
+		level = hclog.Debug
+	}
+	args = append([]interface{}{"op", op, "duration", duration, "outcome", outcome}, args...)
+	g.logger(logScaling).Log(level, "operation finished", args...)
+}
+
+// observeInstance logs and records the latency of one instance lifecycle
+// step, such as its create request or removal.
+func (g *InstanceGroup) observeInstance(step, uuid string, duration time.Duration) {
+	g.metrics.timing("instances."+step, duration)
+	g.logger(logScaling).Debug("instance step finished", "step", step, "uuid", uuid, "duration", duration)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// paceCreate blocks until the next CreateServer call is allowed:
+// CreatePacing apart from the previous one, and CreateCooldown after every
+// CreateBurst calls. A burst ends early once no call was made for a whole
+// cool-down. Slots are reserved under paceMu, so concurrent scale-ups queue
+// up behind each other.
+func (g *InstanceGroup) paceCreate(ctx context.Context) error {
+	if g.CreatePacing <= 0 && g.CreateBurst <= 0 {
+		return nil
+	}
+	cooldown := time.Duration(g.CreateCooldown)
+
+	g.paceMu.Lock()
+	now := time.Now()
+	if !g.paceLast.IsZero() && now.Sub(g.paceLast) >= cooldown {
+		g.paceBurst = 0
+	}
+	at := now
+	if g.paceNext.After(at) {
+		at = g.paceNext
+	}
+	g.paceLast = at
+	g.paceNext = at.Add(time.Duration(g.CreatePacing))
+	g.paceBurst++
+	if g.CreateBurst > 0 && g.paceBurst >= g.CreateBurst {
+		g.paceNext = at.Add(cooldown)
+		g.paceBurst = 0
+	}
+	g.paceMu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	g.logger(logScaling).Debug("pacing server creation", "wait", wait.Round(time.Millisecond))
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
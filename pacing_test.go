@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── create pacing ────────────────────────────────────────────────────────────
+
+func TestIncrease_CreatePacing(t *testing.T) {
+	var calls []time.Time
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls = append(calls, time.Now())
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.CreatePacing = Duration(20 * time.Millisecond)
+	g.CreateBurst, g.CreateCooldown = 2, Duration(100*time.Millisecond)
+	if n, err := g.Increase(context.Background(), 3); n != 3 {
+		t.Fatalf("Increase() = %d, %v, want 3", n, err)
+	}
+
+	// Slots are spaced from when they were reserved, a little before the
+	// mock records the call.
+	const slack = 5 * time.Millisecond
+	if gap := calls[1].Sub(calls[0]); gap < 20*time.Millisecond-slack {
+		t.Errorf("gap between first calls = %v, want at least the pacing", gap)
+	}
+	if gap := calls[2].Sub(calls[1]); gap < 100*time.Millisecond-slack {
+		t.Errorf("gap after the burst = %v, want at least the cool-down", gap)
+	}
+}
+
+func TestPaceCreate_Cancelled(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.CreatePacing = Duration(time.Hour)
+	g.paceNext = time.Now().Add(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.paceCreate(ctx); err == nil {
+		t.Error("paceCreate() expected error for a cancelled context")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// checkPprofAddress requires pprof_address to listen on a loopback address:
+// profiles expose memory contents and must not be reachable from outside.
+func checkPprofAddress(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("pprof_address: %w", err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("pprof_address %q must listen on localhost or a loopback address", addr)
+	}
+	return nil
+}
+
+// startPprof serves net/http/pprof on PprofAddress, if set, until Shutdown.
+func (g *InstanceGroup) startPprof() error {
+	if g.PprofAddress == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", g.PprofAddress)
+	if err != nil {
+		return fmt.Errorf("starting pprof endpoint: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	g.pprof = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	g.log.Info("serving pprof", "address", ln.Addr().String())
+	go func() {
+		if err := g.pprof.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			g.log.Warn("pprof endpoint stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// stopPprof closes the pprof endpoint, if running.
+func (g *InstanceGroup) stopPprof(ctx context.Context) {
+	if g.pprof != nil {
+		g.pprof.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// ─── pprof endpoint ───────────────────────────────────────────────────────────
+
+func TestCheckPprofAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "localhost:6060"},
+		{addr: "127.0.0.1:6060"},
+		{addr: "[::1]:6060"},
+		{addr: ":6060", wantErr: true},
+		{addr: "0.0.0.0:6060", wantErr: true},
+		{addr: "10.0.0.1:6060", wantErr: true},
+		{addr: "localhost", wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := checkPprofAddress(tc.addr); (err != nil) != tc.wantErr {
+			t.Errorf("checkPprofAddress(%q) error = %v, wantErr = %v", tc.addr, err, tc.wantErr)
+		}
+	}
+}
+
+func TestStartPprof(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	g := baseGroup(newMockSvc())
+	g.PprofAddress = addr
+	if err := g.startPprof(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.stopPprof(context.Background())
+
+	resp, err := http.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine profile") {
+		t.Errorf("GET goroutine profile = %d %.100s", resp.StatusCode, body)
+	}
+}
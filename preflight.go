@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// checkZone verifies the configured zone and fallback zones exist, listing
+// the valid zones in the error so a typo is obvious from the runner log.
+func (g *InstanceGroup) checkZone(ctx context.Context) error {
+	zones, err := g.svc.GetZones(ctx)
+	if err != nil {
+		return fmt.Errorf("listing zones: %w", err)
+	}
+
+	ids := make([]string, 0, len(zones.Zones))
+	for _, z := range zones.Zones {
+		ids = append(ids, z.ID)
+	}
+	slices.Sort(ids)
+	for _, zone := range g.zones() {
+		if !slices.Contains(ids, zone) {
+			return fmt.Errorf("zone %q does not exist; valid zones: %v", zone, ids)
+		}
+	}
+	return nil
+}
+
+// planPriceKey is the prefix of server plan entries in the per-zone price list.
+const planPriceKey = "server_plan_"
+
+// checkPlan verifies the configured plan exists and is offered in the
+// configured zone and every fallback zone. Availability comes from the zone's price list; if that
+// cannot be fetched only the plan name is checked.
+func (g *InstanceGroup) checkPlan(ctx context.Context) error {
+	plans, err := g.svc.GetPlans(ctx)
+	if err != nil {
+		return fmt.Errorf("listing plans: %w", err)
+	}
+
+	names := make([]string, 0, len(plans.Plans))
+	for _, p := range plans.Plans {
+		names = append(names, p.Name)
+	}
+	if !slices.Contains(names, g.Plan) {
+		slices.Sort(names)
+		return fmt.Errorf("plan %q does not exist; valid plans: %v", g.Plan, names)
+	}
+
+	prices, err := g.svc.GetPricesByZone(ctx)
+	if err != nil {
+		g.log.Warn("failed to check plan availability in zones", "plan", g.Plan, "zones", g.zones(), "error", err)
+		return nil
+	}
+	for _, zone := range g.zones() {
+		zonePrices, ok := (*prices)[zone]
+		if !ok {
+			continue
+		}
+		if _, ok := zonePrices[planPriceKey+g.Plan]; !ok {
+			return fmt.Errorf("plan %q is not available in zone %s", g.Plan, zone)
+		}
+	}
+	return nil
+}
+
+// checkDedicatedHost verifies the configured dedicated host exists and is in
+// the configured zone; the API would otherwise only reject it on scale-up.
+func (g *InstanceGroup) checkDedicatedHost(ctx context.Context) error {
+	if g.DedicatedHost == 0 {
+		return nil
+	}
+	hosts, err := g.svc.GetHosts(ctx)
+	if err != nil {
+		return fmt.Errorf("listing dedicated hosts: %w", err)
+	}
+	for _, h := range hosts.Hosts {
+		if h.ID != g.DedicatedHost {
+			continue
+		}
+		if h.Zone != g.Zone {
+			return fmt.Errorf("dedicated host %d (%s) is in zone %s, not %s", h.ID, h.Description, h.Zone, g.Zone)
+		}
+		return nil
+	}
+	return fmt.Errorf("dedicated host %d does not exist or is not available to this account", g.DedicatedHost)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// ─── Init preflight checks ────────────────────────────────────────────────────
+
+func TestCheckZone(t *testing.T) {
+	mock := newMockSvc()
+	mock.getZones = func(context.Context) (*upcloud.Zones, error) {
+		return &upcloud.Zones{Zones: []upcloud.Zone{{ID: "fi-hel2"}, {ID: "de-fra1"}, {ID: "fi-hel1"}}}, nil
+	}
+
+	g := baseGroup(mock)
+	if err := g.checkZone(context.Background()); err != nil {
+		t.Errorf("checkZone() unexpected error: %v", err)
+	}
+
+	g.Zone = "fi-hel3"
+	err := g.checkZone(context.Background())
+	if err == nil {
+		t.Fatal("checkZone() expected error for unknown zone, got nil")
+	}
+	if !strings.Contains(err.Error(), "[de-fra1 fi-hel1 fi-hel2]") {
+		t.Errorf("checkZone() error = %q, want it to list the valid zones", err)
+	}
+}
+
+func TestCheckPlan(t *testing.T) {
+	prices := upcloud.PricesByZone{
+		"fi-hel1": {planPriceKey + "1xCPU-2GB": {}},
+		"de-fra1": {planPriceKey + "1xCPU-2GB": {}, planPriceKey + "GPU-8xCPU-64GB-1xL40S": {}},
+	}
+	tests := []struct {
+		name      string
+		plan      string
+		zone      string
+		fallback  []string
+		pricesErr error
+		wantErr   string
+	}{
+		{name: "available", plan: "1xCPU-2GB"},
+		{name: "unknown plan", plan: "1xCPU-3GB", wantErr: "valid plans: [1xCPU-2GB GPU-8xCPU-64GB-1xL40S]"},
+		{name: "not offered in zone", plan: "GPU-8xCPU-64GB-1xL40S", wantErr: "not available in zone fi-hel1"},
+		{name: "price list unavailable", plan: "GPU-8xCPU-64GB-1xL40S", pricesErr: errors.New("boom")},
+		{name: "offered in fallback zone", plan: "1xCPU-2GB", fallback: []string{"de-fra1"}},
+		{name: "not offered in fallback zone", plan: "GPU-8xCPU-64GB-1xL40S", zone: "de-fra1", fallback: []string{"fi-hel1"}, wantErr: "not available in zone fi-hel1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getPlans = func(context.Context) (*upcloud.Plans, error) {
+				return &upcloud.Plans{Plans: []upcloud.Plan{{Name: "GPU-8xCPU-64GB-1xL40S"}, {Name: "1xCPU-2GB"}}}, nil
+			}
+			mock.getPricesByZone = func(context.Context) (*upcloud.PricesByZone, error) {
+				if tc.pricesErr != nil {
+					return nil, tc.pricesErr
+				}
+				return &prices, nil
+			}
+
+			g := baseGroup(mock)
+			g.Plan = tc.plan
+			if tc.zone != "" {
+				g.Zone = tc.zone
+			}
+			g.FallbackZones = tc.fallback
+			err := g.checkPlan(context.Background())
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkPlan() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("checkPlan() error = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDedicatedHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    int
+		wantErr string
+	}{
+		{name: "not configured"},
+		{name: "in zone", host: 7},
+		{name: "other zone", host: 8, wantErr: "is in zone de-fra1, not fi-hel1"},
+		{name: "unknown", host: 9, wantErr: "dedicated host 9 does not exist"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getHosts = func(context.Context) (*upcloud.Hosts, error) {
+				return &upcloud.Hosts{Hosts: []upcloud.Host{{ID: 7, Zone: "fi-hel1"}, {ID: 8, Zone: "de-fra1"}}}, nil
+			}
+
+			g := baseGroup(mock)
+			g.DedicatedHost = tc.host
+			err := g.checkDedicatedHost(context.Background())
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkDedicatedHost() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("checkDedicatedHost() error = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// parseIPRange parses private_ip_range: an IPv4 CIDR or an inclusive
+// "first-last" range. A CIDR yields its host addresses without the network
+// address, the first host, which SDN networks use as gateway, and the
+// broadcast address.
+func parseIPRange(s string) (first, last netip.Addr, err error) {
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		if first, err = netip.ParseAddr(strings.TrimSpace(from)); err != nil {
+			return first, last, err
+		}
+		if last, err = netip.ParseAddr(strings.TrimSpace(to)); err != nil {
+			return first, last, err
+		}
+	} else {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return first, last, err
+		}
+		prefix = prefix.Masked()
+		first = prefix.Addr()
+		last = first
+		for next := last.Next(); next.IsValid() && prefix.Contains(next); next = next.Next() {
+			last = next
+		}
+		// /31 and /32 have no network, gateway or broadcast address to spare.
+		if prefix.Addr().Is4() && prefix.Bits() < 31 {
+			first, last = first.Next().Next(), last.Prev()
+		}
+	}
+	if !first.Is4() || !last.Is4() {
+		return first, last, fmt.Errorf("%q is not an IPv4 range", s)
+	}
+	if last.Less(first) {
+		return first, last, fmt.Errorf("range %q ends before it starts", s)
+	}
+	return first, last, nil
+}
+
+// takenPrivateIPs returns the private addresses of the group's servers. The
+// server list carries no addresses, so they come from the addresses the
+// plugin assigned, or, for servers it has not seen yet, from their details,
+// which are fetched once and remembered.
+func (g *InstanceGroup) takenPrivateIPs(ctx context.Context) (map[netip.Addr]bool, error) {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{Filters: g.groupFilters()})
+	if err != nil {
+		return nil, fmt.Errorf("listing servers for private IP allocation: %w", err)
+	}
+	taken := map[netip.Addr]bool{}
+	for _, s := range servers.Servers {
+		g.privateIPMu.Lock()
+		addrs, ok := g.privateIPs[s.UUID]
+		g.privateIPMu.Unlock()
+		if !ok {
+			details, err := g.serverDetails(ctx, s.UUID)
+			if err != nil {
+				return nil, fmt.Errorf("getting server details for %s: %w", s.UUID, err)
+			}
+			for _, ip := range details.IPAddresses {
+				if ip.Access != upcloud.IPAddressAccessPrivate {
+					continue
+				}
+				if addr, err := netip.ParseAddr(ip.Address); err == nil {
+					addrs = append(addrs, addr)
+				}
+			}
+			g.recordPrivateIPs(s.UUID, addrs...)
+		}
+		for _, addr := range addrs {
+			taken[addr] = true
+		}
+	}
+	return taken, nil
+}
+
+// recordPrivateIPs remembers the private addresses of a group server.
+func (g *InstanceGroup) recordPrivateIPs(uuid string, addrs ...netip.Addr) {
+	g.privateIPMu.Lock()
+	defer g.privateIPMu.Unlock()
+	if g.privateIPs == nil {
+		g.privateIPs = make(map[string][]netip.Addr)
+	}
+	g.privateIPs[uuid] = addrs
+}
+
+// forgetPrivateIPs drops the addresses of a removed server.
+func (g *InstanceGroup) forgetPrivateIPs(uuid string) {
+	g.privateIPMu.Lock()
+	defer g.privateIPMu.Unlock()
+	delete(g.privateIPs, uuid)
+}
+
+// allocatePrivateIP returns the first address in private_ip_range that is
+// not in taken and records it there.
+func (g *InstanceGroup) allocatePrivateIP(taken map[netip.Addr]bool) (netip.Addr, error) {
+	first, last, err := parseIPRange(g.PrivateIPRange)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("private_ip_range: %w", err)
+	}
+	for addr := first; addr.IsValid() && !last.Less(addr); addr = addr.Next() {
+		if !taken[addr] {
+			taken[addr] = true
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no free address left in private_ip_range %s", g.PrivateIPRange)
+}
+
+// assignPrivateIP requests addr on the primary private network interface.
+func (g *InstanceGroup) assignPrivateIP(req *request.CreateServerRequest, addr netip.Addr) {
+	primary := g.primaryPrivateNetwork()
+	for i, iface := range req.Networking.Interfaces {
+		if iface.Type == upcloud.NetworkTypePrivate && iface.Network == primary {
+			req.Networking.Interfaces[i].IPAddresses = request.CreateServerIPAddressSlice{
+				{Family: upcloud.IPAddressFamilyIPv4, Address: addr.String()},
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── static private addresses ─────────────────────────────────────────────────
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last string
+		wantErr     bool
+	}{
+		{in: "10.0.0.100-10.0.0.199", first: "10.0.0.100", last: "10.0.0.199"},
+		{in: "10.0.0.128/25", first: "10.0.0.130", last: "10.0.0.254"},
+		{in: "10.0.0.0/28", first: "10.0.0.2", last: "10.0.0.14"},
+		{in: "10.0.0.8/31", first: "10.0.0.8", last: "10.0.0.9"},
+		{in: "10.0.0.5 - 10.0.0.5", first: "10.0.0.5", last: "10.0.0.5"},
+		{in: "10.0.0.9-10.0.0.1", wantErr: true},
+		{in: "fd00::1-fd00::9", wantErr: true},
+		{in: "10.0.0.0", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			first, last, err := parseIPRange(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseIPRange() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (first.String() != tc.first || last.String() != tc.last) {
+				t.Errorf("parseIPRange() = %s-%s, want %s-%s", first, last, tc.first, tc.last)
+			}
+		})
+	}
+}
+
+func TestIncrease_StaticPrivateIPs(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "existing"}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", "10.0.0.11"), nil
+	}
+	var addrs []string
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		for _, iface := range r.Networking.Interfaces {
+			if iface.Type == upcloud.NetworkTypePrivate {
+				addrs = append(addrs, iface.IPAddresses[0].Address)
+			}
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.UsePrivateNetwork = true
+	g.PrivateNetwork = "net-uuid"
+	g.PrivateIPRange = "10.0.0.10-10.0.0.12"
+
+	n, err := g.Increase(context.Background(), 3)
+	if n != 2 || err != nil {
+		t.Errorf("Increase() = (%d, %v), want (2, nil) once the range is exhausted", n, err)
+	}
+	if len(addrs) != 2 || addrs[0] != "10.0.0.10" || addrs[1] != "10.0.0.12" {
+		t.Errorf("private addresses = %v, want [10.0.0.10 10.0.0.12]", addrs)
+	}
+}
+
+func TestTakenPrivateIPs_RemembersAddresses(t *testing.T) {
+	servers := []upcloud.Server{{UUID: "existing"}}
+	lookups := 0
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: servers}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		lookups++
+		return makeDetails("", "10.0.0.11"), nil
+	}
+
+	g := baseGroup(mock)
+	g.recordPrivateIPs("created", netip.MustParseAddr("10.0.0.12"))
+	servers = append(servers, upcloud.Server{UUID: "created"})
+	for range 2 {
+		taken, err := g.takenPrivateIPs(context.Background())
+		if err != nil {
+			t.Fatalf("takenPrivateIPs() unexpected error: %v", err)
+		}
+		if len(taken) != 2 || !taken[netip.MustParseAddr("10.0.0.11")] || !taken[netip.MustParseAddr("10.0.0.12")] {
+			t.Errorf("takenPrivateIPs() = %v, want 10.0.0.11 and 10.0.0.12", taken)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("GetServerDetails called %d times, want once for the unknown server", lookups)
+	}
+
+	g.forgetServer("existing")
+	servers = servers[1:]
+	if taken, _ := g.takenPrivateIPs(context.Background()); len(taken) != 1 {
+		t.Errorf("takenPrivateIPs() = %v after removal, want only 10.0.0.12", taken)
+	}
+}
+
+func TestValidate_PrivateIPRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "valid", mod: func(g *InstanceGroup) {
+			g.UsePrivateNetwork, g.PrivateNetwork, g.PrivateIPRange = true, "net", "10.0.0.0/28"
+		}},
+		{name: "malformed", mod: func(g *InstanceGroup) {
+			g.UsePrivateNetwork, g.PrivateNetwork, g.PrivateIPRange = true, "net", "10.0.0.0/33"
+		}, wantErr: true},
+		{name: "no private network", mod: func(g *InstanceGroup) { g.UsePrivateNetwork, g.PrivateIPRange = true, "10.0.0.0/28" }, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// problemError presents an UpCloud API problem with the details operators
+// need when reporting it: the error code, the API's own title, any invalid
+// parameters and the correlation ID UpCloud support asks for.
+type problemError struct {
+	problem *upcloud.Problem
+	// correlationID comes from the response headers when the problem body
+	// does not carry one.
+	correlationID string
+}
+
+func (e *problemError) Error() string {
+	p := e.problem
+	var sb strings.Builder
+	if code := p.ErrorCode(); code != "" {
+		fmt.Fprintf(&sb, "%s: ", code)
+	}
+	sb.WriteString(p.Title)
+	for _, ip := range p.InvalidParams {
+		fmt.Fprintf(&sb, "; %s: %s", ip.Name, ip.Reason)
+	}
+	fmt.Fprintf(&sb, " (status %d", p.Status)
+	if id := cmp.Or(p.CorrelationID, e.correlationID); id != "" {
+		fmt.Fprintf(&sb, ", correlation ID %s", id)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+func (e *problemError) Unwrap() error { return e.problem }
+
+// withProblem replaces an UpCloud problem returned by the SDK with a
+// *problemError and tags other errors with the response correlation ID, if
+// one was seen.
+func withProblem(err error, correlationID string) error {
+	if err == nil {
+		return nil
+	}
+	if p, ok := err.(*upcloud.Problem); ok {
+		return &problemError{problem: p, correlationID: correlationID}
+	}
+	if correlationID != "" {
+		return fmt.Errorf("%w (correlation ID %s)", err, correlationID)
+	}
+	return err
+}
+
+// problemSvc decorates an upcloudSvc so every returned error carries the
+// API's problem details and correlation ID.
+type problemSvc struct {
+	next upcloudSvc
+}
+
+// describe runs a service call with a correlation slot, rewriting its error.
+func describe[T any](ctx context.Context, call func(context.Context) (T, error)) (T, error) {
+	ctx, slot := withCorrelationSlot(ctx)
+	v, err := call(ctx)
+	return v, withProblem(err, slot.get())
+}
+
+func (s problemSvc) GetAccount(ctx context.Context) (*upcloud.Account, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Account, error) { return s.next.GetAccount(ctx) })
+}
+func (s problemSvc) GetServersWithFilters(ctx context.Context, r *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Servers, error) { return s.next.GetServersWithFilters(ctx, r) })
+}
+func (s problemSvc) CreateServer(ctx context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.CreateServer(ctx, r) })
+}
+func (s problemSvc) StopServer(ctx context.Context, r *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.StopServer(ctx, r) })
+}
+func (s problemSvc) StartServer(ctx context.Context, r *request.StartServerRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.StartServer(ctx, r) })
+}
+func (s problemSvc) RestartServer(ctx context.Context, r *request.RestartServerRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.RestartServer(ctx, r) })
+}
+func (s problemSvc) WaitForServerState(ctx context.Context, r *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.WaitForServerState(ctx, r) })
+}
+func (s problemSvc) DeleteServerAndStorages(ctx context.Context, r *request.DeleteServerAndStoragesRequest) error {
+	_, err := describe(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.next.DeleteServerAndStorages(ctx, r)
+	})
+	return err
+}
+func (s problemSvc) DeleteServer(ctx context.Context, r *request.DeleteServerRequest) error {
+	_, err := describe(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.next.DeleteServer(ctx, r)
+	})
+	return err
+}
+func (s problemSvc) DeleteStorage(ctx context.Context, r *request.DeleteStorageRequest) error {
+	_, err := describe(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.next.DeleteStorage(ctx, r)
+	})
+	return err
+}
+func (s problemSvc) GetServerDetails(ctx context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.GetServerDetails(ctx, r) })
+}
+func (s problemSvc) GetIPAddressDetails(ctx context.Context, r *request.GetIPAddressDetailsRequest) (*upcloud.IPAddress, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.IPAddress, error) { return s.next.GetIPAddressDetails(ctx, r) })
+}
+func (s problemSvc) ModifyIPAddress(ctx context.Context, r *request.ModifyIPAddressRequest) (*upcloud.IPAddress, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.IPAddress, error) { return s.next.ModifyIPAddress(ctx, r) })
+}
+func (s problemSvc) ModifyServer(ctx context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.ServerDetails, error) { return s.next.ModifyServer(ctx, r) })
+}
+func (s problemSvc) GetStorageDetails(ctx context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.StorageDetails, error) { return s.next.GetStorageDetails(ctx, r) })
+}
+func (s problemSvc) GetStorages(ctx context.Context, r *request.GetStoragesRequest) (*upcloud.Storages, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Storages, error) { return s.next.GetStorages(ctx, r) })
+}
+func (s problemSvc) ModifyStorage(ctx context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.StorageDetails, error) { return s.next.ModifyStorage(ctx, r) })
+}
+func (s problemSvc) TemplatizeStorage(ctx context.Context, r *request.TemplatizeStorageRequest) (*upcloud.StorageDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.StorageDetails, error) { return s.next.TemplatizeStorage(ctx, r) })
+}
+func (s problemSvc) WaitForStorageState(ctx context.Context, r *request.WaitForStorageStateRequest) (*upcloud.StorageDetails, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.StorageDetails, error) { return s.next.WaitForStorageState(ctx, r) })
+}
+func (s problemSvc) GetZones(ctx context.Context) (*upcloud.Zones, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Zones, error) { return s.next.GetZones(ctx) })
+}
+func (s problemSvc) GetPlans(ctx context.Context) (*upcloud.Plans, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Plans, error) { return s.next.GetPlans(ctx) })
+}
+func (s problemSvc) GetHosts(ctx context.Context) (*upcloud.Hosts, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Hosts, error) { return s.next.GetHosts(ctx) })
+}
+func (s problemSvc) GetPricesByZone(ctx context.Context) (*upcloud.PricesByZone, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.PricesByZone, error) { return s.next.GetPricesByZone(ctx) })
+}
+func (s problemSvc) GetNetworkDetails(ctx context.Context, r *request.GetNetworkDetailsRequest) (*upcloud.Network, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Network, error) { return s.next.GetNetworkDetails(ctx, r) })
+}
+func (s problemSvc) CreateRouter(ctx context.Context, r *request.CreateRouterRequest) (*upcloud.Router, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Router, error) { return s.next.CreateRouter(ctx, r) })
+}
+func (s problemSvc) AttachNetworkRouter(ctx context.Context, r *request.AttachNetworkRouterRequest) error {
+	_, err := describe(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, s.next.AttachNetworkRouter(ctx, r)
+	})
+	return err
+}
+func (s problemSvc) GetGateways(ctx context.Context, f ...request.QueryFilter) ([]upcloud.Gateway, error) {
+	return describe(ctx, func(ctx context.Context) ([]upcloud.Gateway, error) { return s.next.GetGateways(ctx, f...) })
+}
+func (s problemSvc) CreateGateway(ctx context.Context, r *request.CreateGatewayRequest) (*upcloud.Gateway, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Gateway, error) { return s.next.CreateGateway(ctx, r) })
+}
+func (s problemSvc) GetNetworksInZone(ctx context.Context, r *request.GetNetworksInZoneRequest) (*upcloud.Networks, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Networks, error) { return s.next.GetNetworksInZone(ctx, r) })
+}
+func (s problemSvc) CreateNetwork(ctx context.Context, r *request.CreateNetworkRequest) (*upcloud.Network, error) {
+	return describe(ctx, func(ctx context.Context) (*upcloud.Network, error) { return s.next.CreateNetwork(ctx, r) })
+}
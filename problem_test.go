@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── API problem details ──────────────────────────────────────────────────────
+
+func TestProblemError(t *testing.T) {
+	tests := []struct {
+		name          string
+		problem       *upcloud.Problem
+		correlationID string
+		want          string
+	}{
+		{
+			name: "full",
+			problem: &upcloud.Problem{
+				Type:          "https://developers.upcloud.com/1.3/errors#ERROR_INVALID_REQUEST",
+				Title:         "Validation error.",
+				InvalidParams: []upcloud.ProblemInvalidParam{{Name: "hostname", Reason: "too long"}},
+				CorrelationID: "01ABC",
+				Status:        http.StatusBadRequest,
+			},
+			want: "INVALID_REQUEST: Validation error.; hostname: too long (status 400, correlation ID 01ABC)",
+		},
+		{
+			name:    "legacy",
+			problem: &upcloud.Problem{Type: "SERVER_NOT_FOUND", Title: "The server does not exist.", Status: http.StatusNotFound},
+			want:    "SERVER_NOT_FOUND: The server does not exist. (status 404)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := withProblem(tc.problem, tc.correlationID)
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Error() = %q, want %q", got, tc.want)
+			}
+			var p *upcloud.Problem
+			if !errors.As(err, &p) || p != tc.problem {
+				t.Error("original problem not reachable with errors.As")
+			}
+		})
+	}
+}
+
+func TestWithProblem_OtherErrors(t *testing.T) {
+	if withProblem(nil, "abc") != nil {
+		t.Error("withProblem(nil) != nil")
+	}
+	err := errors.New("connection refused")
+	if withProblem(err, "") != err {
+		t.Error("withProblem() changed a non-problem error")
+	}
+	tagged := withProblem(err, "req-1")
+	if !errors.Is(tagged, err) || tagged.Error() != "connection refused (correlation ID req-1)" {
+		t.Errorf("withProblem() = %q, want the error tagged with its correlation ID", tagged)
+	}
+}
+
+func TestProblemSvc(t *testing.T) {
+	problem := &upcloud.Problem{Type: "SERVER_CREATING_LIMIT_REACHED", Title: "Too many servers being created.", Status: http.StatusConflict}
+	mock := newMockSvc()
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		return nil, problem
+	}
+
+	_, err := problemSvc{next: mock}.CreateServer(context.Background(), &request.CreateServerRequest{})
+	var pe *problemError
+	if !errors.As(err, &pe) {
+		t.Fatalf("CreateServer() error = %T, want *problemError", err)
+	}
+	if !isTransient(err) {
+		t.Error("isTransient() = false; problem code no longer visible through the wrapper")
+	}
+}
+
+func TestCorrelationTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Request-Id", "req-42")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx, slot := withCorrelationSlot(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: &correlationTransport{next: http.DefaultTransport}}).Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := slot.get(); got != "req-42" {
+		t.Errorf("correlation ID = %q, want req-42", got)
+	}
+}
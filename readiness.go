@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// readinessRetryInterval is the pause between failed readiness command attempts.
+var readinessRetryInterval = 5 * time.Second
+
+// cloudInitWaitCommand blocks until cloud-init has finished. It exits 1 when
+// cloud-init failed and 2 when it finished with recoverable errors.
+const cloudInitWaitCommand = "cloud-init status --wait"
+
+// errCloudInitFailed means cloud-init finished with a fatal error; waiting
+// longer cannot make the instance ready.
+var errCloudInitFailed = errors.New("cloud-init failed")
+
+// checksReadiness reports whether new instances are probed before they are
+// reported as running.
+func (g *InstanceGroup) checksReadiness() bool {
+	return g.ReadinessCommand != "" || g.WaitForCloudInit
+}
+
+// readinessState returns the state to report for a running server when
+// readiness is checked. Servers stay "creating" until cloud-init has finished
+// and the readiness command has succeeded once, and "timeout" if that does not
+// happen within ReadinessTimeout.
+func (g *InstanceGroup) readinessState(uuid string) provider.State {
+	g.readyMu.Lock()
+	defer g.readyMu.Unlock()
+
+	switch {
+	case g.ready[uuid]:
+		return provider.StateRunning
+	case g.notReady[uuid]:
+		return provider.StateTimeout
+	case g.probing[uuid]:
+		return provider.StateCreating
+	}
+
+	if g.probing == nil {
+		g.probing = make(map[string]bool)
+	}
+	g.probing[uuid] = true
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		g.probeReadiness(g.probeContext(), uuid)
+	}()
+
+	return provider.StateCreating
+}
+
+// probeReadiness waits for cloud-init and runs ReadinessCommand until both
+// succeed or ReadinessTimeout expires, then records the outcome.
+func (g *InstanceGroup) probeReadiness(ctx context.Context, uuid string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(g.ReadinessTimeout))
+	defer cancel()
+	log := withInstance(g.log, uuid, "")
+
+	ok, failed := false, false
+	cloudInitDone := !g.WaitForCloudInit
+	for attempt := 1; ; attempt++ {
+		out, err := g.checkReady(ctx, uuid, &cloudInitDone)
+		if err == nil {
+			ok = true
+			log.Info("instance ready", "attempts", attempt)
+			if created, known := g.serverCreatedAt(ctx, uuid); known {
+				g.observeInstance("time_to_ready", uuid, time.Since(created))
+			}
+			break
+		}
+		if errors.Is(err, errCloudInitFailed) {
+			failed = true
+			log.Error("cloud-init failed on instance", "output", string(out))
+			break
+		}
+		log.Debug("readiness check failed", "attempt", attempt, "error", err, "output", string(out))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(readinessRetryInterval):
+			continue
+		}
+		break
+	}
+
+	switch {
+	case failed:
+		g.markUnhealthy(uuid, "cloud-init failed")
+	case !ok && ctx.Err() == context.DeadlineExceeded:
+		g.markUnhealthy(uuid, "readiness timed out")
+	}
+
+	g.readyMu.Lock()
+	defer g.readyMu.Unlock()
+	delete(g.probing, uuid)
+	if ok {
+		if g.ready == nil {
+			g.ready = make(map[string]bool)
+		}
+		g.ready[uuid] = true
+		return
+	}
+	// A cancelled probe (plugin shutdown) says nothing about the instance.
+	if failed || ctx.Err() == context.DeadlineExceeded {
+		if !failed {
+			log.Error("instance did not become ready in time", "timeout", time.Duration(g.ReadinessTimeout))
+		}
+		if g.notReady == nil {
+			g.notReady = make(map[string]bool)
+		}
+		g.notReady[uuid] = true
+	}
+}
+
+// checkReady makes one readiness attempt: waiting for cloud-init unless
+// cloudInitDone is already set, then running ReadinessCommand if configured.
+func (g *InstanceGroup) checkReady(ctx context.Context, uuid string, cloudInitDone *bool) ([]byte, error) {
+	timeout := time.Duration(g.ReadinessTimeout)
+	if !*cloudInitDone {
+		out, err := g.runOnInstance(ctx, uuid, cloudInitWaitCommand, timeout)
+		var exit interface{ ExitStatus() int } // *ssh.ExitError
+		switch {
+		case errors.As(err, &exit) && exit.ExitStatus() == 1:
+			return out, fmt.Errorf("%w: %w", errCloudInitFailed, err)
+		case errors.As(err, &exit) && exit.ExitStatus() == 2:
+			g.log.Warn("cloud-init finished with recoverable errors", "uuid", uuid, "output", string(out))
+		case err != nil:
+			return out, err
+		}
+		*cloudInitDone = true
+	}
+	if g.ReadinessCommand == "" {
+		return nil, nil
+	}
+	return g.runOnInstance(ctx, uuid, g.ReadinessCommand, timeout)
+}
+
+// forgetReadiness drops readiness state for a removed server.
+func (g *InstanceGroup) forgetReadiness(uuid string) {
+	g.readyMu.Lock()
+	defer g.readyMu.Unlock()
+	delete(g.ready, uuid)
+	delete(g.notReady, uuid)
+	delete(g.probing, uuid)
+}
+
+// probeContext returns the context for background probes; it is cancelled by
+// Shutdown so probes do not hold up plugin exit.
+func (g *InstanceGroup) probeContext() context.Context {
+	g.probeOnce.Do(func() {
+		g.probeCtx, g.probeCancel = context.WithCancel(context.Background())
+	})
+	return g.probeCtx
+}
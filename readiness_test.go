@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── readiness command ────────────────────────────────────────────────────────
+
+// runningServerMock lists a single started server with a public address.
+func runningServerMock() *mockSvc {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+	return mock
+}
+
+func updateState(t *testing.T, g *InstanceGroup) provider.State {
+	t.Helper()
+	var state provider.State
+	if err := g.Update(context.Background(), func(_ string, s provider.State) { state = s }); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	return state
+}
+
+func TestUpdate_ReadinessCommandSucceeds(t *testing.T) {
+	origInterval := readinessRetryInterval
+	readinessRetryInterval = time.Millisecond
+	defer func() { readinessRetryInterval = origInterval }()
+
+	var attempts atomic.Int32
+	stubSSH(t, func(_ context.Context, _ provider.ConnectInfo, command string) ([]byte, error) {
+		if command != "cloud-init status --wait" {
+			t.Errorf("command = %q", command)
+		}
+		if attempts.Add(1) < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	})
+
+	g := baseGroup(runningServerMock())
+	g.ReadinessCommand = "cloud-init status --wait"
+	g.ReadinessTimeout = Duration(time.Minute)
+
+	if got := updateState(t, g); got != provider.StateCreating {
+		t.Errorf("state before probe finished = %v, want StateCreating", got)
+	}
+	g.background.Wait()
+	if got := updateState(t, g); got != provider.StateRunning {
+		t.Errorf("state after probe succeeded = %v, want StateRunning", got)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestUpdate_ReadinessCommandTimesOut(t *testing.T) {
+	origInterval := readinessRetryInterval
+	readinessRetryInterval = time.Millisecond
+	defer func() { readinessRetryInterval = origInterval }()
+
+	stubSSH(t, func(context.Context, provider.ConnectInfo, string) ([]byte, error) {
+		return nil, errors.New("still booting")
+	})
+
+	g := baseGroup(runningServerMock())
+	g.ReadinessCommand = "docker info"
+	g.ReadinessTimeout = Duration(20 * time.Millisecond)
+
+	updateState(t, g)
+	g.background.Wait()
+	if got := updateState(t, g); got != provider.StateTimeout {
+		t.Errorf("state after readiness timeout = %v, want StateTimeout", got)
+	}
+}
+
+func TestUpdate_NoReadinessCommand(t *testing.T) {
+	g := baseGroup(runningServerMock())
+	if got := updateState(t, g); got != provider.StateRunning {
+		t.Errorf("state = %v, want StateRunning", got)
+	}
+}
+
+// exitError mimics *ssh.ExitError for a remote command's exit status.
+type exitError int
+
+func (e exitError) Error() string   { return fmt.Sprintf("Process exited with status %d", int(e)) }
+func (e exitError) ExitStatus() int { return int(e) }
+
+func TestUpdate_WaitForCloudInit(t *testing.T) {
+	tests := []struct {
+		name      string
+		cloudInit error
+		want      provider.State
+		wantCmds  []string
+	}{
+		{name: "done", want: provider.StateRunning, wantCmds: []string{cloudInitWaitCommand, "docker info"}},
+		{name: "degraded", cloudInit: exitError(2), want: provider.StateRunning, wantCmds: []string{cloudInitWaitCommand, "docker info"}},
+		{name: "failed", cloudInit: exitError(1), want: provider.StateTimeout, wantCmds: []string{cloudInitWaitCommand}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				cmds []string
+			)
+			stubSSH(t, func(_ context.Context, _ provider.ConnectInfo, command string) ([]byte, error) {
+				mu.Lock()
+				cmds = append(cmds, command)
+				mu.Unlock()
+				if command == cloudInitWaitCommand {
+					return nil, tc.cloudInit
+				}
+				return nil, nil
+			})
+
+			g := baseGroup(runningServerMock())
+			g.WaitForCloudInit = true
+			g.ReadinessCommand = "docker info"
+			g.ReadinessTimeout = Duration(time.Minute)
+
+			updateState(t, g)
+			g.background.Wait()
+			if got := updateState(t, g); got != tc.want {
+				t.Errorf("state = %v, want %v", got, tc.want)
+			}
+			if !slices.Equal(cmds, tc.wantCmds) {
+				t.Errorf("commands = %q, want %q", cmds, tc.wantCmds)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// reconcileTimeout bounds the re-creation of vanished instances.
+const reconcileTimeout = 10 * time.Minute
+
+// own adds a server to the desired set: instances the runner asked for and
+// has not asked, nor the plugin decided, to remove. A creation it completes
+// stops counting as in flight in the same step, so Update never sees it
+// twice or not at all.
+func (g *InstanceGroup) own(uuid string) {
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	if g.desired == nil {
+		g.desired = make(map[string]time.Time)
+	}
+	g.desired[uuid] = time.Now()
+	g.inflight = max(g.inflight-1, 0)
+}
+
+// expectCreates counts n creations as in flight until they are owned or
+// given up with settleCreates.
+func (g *InstanceGroup) expectCreates(n int) {
+	if n <= 0 {
+		return
+	}
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	g.inflight += n
+}
+
+// settleCreates stops counting n creations that will not be owned.
+func (g *InstanceGroup) settleCreates(n int) {
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	g.inflight = max(g.inflight-n, 0)
+}
+
+// pendingCreates returns the creations the listing Update took at listedAt
+// cannot show: those still in flight and those owned after the listing
+// started.
+func (g *InstanceGroup) pendingCreates(listed map[string]bool, listedAt time.Time) int {
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	n := g.inflight
+	for uuid, since := range g.desired {
+		if !listed[uuid] && !since.Before(listedAt) {
+			n++
+		}
+	}
+	return n
+}
+
+// createInBackground creates n servers without blocking the caller. They
+// count as in flight from the call on, so the next Update does not ask for
+// them again; done receives the outcome.
+func (g *InstanceGroup) createInBackground(n int, timeout time.Duration, done func(created int, err error)) {
+	g.expectCreates(n)
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		ctx, cancel := context.WithTimeout(g.probeContext(), timeout)
+		defer cancel()
+		done(g.increase(ctx, n))
+	}()
+}
+
+// disown drops a server from the desired set once its removal starts.
+func (g *InstanceGroup) disown(uuid string) {
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	delete(g.desired, uuid)
+}
+
+// reconcile compares the desired set with the servers Update listed at
+// listedAt. The first call seeds the set with the servers found. Desired
+// servers that are gone without the plugin removing them, e.g. deleted in
+// the console, are reported as drift and, with RecreateVanished, replaced
+// in the background.
+func (g *InstanceGroup) reconcile(servers []upcloud.Server, skip func(uuid string) bool, listedAt time.Time) {
+	listed := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		listed[s.UUID] = true
+	}
+
+	g.desiredMu.Lock()
+	if !g.desiredSeeded {
+		g.desiredSeeded = true
+		if g.desired == nil {
+			g.desired = make(map[string]time.Time)
+		}
+		for _, s := range servers {
+			if !skip(s.UUID) {
+				g.desired[s.UUID] = listedAt
+			}
+		}
+	}
+	var vanished []string
+	for uuid, since := range g.desired {
+		// Servers created after the listing started cannot be in it.
+		if !listed[uuid] && since.Before(listedAt) && !g.isDeleting(uuid) {
+			vanished = append(vanished, uuid)
+			delete(g.desired, uuid)
+		}
+	}
+	desired := len(g.desired) + len(vanished)
+	g.desiredMu.Unlock()
+
+	g.metrics.gauge("instances.desired", float64(desired))
+	if len(vanished) == 0 {
+		return
+	}
+	slices.Sort(vanished)
+	g.metrics.count("instances.vanished", int64(len(vanished)))
+	log := g.logger(logScaling)
+	log.Warn("instances vanished without being removed by the plugin",
+		"count", len(vanished), "uuids", vanished, "desired", desired, "actual", desired-len(vanished))
+	for _, uuid := range vanished {
+		g.forgetServer(uuid)
+		g.usageStop(uuid)
+		g.recordDeleted(uuid)
+	}
+	if !g.RecreateVanished {
+		return
+	}
+
+	// Counted in flight right away, so warm capacity does not replace them
+	// a second time.
+	g.createInBackground(len(vanished), reconcileTimeout, func(n int, err error) {
+		if n < len(vanished) {
+			log.Warn("failed to re-create all vanished instances", "created", n, "vanished", len(vanished), "error", err)
+			return
+		}
+		log.Info("re-created vanished instances", "count", n)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── desired size reconciliation ──────────────────────────────────────────────
+
+func TestUpdate_RecreatesVanished(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created int
+	)
+	listed := []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}, {UUID: "uuid-2", State: upcloud.ServerStateStarted}}
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: listed}, nil
+	}
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created++
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-3"}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.RecreateVanished = true
+	update := func() {
+		t.Helper()
+		if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+		g.background.Wait()
+	}
+	update() // seeds the desired set
+	if created != 0 {
+		t.Fatalf("created = %d on the first update, want 0", created)
+	}
+
+	// uuid-2 is deleted in the console.
+	listed = listed[:1]
+	time.Sleep(time.Millisecond)
+	update()
+	if created != 1 {
+		t.Errorf("created = %d, want the vanished instance re-created", created)
+	}
+
+	// The replacement is desired from now on, and the vanished one only
+	// counted once.
+	listed = append(listed, upcloud.Server{UUID: "uuid-3", State: upcloud.ServerStateStarted})
+	update()
+	if created != 1 {
+		t.Errorf("created = %d after another update, want 1", created)
+	}
+	if _, ok := g.desired["uuid-3"]; !ok {
+		t.Error("replacement uuid-3 not in the desired set")
+	}
+}
+
+func TestReconcile_IgnoresRemovals(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	start := time.Now()
+	g.reconcile([]upcloud.Server{{UUID: "uuid-1"}, {UUID: "uuid-2"}}, func(string) bool { return false }, start)
+
+	// uuid-1 is removed by the plugin, uuid-2 still being deleted.
+	g.disown("uuid-1")
+	g.setDeleting("uuid-2", true)
+	g.reconcile(nil, func(string) bool { return false }, start.Add(time.Second))
+	if _, ok := g.desired["uuid-2"]; !ok || len(g.desired) != 1 {
+		t.Errorf("desired = %v, want only uuid-2 still pending removal", g.desired)
+	}
+}
+
+func TestUpdate_RecreatesVanishedOnceWithMinSize(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created int
+	)
+	listed := []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}, {UUID: "uuid-2", State: upcloud.ServerStateStarted}}
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: listed}, nil
+	}
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created++
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-3"}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.RecreateVanished, g.MinSize = true, 2
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.background.Wait()
+
+	// uuid-2 is deleted in the console; both reconcile and warm capacity
+	// notice the gap in the same update.
+	listed = listed[:1]
+	time.Sleep(time.Millisecond)
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.background.Wait()
+	if created != 1 {
+		t.Errorf("created = %d, want the vanished instance replaced once", created)
+	}
+}
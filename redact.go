@@ -0,0 +1,133 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// redactedText replaces secrets in logs and error strings.
+const redactedText = "[REDACTED]"
+
+// minSecretLength keeps short values such as "ci" from being scrubbed out
+// of every message they happen to occur in.
+const minSecretLength = 6
+
+// secretPatterns match credentials that are redacted even when the plugin
+// never saw their value, such as keys generated for instances.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`(?i)\b(bearer|basic) [A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`\bucat_[A-Za-z0-9]+`),
+}
+
+// redactor scrubs known secret values and secret-looking strings from text.
+type redactor struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// secrets holds every credential the plugin process has seen: API
+// credentials, key passphrases and the values of user data secrets. It is
+// process-wide because one plugin process serves one instance group, and
+// transports and errors outlive any single call.
+var secrets = &redactor{}
+
+// add registers values to be redacted.
+func (r *redactor) add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) >= minSecretLength && !slices.Contains(r.values, v) {
+			r.values = append(r.values, v)
+		}
+	}
+}
+
+// redact returns s with secrets replaced by redactedText.
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, redactedText)
+	}
+	r.mu.RUnlock()
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, redactedText)
+	}
+	return s
+}
+
+// registerSecrets adds the credentials in the plugin config to secrets.
+func (g *InstanceGroup) registerSecrets() {
+	secrets.add(g.Token, g.Password, g.KeyPassphrase)
+}
+
+// redactedError presents an error with secrets removed from its message
+// while keeping it inspectable with errors.Is and errors.As.
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string { return secrets.redact(e.err.Error()) }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError replaces *err with a redacted view of it. Provider methods
+// defer it so no error handed to the runner carries a credential.
+func redactError(err *error) {
+	if *err != nil {
+		if _, ok := (*err).(*redactedError); !ok {
+			*err = &redactedError{err: *err}
+		}
+	}
+}
+
+// redactingLogger scrubs secrets from messages and their arguments before
+// passing them on, so call sites cannot leak credentials by accident.
+type redactingLogger struct {
+	hclog.Logger
+}
+
+func (l *redactingLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	l.Logger.Log(level, secrets.redact(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Trace(msg string, args ...interface{}) { l.Log(hclog.Trace, msg, args...) }
+func (l *redactingLogger) Debug(msg string, args ...interface{}) { l.Log(hclog.Debug, msg, args...) }
+func (l *redactingLogger) Info(msg string, args ...interface{})  { l.Log(hclog.Info, msg, args...) }
+func (l *redactingLogger) Warn(msg string, args ...interface{})  { l.Log(hclog.Warn, msg, args...) }
+func (l *redactingLogger) Error(msg string, args ...interface{}) { l.Log(hclog.Error, msg, args...) }
+
+func (l *redactingLogger) With(args ...interface{}) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.With(redactArgs(args)...)}
+}
+
+func (l *redactingLogger) Named(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.Named(name)}
+}
+
+func (l *redactingLogger) ResetNamed(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.ResetNamed(name)}
+}
+
+// redactArgs scrubs string, byte slice and error log arguments. Other
+// values are passed through untouched.
+func redactArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case string:
+			out[i] = secrets.redact(v)
+		case []byte:
+			out[i] = secrets.redact(string(v))
+		case error:
+			out[i] = secrets.redact(v.Error())
+		default:
+			out[i] = a
+		}
+	}
+	return out
+}
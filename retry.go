@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// defaultCreateRetryBackoff is the initial pause before retrying a failed
+// CreateServer call; it doubles with every further attempt.
+const defaultCreateRetryBackoff = 2 * time.Second
+
+// transientErrorCodes are UpCloud error codes that usually clear up on their
+// own within seconds.
+var transientErrorCodes = []string{
+	upcloud.ErrCodeServerCreatingLimitReached,
+	upcloud.ErrCodeServerResourcesUnavailable,
+	upcloud.ErrCodeStorageResourcesUnavailable,
+	upcloud.ErrCodeIpAddressResourcesUnavailable,
+}
+
+// isTransient reports whether a failed API call is worth retrying. API
+// problems are transient on rate limiting, server errors and a few resource
+// shortages; errors without a problem body are network failures. Calls
+// rejected by the open circuit breaker are not retried.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, errProviderDegraded) {
+		return false
+	}
+	var p *upcloud.Problem
+	if !errors.As(err, &p) {
+		return true
+	}
+	return p.Status == http.StatusTooManyRequests ||
+		p.Status >= http.StatusInternalServerError ||
+		slices.Contains(transientErrorCodes, p.ErrorCode())
+}
+
+// jitter returns a random duration in [d/2, 3d/2) so that retries from
+// parallel plugins do not hit the API in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// createServer calls CreateServer, retrying transient failures up to
+// CreateRetries times with jittered exponential backoff.
+func (g *InstanceGroup) createServer(ctx context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+	backoff := time.Duration(g.CreateRetryBackoff)
+	for attempt := 0; ; attempt++ {
+		if err := g.paceCreate(ctx); err != nil {
+			return nil, fmt.Errorf("waiting for create pacing: %w", err)
+		}
+		details, err := g.svc.CreateServer(ctx, r)
+		if err == nil || attempt >= g.CreateRetries || !isTransient(err) {
+			return details, err
+		}
+		if len(g.FallbackZones) > 0 && isCapacityError(err) {
+			// Moving on to the next zone beats waiting for this one.
+			return details, err
+		}
+		if isMaintenanceError(err) {
+			// The zone is paused instead; retrying only prolongs the failure.
+			return details, err
+		}
+
+		wait := jitter(backoff)
+		g.logger(logScaling).Warn("failed to create server, retrying", "hostname", r.Hostname, "attempt", attempt+1, "retry_in", wait, "error", err)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("%w (retry aborted: %w)", err, ctx.Err())
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Permanent failure classes that make further creations pointless.
+const (
+	failureAuth  = "authentication"
+	failureQuota = "quota"
+)
+
+// quotaErrorCodes are UpCloud error codes reporting an exhausted account limit.
+var quotaErrorCodes = []string{
+	upcloud.ErrCodeInsufficientCredits,
+	upcloud.ErrCodeTrialPlan,
+	upcloud.ErrCodeServerCoresLimitReached,
+	upcloud.ErrCodeServerMemoryLimitReached,
+	upcloud.ErrCodeServerIPLimitReached,
+	upcloud.ErrCodeStorageDeviceLimitReached,
+	upcloud.ErrCodeMaxiOpsStorageLimitReached,
+	upcloud.ErrCodeIpAddressLimitReached,
+}
+
+// permanentFailure returns the failure class of err if retrying the same
+// request, or sending another like it, cannot succeed; "" otherwise.
+func permanentFailure(err error) string {
+	var p *upcloud.Problem
+	if !errors.As(err, &p) {
+		return ""
+	}
+	switch {
+	case p.Status == http.StatusUnauthorized || p.ErrorCode() == upcloud.ErrCodeAuthenticationFailed:
+		return failureAuth
+	case slices.Contains(quotaErrorCodes, p.ErrorCode()):
+		return failureQuota
+	}
+	return ""
+}
+
+// createAbortedError is returned by Increase when a permanent failure made
+// the remaining create attempts pointless.
+type createAbortedError struct {
+	Class string // failureAuth or failureQuota
+	Err   error
+}
+
+func (e *createAbortedError) Error() string {
+	return fmt.Sprintf("aborted server creation on %s failure: %v", e.Class, e.Err)
+}
+
+func (e *createAbortedError) Unwrap() error { return e.Err }
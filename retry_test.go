@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── create retries ───────────────────────────────────────────────────────────
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", errors.New("connection reset by peer"), true},
+		{"rate limited", &upcloud.Problem{Status: 429}, true},
+		{"server error", &upcloud.Problem{Status: 503}, true},
+		{"resources unavailable", &upcloud.Problem{Status: 409, Type: "https://developers.upcloud.com/1.3/errors#ERROR_SERVER_RESOURCES_UNAVAILABLE"}, true},
+		{"wrapped problem", fmt.Errorf("creating: %w", &upcloud.Problem{Status: 502}), true},
+		{"authentication failed", &upcloud.Problem{Status: 401, Type: "https://developers.upcloud.com/1.3/errors#ERROR_AUTHENTICATION_FAILED"}, false},
+		{"invalid request", &upcloud.Problem{Status: 400}, false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransient(tc.err); got != tc.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIncrease_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		if calls < 3 {
+			return nil, &upcloud.Problem{Status: 503}
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.CreateRetries = 2
+	g.CreateRetryBackoff = Duration(time.Millisecond)
+
+	n, err := g.Increase(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Increase() unexpected error: %v", err)
+	}
+	if n != 1 || calls != 3 {
+		t.Errorf("Increase() = %d after %d calls, want 1 after 3", n, calls)
+	}
+}
+
+func TestIncrease_RetriesExhausted(t *testing.T) {
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		return nil, &upcloud.Problem{Status: 503}
+	}
+
+	g := baseGroup(mock)
+	g.CreateRetries = 2
+	g.CreateRetryBackoff = Duration(time.Millisecond)
+
+	n, err := g.Increase(context.Background(), 1)
+	if err == nil {
+		t.Error("Increase() expected error when every creation failed, got nil")
+	}
+	if n != 0 || calls != 3 {
+		t.Errorf("Increase() = %d after %d calls, want 0 after 3", n, calls)
+	}
+}
+
+func TestIncrease_NoRetryOnPermanentError(t *testing.T) {
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		return nil, &upcloud.Problem{Status: 400}
+	}
+
+	g := baseGroup(mock)
+	g.CreateRetries = 5
+	g.CreateRetryBackoff = Duration(time.Millisecond)
+
+	g.Increase(context.Background(), 1)
+	if calls != 1 {
+		t.Errorf("CreateServer called %d times, want 1", calls)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	d := 100 * time.Millisecond
+	for range 100 {
+		if got := jitter(d); got < d/2 || got >= 3*d/2 {
+			t.Fatalf("jitter(%v) = %v, want within [%v, %v)", d, got, d/2, 3*d/2)
+		}
+	}
+}
+
+func TestIncrease_AbortsOnPermanentError(t *testing.T) {
+	tests := []struct {
+		name      string
+		problem   *upcloud.Problem
+		wantClass string
+	}{
+		{"authentication", &upcloud.Problem{Status: 401, Type: "https://developers.upcloud.com/1.3/errors#ERROR_AUTHENTICATION_FAILED"}, failureAuth},
+		{"quota", &upcloud.Problem{Status: 409, Type: "https://developers.upcloud.com/1.3/errors#ERROR_SERVER_CORE_LIMIT_REACHED"}, failureQuota},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			mock := newMockSvc()
+			noServers(mock)
+			mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+				calls++
+				if calls == 1 {
+					return &upcloud.ServerDetails{}, nil
+				}
+				return nil, tc.problem
+			}
+
+			g := baseGroup(mock)
+			n, err := g.Increase(context.Background(), 5)
+
+			var aborted *createAbortedError
+			if !errors.As(err, &aborted) || aborted.Class != tc.wantClass {
+				t.Fatalf("Increase() error = %v, want %s createAbortedError", err, tc.wantClass)
+			}
+			if n != 1 || calls != 2 {
+				t.Errorf("Increase() = %d after %d calls, want 1 after 2", n, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// Defaults of the scale command.
+const (
+	defaultScaleUsername = "root"
+	defaultScaleTimeout  = 15 * time.Minute
+)
+
+// runScale implements `scale --config <file> (--increase n | --decrease
+// uuid,...) [--key-path file] [--username user] [--timeout d]`. The group is
+// set up with the part of Init that creating and removing servers needs, so
+// the same Increase and Decrease code paths run, logging to stderr. It may
+// run next to the plugin using the same config: it starts no listeners and
+// only appends to the instance history of the state file.
+func runScale(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("scale", stdout)
+	increase := fs.Int("increase", 0, "number of instances to create")
+	decrease := fs.String("decrease", "", "comma-separated UUIDs of instances to remove")
+	keyPath := fs.String("key-path", "", "SSH private key injected into new instances, as connector_config.key_path")
+	username := fs.String("username", defaultScaleUsername, "login user of new instances, as connector_config.username")
+	timeout := fs.Duration("timeout", defaultScaleTimeout, "time limit for the whole operation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*increase > 0) == (*decrease != "") {
+		return fmt.Errorf("exactly one of --increase (above zero) or --decrease is required")
+	}
+
+	settings := provider.Settings{ConnectorConfig: provider.ConnectorConfig{Username: *username}}
+	if *keyPath != "" {
+		key, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return fmt.Errorf("reading --key-path: %w", err)
+		}
+		settings.ConnectorConfig.Key = key
+	}
+
+	g, err := readGroupConfig(*config)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	log := hclog.New(&hclog.LoggerOptions{Name: Version.Name, Level: hclog.Info, Output: os.Stderr})
+	if _, err := g.initCore(ctx, log, settings); err != nil {
+		return err
+	}
+	g.store = openHistory(g.StateFile)
+	defer g.Shutdown(ctx)
+
+	if *increase > 0 {
+		n, err := g.Increase(ctx, *increase)
+		fmt.Fprintf(stdout, "created %d of %d instances\n", n, *increase)
+		return err
+	}
+
+	var uuids []string
+	for _, uuid := range strings.Split(*decrease, ",") {
+		if uuid = strings.TrimSpace(uuid); uuid != "" {
+			uuids = append(uuids, uuid)
+		}
+	}
+	removed, err := g.Decrease(ctx, uuids)
+	for _, uuid := range removed {
+		fmt.Fprintln(stdout, uuid)
+	}
+	return err
+}
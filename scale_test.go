@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// ─── scale command ────────────────────────────────────────────────────────────
+
+func TestRunScale_Flags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--config", "plugin.json"},
+		{"--config", "plugin.json", "--increase", "2", "--decrease", "uuid-1"},
+		{"--config", "plugin.json", "--increase", "-1"},
+		{"--increase", "1"},
+	} {
+		if err := runScale(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("runScale(%q) expected error, got nil", args)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField bounds one field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// cronFields are the five fields of a cron expression, in order.
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// cronSpec is a parsed cron expression. Each field is a bit set of the
+// values it matches.
+type cronSpec struct {
+	expr   string
+	fields [5]uint64
+	// Like cron, when both day fields are restricted a time matches if
+	// either does.
+	domAny, dowAny bool
+}
+
+// parseCron parses a five-field cron expression ("minute hour dom month
+// dow"). Fields accept *, numbers, ranges (a-b), lists (a,b) and steps
+// (*/n, a-b/n).
+func parseCron(expr string) (cronSpec, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return cronSpec{}, fmt.Errorf("%q: want 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(parts))
+	}
+	spec := cronSpec{expr: expr, domAny: parts[2] == "*", dowAny: parts[4] == "*"}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return cronSpec{}, fmt.Errorf("%q: %w", expr, err)
+		}
+		spec.fields[i] = bits
+	}
+	if spec.fields[4]&(1<<7) != 0 {
+		spec.fields[4] |= 1
+	}
+	return spec, nil
+}
+
+// parseCronField parses one comma-separated cron field into a bit set.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("%s: invalid value %q", f.name, loStr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("%s: invalid value %q", f.name, hiStr)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s: %q is outside %d-%d", f.name, item, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether t falls within a minute the expression selects.
+func (c cronSpec) matches(t time.Time) bool {
+	has := func(i, v int) bool { return c.fields[i]&(1<<v) != 0 }
+	if !has(0, t.Minute()) || !has(1, t.Hour()) || !has(3, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(2, t.Day()), has(4, int(t.Weekday()))
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// parseScaleBlackout compiles scale_blackout and its time zone.
+func (g *InstanceGroup) parseScaleBlackout() error {
+	if len(g.ScaleBlackout) == 0 {
+		return nil
+	}
+	g.blackoutLoc = time.UTC
+	if g.ScaleBlackoutTimezone != "" {
+		loc, err := time.LoadLocation(g.ScaleBlackoutTimezone)
+		if err != nil {
+			return fmt.Errorf("scale_blackout_timezone: %w", err)
+		}
+		g.blackoutLoc = loc
+	}
+	g.blackouts = g.blackouts[:0]
+	for _, expr := range g.ScaleBlackout {
+		spec, err := parseCron(expr)
+		if err != nil {
+			return fmt.Errorf("scale_blackout: %w", err)
+		}
+		g.blackouts = append(g.blackouts, spec)
+	}
+	return nil
+}
+
+// blackoutAt returns the scale_blackout entry covering t, if any.
+func (g *InstanceGroup) blackoutAt(t time.Time) (string, bool) {
+	if len(g.blackouts) == 0 {
+		return "", false
+	}
+	t = t.In(g.blackoutLoc)
+	for _, spec := range g.blackouts {
+		if spec.matches(t) {
+			return spec.expr, true
+		}
+	}
+	return "", false
+}
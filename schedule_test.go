@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── scale blackout windows ───────────────────────────────────────────────────
+
+func TestCronSpec_Matches(t *testing.T) {
+	// 2026-10-17 is a Saturday.
+	sat0630 := time.Date(2026, 10, 17, 6, 30, 0, 0, time.UTC)
+	mon1000 := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", mon1000, true},
+		{"* 0-6,20-23 * * *", sat0630, true},
+		{"* 0-6,20-23 * * *", mon1000, false},
+		{"* * * * 6,0", sat0630, true},
+		{"* * * * 7", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), true},
+		{"*/15 10 * * 1-5", mon1000, true},
+		{"*/15 10 * * 1-5", mon1000.Add(5 * time.Minute), false},
+		{"30/10 * * * *", sat0630.Add(20 * time.Minute), true},
+		// Both day fields restricted: either matches.
+		{"* * 1 * 6", sat0630, true},
+		{"* * 17 * 1", sat0630, true},
+		{"* * 1 * 1", sat0630, false},
+		{"* * * 1-9 *", sat0630, false},
+	}
+	for _, tc := range tests {
+		spec, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) unexpected error: %v", tc.expr, err)
+		}
+		if got := spec.matches(tc.t); got != tc.want {
+			t.Errorf("%q matches %s = %v, want %v", tc.expr, tc.t.Format(time.RFC1123), got, tc.want)
+		}
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 5-2 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) expected error", expr)
+		}
+	}
+}
+
+func TestIncrease_ScaleBlackout(t *testing.T) {
+	mock := newMockSvc()
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		t.Fatal("CreateServer called during a blackout")
+		return nil, nil
+	}
+
+	g := baseGroup(mock)
+	g.ScaleBlackout = []string{"* * * * *"}
+	if err := g.parseScaleBlackout(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := g.Increase(context.Background(), 2); n != 0 || err != nil {
+		t.Errorf("Increase() = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestValidate_ScaleBlackout(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "valid", mod: func(g *InstanceGroup) {
+			g.ScaleBlackout, g.ScaleBlackoutTimezone = []string{"* 0-6 * * *"}, "Europe/Helsinki"
+		}},
+		{name: "bad expression", mod: func(g *InstanceGroup) { g.ScaleBlackout = []string{"* 25 * * *"} }, wantErr: true},
+		{name: "bad time zone", mod: func(g *InstanceGroup) {
+			g.ScaleBlackout, g.ScaleBlackoutTimezone = []string{"* * * * *"}, "Mars/Olympus"
+		}, wantErr: true},
+		{name: "time zone alone", mod: func(g *InstanceGroup) { g.ScaleBlackoutTimezone = "UTC" }, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// cachedServer is a server's details as of at. Entries are replaced rather
+// than modified, so the details can be handed out without copying.
+type cachedServer struct {
+	details *upcloud.ServerDetails
+	at      time.Time
+}
+
+// refreshServerCache applies the state Update listed for a server to its
+// cached details. Details are only fetched when first needed, by
+// serverDetails, and expire ServerCacheTTL after that fetch however often
+// their state is refreshed.
+func (g *InstanceGroup) refreshServerCache(s upcloud.Server) {
+	if g.ServerCacheTTL <= 0 {
+		return
+	}
+	g.serverCacheMu.Lock()
+	defer g.serverCacheMu.Unlock()
+	e, ok := g.serverCache[s.UUID]
+	if !ok {
+		return
+	}
+	d := *e.details
+	d.State, d.Progress = s.State, s.Progress
+	g.serverCache[s.UUID] = cachedServer{details: &d, at: e.at}
+}
+
+// serverDetails returns a server's details from the cache if they are
+// younger than ServerCacheTTL, fetching and caching them otherwise.
+func (g *InstanceGroup) serverDetails(ctx context.Context, uuid string) (*upcloud.ServerDetails, error) {
+	if g.ServerCacheTTL > 0 {
+		g.serverCacheMu.Lock()
+		e, ok := g.serverCache[uuid]
+		g.serverCacheMu.Unlock()
+		if ok && time.Since(e.at) < time.Duration(g.ServerCacheTTL) {
+			return e.details, nil
+		}
+	}
+
+	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid})
+	if err != nil {
+		return nil, err
+	}
+	g.cacheServer(uuid, details)
+	return details, nil
+}
+
+// cacheServer stores freshly fetched server details.
+func (g *InstanceGroup) cacheServer(uuid string, details *upcloud.ServerDetails) {
+	if g.ServerCacheTTL <= 0 {
+		return
+	}
+	g.serverCacheMu.Lock()
+	defer g.serverCacheMu.Unlock()
+	if g.serverCache == nil {
+		g.serverCache = make(map[string]cachedServer)
+	}
+	g.serverCache[uuid] = cachedServer{details: details, at: time.Now()}
+}
+
+// uncacheServer drops a removed server from the caches.
+func (g *InstanceGroup) uncacheServer(uuid string) {
+	g.serverCacheMu.Lock()
+	defer g.serverCacheMu.Unlock()
+	delete(g.serverCache, uuid)
+	delete(g.connectInfos, uuid)
+}
+
+// cachedConnectInfo returns the cached connection details of an instance.
+func (g *InstanceGroup) cachedConnectInfo(uuid string) (provider.ConnectInfo, bool) {
+	if !g.ConnectInfoCache {
+		return provider.ConnectInfo{}, false
+	}
+	g.serverCacheMu.Lock()
+	defer g.serverCacheMu.Unlock()
+	info, ok := g.connectInfos[uuid]
+	return info, ok
+}
+
+// cacheConnectInfo stores the connection details of a running instance.
+// Instances still booting may not have all their addresses yet.
+func (g *InstanceGroup) cacheConnectInfo(details *upcloud.ServerDetails, info provider.ConnectInfo) {
+	if !g.ConnectInfoCache || details.State != upcloud.ServerStateStarted {
+		return
+	}
+	g.serverCacheMu.Lock()
+	defer g.serverCacheMu.Unlock()
+	if g.connectInfos == nil {
+		g.connectInfos = make(map[string]provider.ConnectInfo)
+	}
+	g.connectInfos[info.ID] = info
+}
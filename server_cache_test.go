@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── server cache ─────────────────────────────────────────────────────────────
+
+func TestServerCache_RefreshedByUpdate(t *testing.T) {
+	state := upcloud.ServerStateStarted
+	var calls int
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: state}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		d := makeDetails("1.2.3.4", "")
+		d.State = upcloud.ServerStateStarted
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.ServerCacheTTL = Duration(time.Minute)
+	update := func() {
+		if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+	}
+	update()
+	if calls != 0 {
+		t.Fatalf("GetServerDetails called %d times by Update, want none", calls)
+	}
+
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil || info.ExternalAddr != "1.2.3.4" {
+		t.Fatalf("ConnectInfo() = %q, %v, want 1.2.3.4", info.ExternalAddr, err)
+	}
+	update()
+	if err := g.Heartbeat(context.Background(), "uuid-1"); err != nil {
+		t.Fatalf("Heartbeat() unexpected error: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("GetServerDetails called %d times, want Heartbeat served from the cache", calls)
+	}
+
+	// Update refreshes the cached state.
+	state = upcloud.ServerStateError
+	update()
+	if err := g.Heartbeat(context.Background(), "uuid-1"); err == nil {
+		t.Error("Heartbeat() = nil after Update saw the error state, want error")
+	}
+}
+
+func TestServerCache_ExpiresDespiteUpdates(t *testing.T) {
+	var calls int
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	g := baseGroup(mock)
+	g.ServerCacheTTL = Duration(50 * time.Millisecond)
+	g.ConnectInfo(context.Background(), "uuid-1")
+	time.Sleep(60 * time.Millisecond)
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.ConnectInfo(context.Background(), "uuid-1")
+	if calls != 2 {
+		t.Errorf("GetServerDetails called %d times, want the expired entry fetched again", calls)
+	}
+}
+
+func TestServerCache_Disabled(t *testing.T) {
+	var calls int
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	g := baseGroup(mock)
+	g.ConnectInfo(context.Background(), "uuid-1")
+	g.ConnectInfo(context.Background(), "uuid-1")
+	if calls != 2 {
+		t.Errorf("GetServerDetails called %d times, want 2 without server_cache_ttl", calls)
+	}
+}
+
+func TestConnectInfo_Cache(t *testing.T) {
+	state := upcloud.ServerStateMaintenance
+	var calls int
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		d := makeDetails("1.2.3.4", "")
+		d.State = state
+		return d, nil
+	}
+
+	g := baseGroup(mock)
+	g.ConnectInfoCache = true
+	connect := func() {
+		if _, err := g.ConnectInfo(context.Background(), "uuid-1"); err != nil {
+			t.Fatalf("ConnectInfo() unexpected error: %v", err)
+		}
+	}
+	connect()
+	state = upcloud.ServerStateStarted
+	connect() // booting instances are not cached
+	connect()
+	if calls != 2 {
+		t.Errorf("GetServerDetails called %d times, want 2", calls)
+	}
+
+	g.forgetServer("uuid-1")
+	connect()
+	if calls != 3 {
+		t.Errorf("GetServerDetails called %d times after forgetServer, want 3", calls)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshDialTimeout bounds establishing the SSH connection for plugin-run commands.
+const sshDialTimeout = 30 * time.Second
+
+// runSSHCommand runs a command on an instance over SSH and returns its combined
+// output. Tests may replace this.
+var runSSHCommand = func(ctx context.Context, info provider.ConnectInfo, command string) ([]byte, error) {
+	var auth []ssh.AuthMethod
+	if len(info.Key) > 0 {
+		signer, err := ssh.ParsePrivateKey(info.Key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SSH key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if info.Password != "" {
+		auth = append(auth, ssh.Password(info.Password))
+	}
+
+	addr := info.ExternalAddr
+	if addr == "" {
+		addr = info.InternalAddr
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("instance %s has no address", info.ID)
+	}
+	port := info.ProtocolPort
+	if port == 0 {
+		port = provider.DefaultProtocolPorts[provider.ProtocolSSH]
+	}
+	addr = net.JoinHostPort(addr, strconv.Itoa(port))
+
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", addr, err)
+	}
+
+	// Closing the connection unblocks the handshake and the session if ctx
+	// expires first; the deadline covers a server stalling mid-handshake.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(sshDialTimeout))
+
+	cfg := &ssh.ClientConfig{
+		User: info.Username,
+		Auth: auth,
+		// Instances are ephemeral and freshly cloned, so there is no known host
+		// key to pin; the runner's own connector behaves the same way.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sshDialTimeout,
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("SSH handshake with %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("opening SSH session: %w", err)
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(command)
+	if ctx.Err() != nil {
+		return out, ctx.Err()
+	}
+	return out, err
+}
+
+// runOnInstance runs a command on one of this group's instances with the
+// connection details the runner would use.
+func (g *InstanceGroup) runOnInstance(ctx context.Context, uuid, command string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	info, err := g.ConnectInfo(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return runSSHCommand(ctx, info, command)
+}
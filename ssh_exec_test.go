@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer starts an SSH server on localhost that accepts the given client
+// key and answers every exec request with reply. It returns the listen port.
+func testSSHServer(t *testing.T, clientKey ssh.PublicKey, reply string) int {
+	t.Helper()
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					ch, requests, err := nc.Accept()
+					if err != nil {
+						continue
+					}
+					for req := range requests {
+						if req.Type != "exec" {
+							req.Reply(false, nil)
+							continue
+						}
+						req.Reply(true, nil)
+						ch.Write([]byte(reply))
+						ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+						ch.Close()
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestRunSSHCommand(t *testing.T) {
+	_, key, err := generateSSHKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := ssh.ParsePrivateKey(key)
+	port := testSSHServer(t, signer.PublicKey(), "hello")
+
+	info := provider.ConnectInfo{ConnectorConfig: provider.ConnectorConfig{Username: "root", Key: key, ProtocolPort: port}}
+	info.ExternalAddr = "127.0.0.1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := runSSHCommand(ctx, info, "echo hello")
+	if err != nil {
+		t.Fatalf("runSSHCommand() unexpected error: %v", err)
+	}
+	if string(out) != "hello" {
+		t.Errorf("output = %q, want hello", out)
+	}
+}
+
+func TestRunSSHCommand_NoAddress(t *testing.T) {
+	if _, err := runSSHCommand(context.Background(), provider.ConnectInfo{}, "true"); err == nil {
+		t.Fatal("runSSHCommand() expected error without an address, got nil")
+	}
+}
+
+func TestRunSSHCommand_WrongKey(t *testing.T) {
+	_, serverKey, _ := generateSSHKeyPair()
+	signer, _ := ssh.ParsePrivateKey(serverKey)
+	port := testSSHServer(t, signer.PublicKey(), "")
+
+	_, otherKey, _ := generateSSHKeyPair()
+	info := provider.ConnectInfo{ConnectorConfig: provider.ConnectorConfig{Username: "root", Key: otherKey, ProtocolPort: port}}
+	info.ExternalAddr = "127.0.0.1"
+
+	if _, err := runSSHCommand(context.Background(), info, "true"); err == nil {
+		t.Fatal("runSSHCommand() expected authentication error, got nil")
+	}
+}
+
+func TestRunSSHCommand_StalledHandshake(t *testing.T) {
+	// The server accepts the connection but never speaks SSH.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	_, key, _ := generateSSHKeyPair()
+	info := provider.ConnectInfo{ConnectorConfig: provider.ConnectorConfig{Username: "root", Key: key, ProtocolPort: ln.Addr().(*net.TCPAddr).Port}}
+	info.ExternalAddr = "127.0.0.1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := runSSHCommand(ctx, info, "true"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("runSSHCommand() error = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("runSSHCommand() took %s with a stalled handshake", d)
+	}
+}
+
+// stubSSH replaces runSSHCommand for the duration of a test.
+func stubSSH(t *testing.T, fn func(ctx context.Context, info provider.ConnectInfo, command string) ([]byte, error)) {
+	t.Helper()
+	orig := runSSHCommand
+	runSSHCommand = fn
+	t.Cleanup(func() { runSSHCommand = orig })
+}
+
+// ─── pre-delete hook ──────────────────────────────────────────────────────────
+
+func TestDecrease_RunsPreDeleteCommand(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		calls   []string
+		deleted []string
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		calls = append(calls, "stop")
+		mu.Unlock()
+		return &upcloud.ServerDetails{}, nil
+	}
+	stubSSH(t, func(_ context.Context, info provider.ConnectInfo, command string) ([]byte, error) {
+		mu.Lock()
+		calls = append(calls, "ssh:"+info.ExternalAddr+":"+command)
+		mu.Unlock()
+		return nil, nil
+	})
+
+	g := baseGroup(mock)
+	g.PreDeleteCommand = "docker logs > /dev/null"
+	g.PreDeleteTimeout = Duration(time.Minute)
+
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	want := []string{"ssh:1.2.3.4:docker logs > /dev/null", "stop"}
+	if len(calls) != 2 || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestDecrease_PreDeleteFailureIsNotFatal(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	stubRemoval(mock, &mu, &deleted)
+	stubSSH(t, func(context.Context, provider.ConnectInfo, string) ([]byte, error) {
+		return []byte("boom"), errors.New("exit status 1")
+	})
+
+	g := baseGroup(mock)
+	g.PreDeleteCommand = "false"
+	g.PreDeleteTimeout = Duration(time.Minute)
+
+	succeeded, err := g.Decrease(context.Background(), []string{"uuid-1"})
+	if err != nil || len(succeeded) != 1 {
+		t.Errorf("Decrease() = (%v, %v), want ([uuid-1], nil)", succeeded, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// generateSSHKeyPair creates a new ed25519 key pair and returns the public key
+// in authorized_keys format and the private key as an OpenSSH PEM block.
+func generateSSHKeyPair() (string, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("generating ed25519 key: %w", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return "", nil, fmt.Errorf("encoding public key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("encoding private key: %w", err)
+	}
+
+	return string(ssh.MarshalAuthorizedKey(sshPub)), pem.EncodeToMemory(block), nil
+}
+
+// parsePrivateKey parses a PEM private key, decrypting it with passphrase when
+// it is encrypted. For encrypted keys it also returns an unencrypted copy so the
+// runner can use the key without knowing the passphrase; for plain keys the
+// returned PEM is nil.
+func parsePrivateKey(key, passphrase []byte) (ssh.Signer, []byte, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if err == nil {
+		return signer, nil, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, nil, fmt.Errorf("key is passphrase-protected; set key_passphrase or key_passphrase_file")
+	}
+
+	raw, err := ssh.ParseRawPrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypting key: %w", err)
+	}
+	signer, err = ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(raw, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("re-encoding decrypted key: %w", err)
+	}
+	return signer, pem.EncodeToMemory(block), nil
+}
+
+// keyPassphrase returns the configured connector key passphrase, reading it
+// from key_passphrase_file if set. A single trailing newline is ignored.
+func (g *InstanceGroup) keyPassphrase() ([]byte, error) {
+	if g.KeyPassphraseFile == "" {
+		return []byte(g.KeyPassphrase), nil
+	}
+	b, err := os.ReadFile(g.KeyPassphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading key_passphrase_file: %w", err)
+	}
+	passphrase := strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	secrets.add(passphrase)
+	return []byte(passphrase), nil
+}
+
+// storeInstanceKey remembers the private key generated for a server.
+func (g *InstanceGroup) storeInstanceKey(uuid string, key []byte) {
+	g.keysMu.Lock()
+	defer g.keysMu.Unlock()
+	if g.instanceKeys == nil {
+		g.instanceKeys = make(map[string][]byte)
+	}
+	g.instanceKeys[uuid] = key
+}
+
+// instanceKey returns the private key generated for a server, if any.
+func (g *InstanceGroup) instanceKey(uuid string) ([]byte, bool) {
+	g.keysMu.Lock()
+	defer g.keysMu.Unlock()
+	key, ok := g.instanceKeys[uuid]
+	return key, ok
+}
+
+// forgetInstanceKey drops the private key of a removed server.
+func (g *InstanceGroup) forgetInstanceKey(uuid string) {
+	g.keysMu.Lock()
+	defer g.keysMu.Unlock()
+	delete(g.instanceKeys, uuid)
+}
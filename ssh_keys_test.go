@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/client"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+	"golang.org/x/crypto/ssh"
+)
+
+// ─── ephemeral SSH keys ───────────────────────────────────────────────────────
+
+func TestGenerateSSHKeyPair(t *testing.T) {
+	pub, priv, err := generateSSHKeyPair()
+	if err != nil {
+		t.Fatalf("generateSSHKeyPair() unexpected error: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatalf("private key does not parse: %v", err)
+	}
+	if got := string(ssh.MarshalAuthorizedKey(signer.PublicKey())); got != pub {
+		t.Errorf("public key = %q, want %q derived from private key", pub, got)
+	}
+
+	if pub2, _, _ := generateSSHKeyPair(); pub2 == pub {
+		t.Error("generateSSHKeyPair() returned the same key twice")
+	}
+}
+
+func TestEphemeralSSHKeys_RoundTrip(t *testing.T) {
+	var injected string
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		injected = r.LoginUser.SSHKeys[0]
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+	mock.modifyServer = func(_ context.Context, _ *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.stopServer = func(_ context.Context, _ *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, _ *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, _ *request.DeleteServerAndStoragesRequest) error {
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.EphemeralSSHKeys = true
+	g.publicKey = "ssh-ed25519 AAAA-connector-key"
+
+	if n, _ := g.Increase(context.Background(), 1); n != 1 {
+		t.Fatalf("Increase() = %d, want 1", n)
+	}
+	if injected == g.publicKey {
+		t.Fatal("connector key was injected instead of an ephemeral key")
+	}
+
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(info.Key)
+	if err != nil {
+		t.Fatalf("ConnectInfo().Key does not parse: %v", err)
+	}
+	if !bytes.Equal(ssh.MarshalAuthorizedKey(signer.PublicKey()), []byte(injected)) {
+		t.Error("ConnectInfo().Key does not match the injected public key")
+	}
+
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	if _, ok := g.instanceKey("uuid-1"); ok {
+		t.Error("ephemeral key still stored after Decrease")
+	}
+}
+
+func TestConnectInfo_EphemeralKeyUnknown(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	g := baseGroup(mock)
+	g.EphemeralSSHKeys = true
+	if _, err := g.ConnectInfo(context.Background(), "uuid-1"); err == nil {
+		t.Fatal("ConnectInfo() expected error for server without a stored key, got nil")
+	}
+}
+
+// ─── passphrase-protected connector keys ──────────────────────────────────────
+
+// encryptedKey returns an ed25519 private key PEM encrypted with passphrase.
+func encryptedKey(t *testing.T, passphrase string) []byte {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(block)
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	_, plain, err := generateSSHKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := encryptedKey(t, "s3cret")
+
+	tests := []struct {
+		name          string
+		key           []byte
+		passphrase    string
+		wantErr       bool
+		wantDecrypted bool
+	}{
+		{name: "plain key", key: plain},
+		{name: "plain key ignores passphrase", key: plain, passphrase: "unused"},
+		{name: "encrypted key", key: encrypted, passphrase: "s3cret", wantDecrypted: true},
+		{name: "encrypted key without passphrase", key: encrypted, wantErr: true},
+		{name: "encrypted key with wrong passphrase", key: encrypted, passphrase: "wrong", wantErr: true},
+		{name: "garbage", key: []byte("not-a-key"), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, decrypted, err := parsePrivateKey(tc.key, []byte(tc.passphrase))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parsePrivateKey() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if (decrypted != nil) != tc.wantDecrypted {
+				t.Fatalf("decrypted = %v, want present = %v", decrypted != nil, tc.wantDecrypted)
+			}
+			if decrypted != nil {
+				plainSigner, err := ssh.ParsePrivateKey(decrypted)
+				if err != nil {
+					t.Fatalf("decrypted key does not parse without passphrase: %v", err)
+				}
+				if !bytes.Equal(plainSigner.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+					t.Error("decrypted key does not match the original")
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPassphrase_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &InstanceGroup{KeyPassphraseFile: path}
+	got, err := g.keyPassphrase()
+	if err != nil {
+		t.Fatalf("keyPassphrase() unexpected error: %v", err)
+	}
+	if string(got) != "s3cret" {
+		t.Errorf("keyPassphrase() = %q, want s3cret", got)
+	}
+
+	g.KeyPassphraseFile = filepath.Join(t.TempDir(), "missing")
+	if _, err := g.keyPassphrase(); err == nil {
+		t.Error("keyPassphrase() expected error for missing file, got nil")
+	}
+}
+
+func TestInit_EncryptedConnectorKey(t *testing.T) {
+	mock := newMockSvc()
+	mock.getAccount = func(context.Context) (*upcloud.Account, error) {
+		return &upcloud.Account{}, nil
+	}
+	noServers(mock)
+	knownZone(mock, "z")
+	knownPlan(mock)
+	validTemplate(mock)
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	orig := newUpcloudService
+	newUpcloudService = func(_ *client.Client) upcloudSvc { return mock }
+	defer func() { newUpcloudService = orig }()
+
+	key := encryptedKey(t, "s3cret")
+	g := &InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "test-group", KeyPassphrase: "s3cret"}
+	settings := provider.Settings{ConnectorConfig: provider.ConnectorConfig{Key: key}}
+	if _, err := g.Init(context.Background(), hclog.NewNullLogger(), settings); err != nil {
+		t.Fatalf("Init() unexpected error: %v", err)
+	}
+	if g.publicKey == "" {
+		t.Error("publicKey not derived from encrypted connector key")
+	}
+
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKey(info.Key); err != nil {
+		t.Errorf("ConnectInfo().Key is not a usable unencrypted key: %v", err)
+	}
+}
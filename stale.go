@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// createdAtLabelKey holds the Unix time at which the plugin created a server.
+const createdAtLabelKey = "fleeting-created-at"
+
+// runningAtLabelKey holds the Unix time at which a server was first seen
+// running, so a restarted plugin does not take a later maintenance window
+// for a hung provisioning.
+const runningAtLabelKey = "fleeting-running-at"
+
+// recordCreated remembers when a server was created so Update does not have to
+// read the created-at label back from the API.
+func (g *InstanceGroup) recordCreated(uuid string, at time.Time) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if g.createdAt == nil {
+		g.createdAt = make(map[string]time.Time)
+	}
+	g.createdAt[uuid] = at
+}
+
+// markRunning records that a server reached the running state at least once,
+// so a later maintenance window is not mistaken for a hung provisioning. The
+// first time, the latency from the create request is recorded.
+func (g *InstanceGroup) markRunning(uuid string) {
+	g.staleMu.Lock()
+	if g.seenRunning == nil {
+		g.seenRunning = make(map[string]bool)
+	}
+	first := !g.seenRunning[uuid]
+	created, known := g.createdAt[uuid]
+	g.seenRunning[uuid] = true
+	g.staleMu.Unlock()
+
+	if first && known {
+		g.observeInstance("time_to_running", uuid, time.Since(created))
+	}
+}
+
+// hasRun reports whether a server is known to have reached running.
+func (g *InstanceGroup) hasRun(uuid string) bool {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	return g.seenRunning[uuid]
+}
+
+// setRunningLabelled records that a server carries the running-at label,
+// which also means it reached running.
+func (g *InstanceGroup) setRunningLabelled(uuid string) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if g.seenRunning == nil {
+		g.seenRunning = make(map[string]bool)
+	}
+	if g.runningLabelled == nil {
+		g.runningLabelled = make(map[string]bool)
+	}
+	g.seenRunning[uuid] = true
+	g.runningLabelled[uuid] = true
+}
+
+// labelRunning adds the running-at label to a running server once, keeping
+// its existing labels since ModifyServer replaces the whole set. Failures
+// are logged and retried on the next Update.
+func (g *InstanceGroup) labelRunning(ctx context.Context, uuid string) {
+	g.staleMu.Lock()
+	done := g.runningLabelled[uuid]
+	g.staleMu.Unlock()
+	if done {
+		return
+	}
+
+	log := g.logger(logGC)
+	details, err := g.serverDetails(ctx, uuid)
+	if err != nil {
+		log.Warn("failed to read server labels", "uuid", uuid, "error", err)
+		return
+	}
+	if _, ok := labelValueOf(details.Labels, runningAtLabelKey); !ok {
+		labels := append(slices.Clone(details.Labels), upcloud.Label{Key: runningAtLabelKey, Value: strconv.FormatInt(time.Now().Unix(), 10)})
+		if _, err := g.svc.ModifyServer(ctx, &request.ModifyServerRequest{UUID: uuid, Labels: &labels}); err != nil {
+			log.Warn("failed to label server as running", "uuid", uuid, "error", err)
+			return
+		}
+		g.uncacheServer(uuid)
+	}
+	g.setRunningLabelled(uuid)
+}
+
+// forgetServer drops all stale-tracking state for a removed server.
+func (g *InstanceGroup) forgetServer(uuid string) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	delete(g.createdAt, uuid)
+	delete(g.seenRunning, uuid)
+	delete(g.runningLabelled, uuid)
+	delete(g.deleting, uuid)
+	delete(g.graceUntil, uuid)
+	g.forgetHeartbeat(uuid)
+	g.uncacheServer(uuid)
+	g.forgetPrivateIPs(uuid)
+}
+
+// serverCreatedAt returns the creation time of a server, falling back to its
+// created-at label for servers created before the last plugin restart. A
+// running-at label read along the way is recorded with setRunningLabelled.
+func (g *InstanceGroup) serverCreatedAt(ctx context.Context, uuid string) (time.Time, bool) {
+	g.staleMu.Lock()
+	at, ok := g.createdAt[uuid]
+	g.staleMu.Unlock()
+	if ok {
+		return at, true
+	}
+
+	details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: uuid})
+	if err != nil {
+		g.logger(logGC).Warn("failed to read server creation time", "uuid", uuid, "error", err)
+		return time.Time{}, false
+	}
+	if _, labelled := labelValueOf(details.Labels, runningAtLabelKey); labelled {
+		g.setRunningLabelled(uuid)
+	}
+	at, ok = parseCreatedAt(details.Labels)
+	if ok {
+		g.recordCreated(uuid, at)
+	}
+	return at, ok
+}
+
+// parseCreatedAt extracts the created-at label value.
+func parseCreatedAt(labels upcloud.LabelSlice) (time.Time, bool) {
+	for _, l := range labels {
+		if l.Key != createdAtLabelKey {
+			continue
+		}
+		sec, err := strconv.ParseInt(l.Value, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// checkStale inspects a server that is still provisioning. Servers that never
+// reached running within StaleInstanceTimeout are removed in the background and
+// reported as deleting; those past ProvisioningTimeout are reported as timed
+// out. Servers seen running before, by this process or going by their
+// running-at label by an earlier one, and everything else keep their current
+// state.
+func (g *InstanceGroup) checkStale(ctx context.Context, uuid string, state provider.State) provider.State {
+	if g.hasRun(uuid) {
+		return state
+	}
+
+	created, ok := g.serverCreatedAt(ctx, uuid)
+	if !ok || g.hasRun(uuid) {
+		return state
+	}
+	age := time.Since(created)
+	switch {
+	case g.StaleInstanceTimeout > 0 && age >= time.Duration(g.StaleInstanceTimeout):
+		g.logger(logGC).Warn("server never reached running; removing it", "uuid", uuid, "age", age.Round(time.Second))
+		g.markUnhealthy(uuid, "never reached running")
+		g.deleteInBackground(uuid)
+		return provider.StateDeleting
+	case g.ProvisioningTimeout > 0 && age >= time.Duration(g.ProvisioningTimeout):
+		g.logger(logGC).Warn("server stuck provisioning; reporting timeout", "uuid", uuid, "age", age.Round(time.Second))
+		g.markUnhealthy(uuid, "provisioning timed out")
+		return provider.StateTimeout
+	}
+	return state
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── stale instances ──────────────────────────────────────────────────────────
+
+func TestParseCreatedAt(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		labels upcloud.LabelSlice
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "present", labels: upcloud.LabelSlice{{Key: createdAtLabelKey, Value: "1700000000"}}, want: at, wantOK: true},
+		{name: "missing", labels: upcloud.LabelSlice{{Key: groupLabelKey, Value: "g"}}},
+		{name: "malformed", labels: upcloud.LabelSlice{{Key: createdAtLabelKey, Value: "yesterday"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseCreatedAt(tc.labels)
+			if ok != tc.wantOK || !got.Equal(tc.want) {
+				t.Errorf("parseCreatedAt() = (%v, %v), want (%v, %v)", got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// staleMock returns a mock listing a single server in state "maintenance"
+// whose created-at label is age old, recording removed servers in deleted.
+func staleMock(age time.Duration, deleted *[]string, mu *sync.Mutex) *mockSvc {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(_ context.Context, _ *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateMaintenance}}}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, _ *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		created := strconv.FormatInt(time.Now().Add(-age).Unix(), 10)
+		return &upcloud.ServerDetails{Labels: upcloud.LabelSlice{
+			{Key: groupLabelKey, Value: "test-group"},
+			{Key: createdAtLabelKey, Value: created},
+		}}, nil
+	}
+	mock.modifyServer = func(_ context.Context, _ *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.stopServer = func(_ context.Context, _ *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(_ context.Context, _ *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.deleteServerAndStorages = func(_ context.Context, r *request.DeleteServerAndStoragesRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*deleted = append(*deleted, r.UUID)
+		return nil
+	}
+	return mock
+}
+
+func TestUpdate_ReapsStaleInstance(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(staleMock(time.Hour, &deleted, &mu))
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+
+	var got provider.State
+	if err := g.Update(context.Background(), func(_ string, s provider.State) { got = s }); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	if got != provider.StateDeleting {
+		t.Errorf("state = %v, want StateDeleting", got)
+	}
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() unexpected error: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "uuid-1" {
+		t.Errorf("deleted = %v, want [uuid-1]", deleted)
+	}
+}
+
+func TestUpdate_KeepsYoungInstance(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(staleMock(time.Minute, &deleted, &mu))
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateCreating {
+		t.Errorf("state = %v, want StateCreating", got)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
+
+func TestUpdate_KeepsInstanceThatWasRunning(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(staleMock(time.Hour, &deleted, &mu))
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+	g.markRunning("uuid-1")
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateCreating {
+		t.Errorf("state = %v, want StateCreating (server in maintenance after running)", got)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
+
+func TestUpdate_ReportsProvisioningTimeout(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(staleMock(time.Hour, &deleted, &mu))
+	g.ProvisioningTimeout = Duration(30 * time.Minute)
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateTimeout {
+		t.Errorf("state = %v, want StateTimeout", got)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none (removal is left to the runner)", deleted)
+	}
+}
+
+func TestUpdate_StaleTimeoutTakesPrecedence(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	g := baseGroup(staleMock(time.Hour, &deleted, &mu))
+	g.ProvisioningTimeout = Duration(10 * time.Minute)
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateDeleting || len(deleted) != 1 {
+		t.Errorf("state = %v, deleted = %v, want StateDeleting and [uuid-1]", got, deleted)
+	}
+}
+
+// labelledStaleMock is staleMock with the server carrying the running-at
+// label of an earlier plugin process.
+func labelledStaleMock(age time.Duration, deleted *[]string, mu *sync.Mutex) *mockSvc {
+	mock := staleMock(age, deleted, mu)
+	details := mock.getServerDetails
+	mock.getServerDetails = func(ctx context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d, err := details(ctx, r)
+		d.Labels = append(d.Labels, upcloud.Label{Key: runningAtLabelKey, Value: "1700000000"})
+		return d, err
+	}
+	return mock
+}
+
+func TestUpdate_KeepsLabelledInstanceAfterRestart(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	// A fresh group knows nothing of the server running before the restart.
+	g := baseGroup(labelledStaleMock(time.Hour, &deleted, &mu))
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateCreating {
+		t.Errorf("state = %v, want StateCreating (server in maintenance after running)", got)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v, want none", deleted)
+	}
+}
+
+func TestUpdate_LabelsRunningInstance(t *testing.T) {
+	var modified []upcloud.LabelSlice
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", ""), nil
+	}
+	mock.modifyServer = func(_ context.Context, r *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		modified = append(modified, *r.Labels)
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.StaleInstanceTimeout = Duration(30 * time.Minute)
+	for range 2 {
+		if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+			t.Fatalf("Update() unexpected error: %v", err)
+		}
+	}
+	if len(modified) != 1 {
+		t.Fatalf("labelled %d times, want once", len(modified))
+	}
+	if _, ok := labelValue(modified[0], runningAtLabelKey); !ok {
+		t.Errorf("labels = %v, want the running-at label", modified[0])
+	}
+	if v, _ := labelValue(modified[0], groupLabelKey); v != "test-group" {
+		t.Errorf("labels = %v, want the group label kept", modified[0])
+	}
+}
+
+func TestUpdate_NoTimeoutForLabelledInstanceAfterRestart(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	// A fresh group knows nothing of the server running before the restart.
+	g := baseGroup(labelledStaleMock(time.Hour, &deleted, &mu))
+	g.ProvisioningTimeout = Duration(20 * time.Minute)
+
+	var got provider.State
+	g.Update(context.Background(), func(_ string, s provider.State) { got = s })
+	g.Shutdown(context.Background())
+
+	if got != provider.StateCreating {
+		t.Errorf("state = %v, want StateCreating rather than a timeout", got)
+	}
+	if _, unhealthy := g.unhealthyReason("uuid-1"); unhealthy {
+		t.Error("server marked unhealthy")
+	}
+}
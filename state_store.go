@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// Pending operation kinds recorded in the state file.
+const (
+	pendingCreate = "create"
+	pendingDelete = "delete"
+)
+
+// pendingOp is an in-flight operation that must be finished or cleaned up if
+// the plugin restarts before it completes.
+type pendingOp struct {
+	Op       string    `json:"op"`
+	UUID     string    `json:"uuid,omitempty"`
+	Hostname string    `json:"hostname,omitempty"`
+	Started  time.Time `json:"started"`
+}
+
+// instanceRecord is the lifetime of one server the plugin created, kept
+// for the billing command.
+type instanceRecord struct {
+	UUID     string    `json:"uuid"`
+	Hostname string    `json:"hostname"`
+	Zone     string    `json:"zone"`
+	Plan     string    `json:"plan"`
+	Created  time.Time `json:"created"`
+	Deleted  time.Time `json:"deleted,omitzero"`
+}
+
+// instanceHistoryRetention is how long records of deleted servers are kept,
+// enough to answer for the past year.
+const instanceHistoryRetention = 400 * 24 * time.Hour
+
+// historySuffix names the instance history file kept next to the state
+// file. The history grows with every server created, so it is appended to
+// line by line rather than rewritten with the pending operations.
+const historySuffix = ".history"
+
+// historyLockSuffix names the file locked around every access to the
+// history. It is separate from the history since compaction replaces that.
+const historyLockSuffix = ".history.lock"
+
+// stateFile is the layout of state files written while the instance history
+// was kept inside them; they are migrated on load. Current state files hold
+// only the pending map.
+type stateFile struct {
+	Pending   map[string]pendingOp `json:"pending"`
+	Instances []instanceRecord     `json:"instances,omitempty"`
+}
+
+// stateStore persists pending operations to a small JSON file and the
+// history of created servers to an append-only file next to it. A nil store
+// is valid and records nothing.
+type stateStore struct {
+	mu          sync.Mutex
+	path        string
+	pending     map[string]pendingOp // by hostname for creates, UUID for deletes
+	historyOnly bool                 // pending operations belong to another process
+}
+
+// openHistory returns a store that only appends to the instance history of
+// the state file at path, for commands running next to the plugin that owns
+// the pending operations. It returns nil when path is empty.
+func openHistory(path string) *stateStore {
+	if path == "" {
+		return nil
+	}
+	return &stateStore{path: path, historyOnly: true}
+}
+
+// loadStateStore reads the state file at path, starting empty if it does not
+// exist yet. It returns nil when path is empty.
+func loadStateStore(path string) (*stateStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	s := &stateStore{path: path, pending: make(map[string]pendingOp)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state_file: %w", err)
+	}
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing state_file %s: %w", path, err)
+	}
+	if f.Pending == nil && f.Instances == nil {
+		if err := json.Unmarshal(data, &s.pending); err != nil {
+			return nil, fmt.Errorf("parsing state_file %s: %w", path, err)
+		}
+		return s, nil
+	}
+
+	// Move the history out of a state file that still holds it.
+	if f.Pending != nil {
+		s.pending = f.Pending
+	}
+	for _, rec := range f.Instances {
+		if err := s.appendHistory(rec); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.save()
+}
+
+// put records a pending operation under key.
+func (s *stateStore) put(key string, op pendingOp) error {
+	if s == nil || s.historyOnly {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[key] = op
+	return s.save()
+}
+
+// remove drops the pending operation under key.
+func (s *stateStore) remove(key string) error {
+	if s == nil || s.historyOnly {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[key]; !ok {
+		return nil
+	}
+	delete(s.pending, key)
+	return s.save()
+}
+
+// snapshot returns a copy of all pending operations.
+func (s *stateStore) snapshot() map[string]pendingOp {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]pendingOp, len(s.pending))
+	for k, v := range s.pending {
+		out[k] = v
+	}
+	return out
+}
+
+// save writes the state file atomically. Callers hold s.mu.
+func (s *stateStore) save() error {
+	data, err := json.MarshalIndent(s.pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("writing state_file: %w", err)
+	}
+	return nil
+}
+
+// addInstance records a newly created server.
+func (s *stateStore) addInstance(rec instanceRecord) error {
+	if s == nil {
+		return nil
+	}
+	return s.appendHistory(rec)
+}
+
+// instanceDeleted records when a server was deleted.
+func (s *stateStore) instanceDeleted(uuid string, at time.Time) error {
+	if s == nil {
+		return nil
+	}
+	return s.appendHistory(instanceRecord{UUID: uuid, Deleted: at})
+}
+
+// appendHistory adds one line to the history file: a created server, or
+// only the UUID and deletion time of a deleted one.
+func (s *stateStore) appendHistory(rec instanceRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, err := os.OpenFile(s.path+historySuffix, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing instance history: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing instance history: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing instance history: %w", err)
+	}
+	return nil
+}
+
+// history returns the recorded servers, folding deletions into the records
+// of the servers they belong to.
+func (s *stateStore) history() ([]instanceRecord, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lockHistory()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return readHistory(s.path + historySuffix)
+}
+
+// lockHistory takes the history lock, which other processes using the same
+// state file, such as the scale command next to the plugin, honour too.
+// The returned function releases it.
+func (s *stateStore) lockHistory() (func(), error) {
+	f, err := os.OpenFile(s.path+historyLockSuffix, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("locking instance history: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking instance history: %w", err)
+	}
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
+
+// compactHistory rewrites the history file with one line per server,
+// dropping servers deleted more than instanceHistoryRetention ago. It holds
+// the history lock throughout, so appends from other processes wait rather
+// than land in the file being replaced.
+func (s *stateStore) compactHistory() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lockHistory()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	path := s.path + historySuffix
+	records, err := readHistory(path)
+	if err != nil || records == nil {
+		return err
+	}
+	var buf []byte
+	for _, rec := range records {
+		if !rec.Deleted.IsZero() && time.Since(rec.Deleted) > instanceHistoryRetention {
+			continue
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if err := writeFileAtomic(path, buf); err != nil {
+		return fmt.Errorf("compacting instance history: %w", err)
+	}
+	return nil
+}
+
+// readHistory parses the history file at path; a missing file is empty.
+func readHistory(path string) ([]instanceRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading instance history: %w", err)
+	}
+	defer f.Close()
+
+	var records []instanceRecord
+	byUUID := map[string]int{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec instanceRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// A torn last line from a crash mid-append.
+			continue
+		}
+		i, known := byUUID[rec.UUID]
+		switch {
+		case !rec.Created.IsZero() && !known:
+			byUUID[rec.UUID] = len(records)
+			records = append(records, rec)
+		case rec.Created.IsZero() && known && records[i].Deleted.IsZero():
+			records[i].Deleted = rec.Deleted
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading instance history: %w", err)
+	}
+	return records, nil
+}
+
+// writeFileAtomic replaces the file at path with data.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// track records a pending operation, logging rather than failing when the
+// state file cannot be written.
+func (g *InstanceGroup) track(key string, op pendingOp) {
+	if err := g.store.put(key, op); err != nil {
+		g.log.Warn("failed to record pending operation", "op", op.Op, "key", key, "error", err)
+	}
+}
+
+// untrack drops a pending operation once it has completed.
+func (g *InstanceGroup) untrack(key string) {
+	if err := g.store.remove(key); err != nil {
+		g.log.Warn("failed to clear pending operation", "key", key, "error", err)
+	}
+}
+
+// recordInstance adds a newly created server to the instance history.
+func (g *InstanceGroup) recordInstance(details *upcloud.ServerDetails, at time.Time) {
+	rec := instanceRecord{UUID: details.UUID, Hostname: details.Hostname, Zone: details.Zone, Plan: details.Plan, Created: at}
+	if err := g.store.addInstance(rec); err != nil {
+		g.log.Warn("failed to record instance history", "uuid", details.UUID, "error", err)
+	}
+}
+
+// recordDeleted marks a server as deleted in the instance history.
+func (g *InstanceGroup) recordDeleted(uuid string) {
+	if err := g.store.instanceDeleted(uuid, time.Now()); err != nil {
+		g.log.Warn("failed to record instance history", "uuid", uuid, "error", err)
+	}
+}
+
+// recoverPending finishes or cleans up operations left behind by a previous
+// plugin process. Interrupted deletions are resumed; servers whose creation
+// was interrupted are removed, since their setup (floating IP, ephemeral key)
+// never completed.
+func (g *InstanceGroup) recoverPending(ctx context.Context) error {
+	pending := g.store.snapshot()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: g.groupFilters(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing servers: %w", err)
+	}
+	byUUID := make(map[string]bool, len(servers.Servers))
+	byHostname := make(map[string]string, len(servers.Servers))
+	for _, s := range servers.Servers {
+		byUUID[s.UUID] = true
+		byHostname[s.Hostname] = s.UUID
+	}
+
+	for key, op := range pending {
+		switch op.Op {
+		case pendingDelete:
+			if byUUID[op.UUID] {
+				g.log.Info("resuming interrupted deletion", "uuid", op.UUID, "hostname", op.Hostname)
+				// stopAndDelete clears the entry once the server is gone.
+				g.deleteInBackground(op.UUID)
+				continue
+			}
+		case pendingCreate:
+			if uuid, ok := byHostname[op.Hostname]; ok {
+				g.log.Info("removing server with interrupted creation", "uuid", uuid, "hostname", op.Hostname)
+				// Kept until the server is gone, so a failed removal is
+				// retried on the next restart.
+				g.deleteInBackgroundThen(uuid, func() { g.untrack(key) })
+				continue
+			}
+		}
+		g.untrack(key)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── persistent state store ───────────────────────────────────────────────────
+
+func TestStateStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("loadStateStore() unexpected error: %v", err)
+	}
+	if err := s.put("uuid-1", pendingOp{Op: pendingDelete, UUID: "uuid-1"}); err != nil {
+		t.Fatalf("put() unexpected error: %v", err)
+	}
+	if err := s.put("host-a", pendingOp{Op: pendingCreate, Hostname: "host-a"}); err != nil {
+		t.Fatalf("put() unexpected error: %v", err)
+	}
+	if err := s.remove("host-a"); err != nil {
+		t.Fatalf("remove() unexpected error: %v", err)
+	}
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("loadStateStore() reload unexpected error: %v", err)
+	}
+	got := reloaded.snapshot()
+	if len(got) != 1 || got["uuid-1"].Op != pendingDelete {
+		t.Errorf("reloaded state = %+v, want only the pending delete", got)
+	}
+}
+
+func TestStateStore_Disabled(t *testing.T) {
+	s, err := loadStateStore("")
+	if err != nil || s != nil {
+		t.Fatalf("loadStateStore(\"\") = %v, %v; want nil, nil", s, err)
+	}
+	// A nil store must be safe to use.
+	if err := s.put("k", pendingOp{}); err != nil {
+		t.Errorf("nil put() = %v", err)
+	}
+	if err := s.remove("k"); err != nil {
+		t.Errorf("nil remove() = %v", err)
+	}
+}
+
+func TestStateStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStateStore(path); err == nil {
+		t.Fatal("loadStateStore() expected error for corrupt file, got nil")
+	}
+}
+
+func TestIncrease_ClearsPendingCreate(t *testing.T) {
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		// Both the successful and the failed creation must be cleared.
+		calls++
+		if calls == 2 {
+			return nil, errors.New("quota exceeded")
+		}
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1"}}, nil
+	}
+
+	g := baseGroup(mock)
+	var err error
+	if g.store, err = loadStateStore(filepath.Join(t.TempDir(), "state.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.Increase(context.Background(), 2); err != nil {
+		t.Fatalf("Increase() unexpected error: %v", err)
+	}
+	if pending := g.store.snapshot(); len(pending) != 0 {
+		t.Errorf("pending after Increase = %+v, want none", pending)
+	}
+}
+
+func TestRecoverPending(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "uuid-del", Hostname: "host-del"},
+			{UUID: "uuid-new", Hostname: "host-new"},
+			{UUID: "uuid-ok", Hostname: "host-ok"},
+		}}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	prev, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	prev.put("uuid-del", pendingOp{Op: pendingDelete, UUID: "uuid-del", Started: now})
+	prev.put("uuid-gone", pendingOp{Op: pendingDelete, UUID: "uuid-gone", Started: now})
+	prev.put("host-new", pendingOp{Op: pendingCreate, Hostname: "host-new", Started: now})
+	prev.put("host-never", pendingOp{Op: pendingCreate, Hostname: "host-never", Started: now})
+
+	g := baseGroup(mock)
+	if g.store, err = loadStateStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.recoverPending(context.Background()); err != nil {
+		t.Fatalf("recoverPending() unexpected error: %v", err)
+	}
+	g.Shutdown(context.Background())
+
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "uuid-del" || deleted[1] != "uuid-new" {
+		t.Errorf("deleted = %v, want [uuid-del uuid-new]", deleted)
+	}
+	if pending := g.store.snapshot(); len(pending) != 0 {
+		t.Errorf("pending after recovery = %+v, want none", pending)
+	}
+}
+
+func TestStateStore_OldLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	old := `{"uuid-1": {"op": "delete", "uuid": "uuid-1", "started": "2026-01-01T00:00:00Z"}}`
+	if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("loadStateStore() unexpected error: %v", err)
+	}
+	if got := s.snapshot(); got["uuid-1"].Op != pendingDelete {
+		t.Errorf("pending = %+v, want the delete from the old layout", got)
+	}
+}
+
+func TestStateStore_InstanceHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	s.addInstance(instanceRecord{UUID: "uuid-1", Plan: "1xCPU-2GB", Created: created})
+	s.addInstance(instanceRecord{UUID: "uuid-old", Created: created.AddDate(-2, 0, 0), Deleted: created.AddDate(-2, 0, 0)})
+	s.instanceDeleted("uuid-1", created.Add(30*time.Minute))
+	s.instanceDeleted("uuid-1", created.Add(time.Hour))
+	s.put("uuid-2", pendingOp{Op: pendingDelete, UUID: "uuid-2"})
+
+	// The history stays out of the state file.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "uuid-1") {
+		t.Errorf("state file = %s, want only pending operations", data)
+	}
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.compactHistory(); err != nil {
+		t.Fatalf("compactHistory() unexpected error: %v", err)
+	}
+	h, err := reloaded.history()
+	if err != nil {
+		t.Fatalf("history() unexpected error: %v", err)
+	}
+	if len(h) != 1 || h[0].UUID != "uuid-1" || !h[0].Deleted.Equal(created.Add(30*time.Minute)) {
+		t.Errorf("history = %+v, want only uuid-1 deleted after 30m", h)
+	}
+	if got := reloaded.snapshot(); got["uuid-2"].Op != pendingDelete {
+		t.Errorf("pending = %+v, want the delete kept", got)
+	}
+}
+
+func TestStateStore_MigratesHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	old := `{"pending": {"uuid-2": {"op": "delete", "uuid": "uuid-2", "started": "2026-01-01T00:00:00Z"}},
+		"instances": [{"uuid": "uuid-1", "created": "2026-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(path, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadStateStore(path)
+	if err != nil {
+		t.Fatalf("loadStateStore() unexpected error: %v", err)
+	}
+	if got := s.snapshot(); got["uuid-2"].Op != pendingDelete {
+		t.Errorf("pending = %+v, want the delete kept", got)
+	}
+	if h, _ := s.history(); len(h) != 1 || h[0].UUID != "uuid-1" {
+		t.Errorf("history = %+v, want uuid-1 moved to the history file", h)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "instances") {
+		t.Errorf("state file = %s, want the history moved out", data)
+	}
+}
+
+func TestStateStore_HistoryOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	owner, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner.put("host-1", pendingOp{Op: pendingCreate, Hostname: "host-1"})
+
+	// A second process must not rewrite the owner's pending operations.
+	s := openHistory(path)
+	s.put("host-2", pendingOp{Op: pendingCreate, Hostname: "host-2"})
+	s.remove("host-1")
+	s.addInstance(instanceRecord{UUID: "uuid-1", Created: time.Now()})
+
+	reloaded, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := reloaded.snapshot(); len(p) != 1 || p["host-1"].Op != pendingCreate {
+		t.Errorf("pending = %v, want only the owner's host-1", p)
+	}
+	if h, err := reloaded.history(); err != nil || len(h) != 1 || h[0].UUID != "uuid-1" {
+		t.Errorf("history() = %v, %v, want uuid-1", h, err)
+	}
+}
+
+func TestStateStore_HistoryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := s.lockHistory()
+	if err != nil {
+		t.Fatalf("lockHistory() unexpected error: %v", err)
+	}
+
+	// Another process appending, e.g. the scale command, waits for the lock.
+	done := make(chan error)
+	go func() { done <- openHistory(path).addInstance(instanceRecord{UUID: "uuid-1", Created: time.Now()}) }()
+	select {
+	case err := <-done:
+		t.Fatalf("addInstance() = %v while the history was locked", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("addInstance() unexpected error: %v", err)
+	}
+	if h, err := s.history(); err != nil || len(h) != 1 {
+		t.Errorf("history() = %v, %v, want uuid-1", h, err)
+	}
+}
+
+func TestRecoverPending_KeepsCreateUntilRemoved(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-new", Hostname: "host-new"}}}, nil
+	}
+	mock.deleteServerAndStorages = func(context.Context, *request.DeleteServerAndStoragesRequest) error {
+		return errors.New("api error")
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	prev, err := loadStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev.put("host-new", pendingOp{Op: pendingCreate, Hostname: "host-new", Started: time.Now()})
+
+	g := baseGroup(mock)
+	if g.store, err = loadStateStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.recoverPending(context.Background()); err != nil {
+		t.Fatalf("recoverPending() unexpected error: %v", err)
+	}
+	g.Shutdown(context.Background())
+
+	if _, ok := g.store.snapshot()["host-new"]; !ok {
+		t.Error("pending create dropped although the server could not be removed")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// serverStatus describes one group server for the status command.
+type serverStatus struct {
+	UUID       string            `json:"uuid"`
+	Hostname   string            `json:"hostname"`
+	State      string            `json:"state"`
+	PublicIPs  []string          `json:"public_ips"`
+	PrivateIPs []string          `json:"private_ips"`
+	CreatedAt  *time.Time        `json:"created_at,omitempty"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// runStatus implements `status --config <file> [--format table|json]`.
+func runStatus(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("status", stdout)
+	format := fs.String("format", "table", `output format: "table" or "json"`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	g, err := loadGroup(ctx, *config)
+	if err != nil {
+		return err
+	}
+	servers, err := g.collectStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(servers)
+	}
+	return writeStatusTable(stdout, servers, g.GroupLabelKey, time.Now())
+}
+
+// collectStatus lists the group's servers with their addresses and labels.
+func (g *InstanceGroup) collectStatus(ctx context.Context) ([]serverStatus, error) {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{
+		Filters: g.groupFilters(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing group servers: %w", err)
+	}
+
+	out := make([]serverStatus, 0, len(servers.Servers))
+	for _, s := range servers.Servers {
+		details, err := g.svc.GetServerDetails(ctx, &request.GetServerDetailsRequest{UUID: s.UUID})
+		if err != nil {
+			return nil, fmt.Errorf("getting server details for %s: %w", s.UUID, err)
+		}
+
+		st := serverStatus{
+			UUID:       s.UUID,
+			Hostname:   s.Hostname,
+			State:      s.State,
+			PublicIPs:  []string{},
+			PrivateIPs: []string{},
+			Labels:     make(map[string]string, len(details.Labels)),
+		}
+		for _, ip := range details.IPAddresses {
+			if ip.Access == upcloud.IPAddressAccessPublic {
+				st.PublicIPs = append(st.PublicIPs, ip.Address)
+			} else {
+				st.PrivateIPs = append(st.PrivateIPs, ip.Address)
+			}
+		}
+		for _, l := range details.Labels {
+			st.Labels[l.Key] = l.Value
+		}
+		if at, ok := parseCreatedAt(details.Labels); ok {
+			st.CreatedAt = &at
+		}
+		out = append(out, st)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Hostname < out[j].Hostname })
+	return out, nil
+}
+
+// writeStatusTable prints servers as an aligned table. The group label is the
+// same on every row and left out; the JSON format carries all labels.
+func writeStatusTable(w io.Writer, servers []serverStatus, groupKey string, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tHOSTNAME\tSTATE\tPUBLIC IP\tPRIVATE IP\tAGE\tLABELS")
+	for _, s := range servers {
+		age := "-"
+		if s.CreatedAt != nil {
+			age = now.Sub(*s.CreatedAt).Truncate(time.Second).String()
+		}
+
+		var labels []string
+		for k, v := range s.Labels {
+			if k != groupKey {
+				labels = append(labels, k+"="+v)
+			}
+		}
+		sort.Strings(labels)
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.UUID, s.Hostname, s.State,
+			orDash(strings.Join(s.PublicIPs, ",")),
+			orDash(strings.Join(s.PrivateIPs, ",")),
+			age,
+			orDash(strings.Join(labels, ",")),
+		)
+	}
+	return tw.Flush()
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/client"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── status command ───────────────────────────────────────────────────────────
+
+// statusMock returns a mock group with two servers, one without any address.
+func statusMock(created time.Time) *mockSvc {
+	mock := newMockSvc()
+	mock.getAccount = func(context.Context) (*upcloud.Account, error) {
+		return &upcloud.Account{}, nil
+	}
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{
+			{UUID: "uuid-2", Hostname: "fleeting-b", State: upcloud.ServerStateMaintenance},
+			{UUID: "uuid-1", Hostname: "fleeting-a", State: upcloud.ServerStateStarted},
+		}}, nil
+	}
+	mock.getServerDetails = func(_ context.Context, r *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		if r.UUID == "uuid-2" {
+			return &upcloud.ServerDetails{}, nil
+		}
+		d := makeDetails("1.2.3.4", "10.0.0.5")
+		d.Labels = upcloud.LabelSlice{
+			{Key: groupLabelKey, Value: "test-group"},
+			{Key: createdAtLabelKey, Value: strconv.FormatInt(created.Unix(), 10)},
+		}
+		return d, nil
+	}
+	return mock
+}
+
+func TestCollectStatus(t *testing.T) {
+	created := time.Unix(1700000000, 0)
+	g := baseGroup(statusMock(created))
+
+	servers, err := g.collectStatus(context.Background())
+	if err != nil {
+		t.Fatalf("collectStatus() unexpected error: %v", err)
+	}
+	if len(servers) != 2 || servers[0].Hostname != "fleeting-a" {
+		t.Fatalf("collectStatus() = %+v, want two servers sorted by hostname", servers)
+	}
+	a := servers[0]
+	if len(a.PublicIPs) != 1 || a.PublicIPs[0] != "1.2.3.4" || len(a.PrivateIPs) != 1 || a.PrivateIPs[0] != "10.0.0.5" {
+		t.Errorf("addresses = %v / %v", a.PublicIPs, a.PrivateIPs)
+	}
+	if a.CreatedAt == nil || !a.CreatedAt.Equal(created) {
+		t.Errorf("CreatedAt = %v, want %v", a.CreatedAt, created)
+	}
+	if servers[1].CreatedAt != nil {
+		t.Errorf("CreatedAt = %v for unlabelled server, want nil", servers[1].CreatedAt)
+	}
+}
+
+func TestWriteStatusTable(t *testing.T) {
+	created := time.Unix(1700000000, 0)
+	servers := []serverStatus{
+		{UUID: "uuid-1", Hostname: "fleeting-a", State: "started", PublicIPs: []string{"1.2.3.4"}, CreatedAt: &created,
+			Labels: map[string]string{groupLabelKey: "test-group", versionLabelKey: "1.0.0"}},
+		{UUID: "uuid-2", Hostname: "fleeting-b", State: "maintenance"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeStatusTable(&buf, servers, groupLabelKey, created.Add(90*time.Minute)); err != nil {
+		t.Fatalf("writeStatusTable() unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want header and two rows:\n%s", len(lines), buf.String())
+	}
+	if f := strings.Fields(lines[1]); len(f) != 7 || f[5] != "1h30m0s" || f[6] != versionLabelKey+"=1.0.0" {
+		t.Errorf("row = %q", lines[1])
+	}
+	if f := strings.Fields(lines[2]); len(f) != 7 || f[3] != "-" || f[5] != "-" {
+		t.Errorf("row = %q", lines[2])
+	}
+}
+
+func TestRunStatus_JSON(t *testing.T) {
+	orig := newUpcloudService
+	newUpcloudService = func(_ *client.Client) upcloudSvc { return statusMock(time.Now()) }
+	defer func() { newUpcloudService = orig }()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"token": "tok", "zone": "fi-hel1", "template": "t", "name": "test-group"}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := runStatus(context.Background(), []string{"--config", path, "--format", "json"}, &buf); err != nil {
+		t.Fatalf("runStatus() unexpected error: %v", err)
+	}
+	var servers []serverStatus
+	if err := json.Unmarshal(buf.Bytes(), &servers); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if len(servers) != 2 {
+		t.Errorf("got %d servers, want 2", len(servers))
+	}
+}
+
+func TestRunStatus_MissingConfig(t *testing.T) {
+	if err := runStatus(context.Background(), nil, &bytes.Buffer{}); err == nil {
+		t.Fatal("runStatus() expected error without --config, got nil")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Labels on the disks of the group: the hostname of the server a disk was
+// created for and, for disks kept by PreserveStorages, when they were
+// detached.
+const (
+	storageServerLabelKey = "fleeting-server"
+	preservedLabelKey     = "fleeting-preserved" // Unix time
+)
+
+// storageGCInterval is how often Update looks for storages to clean up.
+const storageGCInterval = 10 * time.Minute
+
+// storageLabels returns the labels identifying a disk of the group created
+// for hostname, plus its cost center.
+func (g *InstanceGroup) storageLabels(hostname string) []upcloud.Label {
+	labels := []upcloud.Label{{Key: g.GroupLabelKey, Value: g.Name}}
+	for _, k := range slices.Sorted(maps.Keys(g.LabelFilters)) {
+		labels = append(labels, upcloud.Label{Key: k, Value: g.LabelFilters[k]})
+	}
+	if g.CostCenter != "" {
+		labels = append(labels, upcloud.Label{Key: g.CostCenterLabelKey, Value: g.CostCenter})
+	}
+	return append(labels, upcloud.Label{Key: storageServerLabelKey, Value: hostname})
+}
+
+// labelStorages labels the disks of a newly created server so they can be
+// recognised as the group's should the server disappear without them.
+// Storages cannot be labelled in the create request itself.
+func (g *InstanceGroup) labelStorages(ctx context.Context, log hclog.Logger, details *upcloud.ServerDetails) {
+	for _, d := range details.StorageDevices {
+		if d.Type != upcloud.StorageTypeDisk {
+			continue
+		}
+		labels := g.storageLabels(details.Hostname)
+		if _, err := g.svc.ModifyStorage(ctx, &request.ModifyStorageRequest{UUID: d.UUID, Labels: &labels}); err != nil {
+			log.Warn("failed to label storage", "storage", d.UUID, "error", err)
+		}
+	}
+}
+
+// deleteServerKeepStorages deletes a server but keeps its disks, labelling
+// them with the group labels and the time they were preserved so they can
+// be found, and removed after PreservedStorageRetention.
+func (g *InstanceGroup) deleteServerKeepStorages(ctx context.Context, log hclog.Logger, uuid string, details *upcloud.ServerDetails) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, d := range details.StorageDevices {
+		if d.Type != upcloud.StorageTypeDisk {
+			continue
+		}
+		labels := append(g.storageLabels(details.Hostname), upcloud.Label{Key: preservedLabelKey, Value: now})
+		if _, err := g.svc.ModifyStorage(ctx, &request.ModifyStorageRequest{UUID: d.UUID, Labels: &labels}); err != nil {
+			// Unlabelled, the disk would never be cleaned up.
+			return fmt.Errorf("labelling storage %s for preservation: %w", d.UUID, err)
+		}
+		log.Info("preserving storage of removed instance", "storage", d.UUID, "title", d.Title)
+	}
+	if err := g.svc.DeleteServer(ctx, &request.DeleteServerRequest{UUID: uuid}); err != nil {
+		return fmt.Errorf("deleting server %s: %w", uuid, err)
+	}
+	return nil
+}
+
+// maybeCollectStorages starts a background storage cleanup if the last one
+// is at least storageGCInterval old. Update calls it on every cycle.
+func (g *InstanceGroup) maybeCollectStorages() {
+	if g.PreservedStorageRetention <= 0 && g.OrphanedStorageGrace <= 0 {
+		return
+	}
+	g.staleMu.Lock()
+	if time.Since(g.storageGCAt) < storageGCInterval {
+		g.staleMu.Unlock()
+		return
+	}
+	g.storageGCAt = time.Now()
+	g.staleMu.Unlock()
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		ctx, cancel := context.WithTimeout(g.probeContext(), backgroundDeleteTimeout)
+		defer cancel()
+		if err := g.collectStorages(ctx); err != nil {
+			g.logger(logGC).Warn("failed to clean up storages", "error", err)
+		}
+	}()
+}
+
+// collectStorages deletes the group's preserved disks older than
+// PreservedStorageRetention, and disks whose server has been gone for
+// OrphanedStorageGrace, e.g. after an interrupted deletion.
+func (g *InstanceGroup) collectStorages(ctx context.Context) error {
+	log := g.logger(logGC)
+	// The API lists storages by type or by access, not both; group labels
+	// only ever sit on private disks, but check anyway.
+	storages, err := g.svc.GetStorages(ctx, &request.GetStoragesRequest{
+		Type:    upcloud.StorageTypeNormal,
+		Filters: g.groupFilters(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing group storages: %w", err)
+	}
+	var live map[string]bool
+	if g.OrphanedStorageGrace > 0 {
+		if live, err = g.liveHostnames(ctx); err != nil {
+			return err
+		}
+	}
+
+	orphans := map[string]bool{}
+	for _, s := range storages.Storages {
+		if s.Access != upcloud.StorageAccessPrivate {
+			continue
+		}
+		// Preserved disks are only ever removed by their retention.
+		if _, preserved := labelValueOf(s.Labels, preservedLabelKey); preserved {
+			at, ok := preservedAt(s.Labels)
+			if ok && g.PreservedStorageRetention > 0 && time.Since(at) >= time.Duration(g.PreservedStorageRetention) {
+				g.deleteStorage(ctx, log, s, "deleted preserved storage past its retention")
+			}
+			continue
+		}
+		hostname, ok := labelValueOf(s.Labels, storageServerLabelKey)
+		if live == nil || !ok || live[hostname] {
+			continue
+		}
+		orphans[s.UUID] = true
+		if time.Since(g.orphanedSince(s.UUID)) < time.Duration(g.OrphanedStorageGrace) {
+			continue
+		}
+		// The listing says nothing about attachments; make sure the disk
+		// is not in use before deleting it.
+		details, err := g.svc.GetStorageDetails(ctx, &request.GetStorageDetailsRequest{UUID: s.UUID})
+		if err != nil {
+			log.Warn("failed to read orphaned storage", "storage", s.UUID, "error", err)
+			continue
+		}
+		if len(details.ServerUUIDs) > 0 {
+			continue
+		}
+		g.deleteStorage(ctx, log, s, "deleted orphaned storage")
+	}
+	g.pruneOrphans(orphans)
+	return nil
+}
+
+// liveHostnames returns the hostnames of the group's servers.
+func (g *InstanceGroup) liveHostnames(ctx context.Context) (map[string]bool, error) {
+	servers, err := g.svc.GetServersWithFilters(ctx, &request.GetServersWithFiltersRequest{Filters: g.groupFilters()})
+	if err != nil {
+		return nil, fmt.Errorf("listing group servers: %w", err)
+	}
+	live := make(map[string]bool, len(servers.Servers))
+	for _, s := range servers.Servers {
+		live[s.Hostname] = true
+	}
+	return live, nil
+}
+
+// backupsMode tells UpCloud what to do with the backups of storages the
+// plugin deletes.
+func (g *InstanceGroup) backupsMode() request.DeleteStorageBackupsMode {
+	if g.KeepBackups {
+		return request.DeleteStorageBackupsModeKeep
+	}
+	return request.DeleteStorageBackupsModeDelete
+}
+
+// deleteStorage deletes a storage found by collectStorages.
+func (g *InstanceGroup) deleteStorage(ctx context.Context, log hclog.Logger, s upcloud.Storage, msg string) {
+	if err := g.svc.DeleteStorage(ctx, &request.DeleteStorageRequest{UUID: s.UUID, Backups: g.backupsMode()}); err != nil {
+		log.Warn("failed to delete storage", "storage", s.UUID, "error", err)
+		return
+	}
+	log.Info(msg, "storage", s.UUID, "title", s.Title)
+}
+
+// orphanedSince returns when collectStorages first found a storage without
+// its server.
+func (g *InstanceGroup) orphanedSince(uuid string) time.Time {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	if g.orphans == nil {
+		g.orphans = make(map[string]time.Time)
+	}
+	if _, ok := g.orphans[uuid]; !ok {
+		g.orphans[uuid] = time.Now()
+	}
+	return g.orphans[uuid]
+}
+
+// pruneOrphans forgets storages that are no longer orphaned or gone.
+func (g *InstanceGroup) pruneOrphans(current map[string]bool) {
+	g.staleMu.Lock()
+	defer g.staleMu.Unlock()
+	for uuid := range g.orphans {
+		if !current[uuid] {
+			delete(g.orphans, uuid)
+		}
+	}
+}
+
+// labelValueOf returns the value of the label key.
+func labelValueOf(labels []upcloud.Label, key string) (string, bool) {
+	for _, l := range labels {
+		if l.Key == key {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// preservedAt extracts the preserved label value.
+func preservedAt(labels []upcloud.Label) (time.Time, bool) {
+	v, ok := labelValueOf(labels, preservedLabelKey)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	return time.Unix(sec, 0), err == nil
+}
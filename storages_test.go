@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── preserved storages ───────────────────────────────────────────────────────
+
+func TestDecrease_PreserveStorages(t *testing.T) {
+	var labelled []string
+	var deletedServer string
+	mock := newMockSvc()
+	allowDeletionLabel(mock)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		d := makeDetails("", "")
+		d.Hostname = "fleeting-abc"
+		d.StorageDevices = upcloud.ServerStorageDeviceSlice{
+			{UUID: "disk-1", Type: upcloud.StorageTypeDisk},
+			{UUID: "cdrom-1", Type: upcloud.StorageTypeCDROM},
+		}
+		return d, nil
+	}
+	mock.stopServer = func(context.Context, *request.StopServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.waitForServerState = func(context.Context, *request.WaitForServerStateRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+	mock.modifyStorage = func(_ context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+		labels := upcloud.LabelSlice(*r.Labels)
+		if v, _ := labelValue(labels, groupLabelKey); v != "test-group" {
+			t.Errorf("storage group label = %q, want test-group", v)
+		}
+		if v, _ := labelValue(labels, storageServerLabelKey); v != "fleeting-abc" {
+			t.Errorf("storage %s label = %q, want fleeting-abc", storageServerLabelKey, v)
+		}
+		labelled = append(labelled, r.UUID)
+		return &upcloud.StorageDetails{}, nil
+	}
+	mock.deleteServer = func(_ context.Context, r *request.DeleteServerRequest) error {
+		deletedServer = r.UUID
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.PreserveStorages = true
+	if _, err := g.Decrease(context.Background(), []string{"uuid-1"}); err != nil {
+		t.Fatalf("Decrease() unexpected error: %v", err)
+	}
+	if !slices.Equal(labelled, []string{"disk-1"}) || deletedServer != "uuid-1" {
+		t.Errorf("labelled %v and deleted server %q, want [disk-1] and uuid-1", labelled, deletedServer)
+	}
+}
+
+func TestCollectStorages_Retention(t *testing.T) {
+	preserved := func(ago time.Duration) []upcloud.Label {
+		return []upcloud.Label{{Key: preservedLabelKey, Value: strconv.FormatInt(time.Now().Add(-ago).Unix(), 10)}}
+	}
+	var deleted []string
+	mock := newMockSvc()
+	mock.getStorages = func(context.Context, *request.GetStoragesRequest) (*upcloud.Storages, error) {
+		return &upcloud.Storages{Storages: []upcloud.Storage{
+			{UUID: "old", Access: upcloud.StorageAccessPrivate, Labels: preserved(48 * time.Hour)},
+			{UUID: "recent", Access: upcloud.StorageAccessPrivate, Labels: preserved(time.Hour)},
+		}}, nil
+	}
+	mock.deleteStorage = func(_ context.Context, r *request.DeleteStorageRequest) error {
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.PreservedStorageRetention = Duration(24 * time.Hour)
+	if err := g.collectStorages(context.Background()); err != nil {
+		t.Fatalf("collectStorages() unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{"old"}) {
+		t.Errorf("deleted = %v, want [old]", deleted)
+	}
+}
+
+func TestCollectStorages_Request(t *testing.T) {
+	var url string
+	var deleted []string
+	mock := newMockSvc()
+	mock.getStorages = func(_ context.Context, r *request.GetStoragesRequest) (*upcloud.Storages, error) {
+		url = r.RequestURL()
+		labels := []upcloud.Label{{Key: preservedLabelKey, Value: "1"}}
+		return &upcloud.Storages{Storages: []upcloud.Storage{
+			{UUID: "private", Access: upcloud.StorageAccessPrivate, Labels: labels},
+			{UUID: "public", Access: upcloud.StorageAccessPublic, Labels: labels},
+		}}, nil
+	}
+	mock.deleteStorage = func(_ context.Context, r *request.DeleteStorageRequest) error {
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.PreservedStorageRetention = Duration(time.Hour)
+	if err := g.collectStorages(context.Background()); err != nil {
+		t.Fatalf("collectStorages() unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(url, "/storage/normal?") {
+		t.Errorf("listed %q, want /storage/normal with label filters", url)
+	}
+	if !slices.Equal(deleted, []string{"private"}) {
+		t.Errorf("deleted = %v, want only the private storage", deleted)
+	}
+}
+
+func TestCollectStorages_Orphans(t *testing.T) {
+	owned := func(hostname string) []upcloud.Label {
+		return []upcloud.Label{{Key: groupLabelKey, Value: "test-group"}, {Key: storageServerLabelKey, Value: hostname}}
+	}
+	var deleted []string
+	mock := newMockSvc()
+	mock.getStorages = func(context.Context, *request.GetStoragesRequest) (*upcloud.Storages, error) {
+		return &upcloud.Storages{Storages: []upcloud.Storage{
+			{UUID: "in-use", Access: upcloud.StorageAccessPrivate, Labels: owned("fleeting-live")},
+			{UUID: "orphan", Access: upcloud.StorageAccessPrivate, Labels: owned("fleeting-gone")},
+			{UUID: "still-attached", Access: upcloud.StorageAccessPrivate, Labels: owned("fleeting-renamed")},
+			{UUID: "preserved", Access: upcloud.StorageAccessPrivate, Labels: append(owned("fleeting-gone"), upcloud.Label{Key: preservedLabelKey, Value: "1"})},
+		}}, nil
+	}
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{Hostname: "fleeting-live"}}}, nil
+	}
+	mock.getStorageDetails = func(_ context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+		d := &upcloud.StorageDetails{}
+		if r.UUID == "still-attached" {
+			d.ServerUUIDs = upcloud.ServerUUIDSlice{"uuid-9"}
+		}
+		return d, nil
+	}
+	mock.deleteStorage = func(_ context.Context, r *request.DeleteStorageRequest) error {
+		deleted = append(deleted, r.UUID)
+		return nil
+	}
+
+	g := baseGroup(mock)
+	g.OrphanedStorageGrace = Duration(time.Hour)
+	g.collectStorages(context.Background())
+	if len(deleted) != 0 {
+		t.Fatalf("deleted = %v within the grace period", deleted)
+	}
+
+	g.orphans["orphan"] = time.Now().Add(-2 * time.Hour)
+	g.orphans["still-attached"] = time.Now().Add(-2 * time.Hour)
+	if err := g.collectStorages(context.Background()); err != nil {
+		t.Fatalf("collectStorages() unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{"orphan"}) {
+		t.Errorf("deleted = %v, want [orphan]", deleted)
+	}
+}
+
+func TestIncrease_LabelsStorages(t *testing.T) {
+	var labels upcloud.LabelSlice
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		d := &upcloud.ServerDetails{}
+		d.UUID, d.Hostname = "uuid-1", r.Hostname
+		d.StorageDevices = upcloud.ServerStorageDeviceSlice{{UUID: "disk-1", Type: upcloud.StorageTypeDisk}}
+		return d, nil
+	}
+	mock.modifyStorage = func(_ context.Context, r *request.ModifyStorageRequest) (*upcloud.StorageDetails, error) {
+		labels = *r.Labels
+		return &upcloud.StorageDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.OrphanedStorageGrace = Duration(time.Hour)
+	g.Increase(context.Background(), 1)
+	if v, _ := labelValue(labels, groupLabelKey); v != "test-group" {
+		t.Errorf("storage labels = %v, want the group label", labels)
+	}
+	if _, ok := labelValue(labels, storageServerLabelKey); !ok {
+		t.Errorf("storage labels = %v, want %s", labels, storageServerLabelKey)
+	}
+}
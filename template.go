@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// templateSelectorCacheTTL is how long a template picked by
+// template_selector is reused before storages are listed again.
+const templateSelectorCacheTTL = 10 * time.Minute
+
+// templateInfo is the metadata of the configured template, fetched at Init.
+type templateInfo struct {
+	Title        string
+	Size         int    // GiB; the minimum root storage size
+	TemplateType string // "cloud-init" or "native"
+	Access       string // "public" or "private"
+	Zone         string
+}
+
+// arch returns the architecture of the group's instances. validate defaults
+// DefaultArch to the plan's architecture and rejects a connector_config arch
+// that contradicts it.
+func (g *InstanceGroup) arch() string {
+	if g.settings.ConnectorConfig.Arch != "" {
+		return g.settings.ConnectorConfig.Arch
+	}
+	return g.DefaultArch
+}
+
+// planArch returns the architecture a plan implies, or "" when its name does
+// not tell. UpCloud's plan listing carries no architecture, so ARM plans are
+// recognised by an "ARM" part in their name.
+func planArch(plan string) string {
+	for part := range strings.SplitSeq(plan, "-") {
+		if strings.EqualFold(part, "ARM") {
+			return "arm64"
+		}
+	}
+	return ""
+}
+
+// templateUUID returns the template to clone for the group's architecture.
+func (g *InstanceGroup) templateUUID() string {
+	if g.templateOverride != "" {
+		return g.templateOverride
+	}
+	if g.templateSelected != "" {
+		return g.templateSelected
+	}
+	if t, ok := g.TemplatesByZone[g.Zone]; ok {
+		return t
+	}
+	if t, ok := g.Templates[g.arch()]; ok {
+		return t
+	}
+	return g.Template
+}
+
+// templateForZone returns the template to clone in zone: its
+// templates_by_zone entry, or the group's template for other zones.
+func (g *InstanceGroup) templateForZone(zone string) string {
+	if t, ok := g.TemplatesByZone[zone]; ok && zone != g.Zone {
+		return t
+	}
+	return g.templateUUID()
+}
+
+// checkZoneTemplates verifies the templates_by_zone entries of the fallback
+// zones, which checkTemplate does not cover.
+func (g *InstanceGroup) checkZoneTemplates(ctx context.Context) error {
+	for _, zone := range g.FallbackZones {
+		uuid, ok := g.TemplatesByZone[zone]
+		if !ok {
+			continue
+		}
+		if _, err := g.lookupTemplateIn(ctx, uuid, zone); err != nil {
+			return fmt.Errorf("templates_by_zone.%s: %w", zone, err)
+		}
+	}
+	return nil
+}
+
+// checkTemplate fetches the configured template storage and verifies it can
+// be cloned in the configured zone, so a mistyped UUID fails at Init instead
+// of at the first CreateServer.
+func (g *InstanceGroup) checkTemplate(ctx context.Context) error {
+	uuid := g.templateUUID()
+	if uuid == "" {
+		return fmt.Errorf("no template configured for arch %s; set template or templates.%s", g.arch(), g.arch())
+	}
+
+	info, err := g.lookupTemplate(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	g.useTemplate(info)
+	return nil
+}
+
+// lookupTemplate fetches a template storage and verifies it can be cloned in
+// the configured zone.
+func (g *InstanceGroup) lookupTemplate(ctx context.Context, uuid string) (templateInfo, error) {
+	return g.lookupTemplateIn(ctx, uuid, g.Zone)
+}
+
+// lookupTemplateIn fetches a template storage and verifies it can be cloned
+// in zone.
+func (g *InstanceGroup) lookupTemplateIn(ctx context.Context, uuid, zone string) (templateInfo, error) {
+	s, err := g.svc.GetStorageDetails(ctx, &request.GetStorageDetailsRequest{UUID: uuid})
+	if err != nil {
+		return templateInfo{}, fmt.Errorf("looking up template %s: %w", uuid, err)
+	}
+	if s.Type != upcloud.StorageTypeTemplate {
+		return templateInfo{}, fmt.Errorf("template %s (%s) is a %s storage, not a template", uuid, s.Title, s.Type)
+	}
+	// Public templates are available everywhere; private ones only in the
+	// zone they were created in.
+	if s.Access == upcloud.StorageAccessPrivate && s.Zone != "" && s.Zone != zone {
+		return templateInfo{}, fmt.Errorf("template %s (%s) is in zone %s, not %s", uuid, s.Title, s.Zone, zone)
+	}
+	return storageTemplateInfo(s.Storage), nil
+}
+
+// storageTemplateInfo extracts the template metadata the plugin caches.
+func storageTemplateInfo(s upcloud.Storage) templateInfo {
+	return templateInfo{
+		Title:        s.Title,
+		Size:         s.Size,
+		TemplateType: s.TemplateType,
+		Access:       s.Access,
+		Zone:         s.Zone,
+	}
+}
+
+// selectTemplate picks the newest private template in the zone matching
+// TemplateSelector. The pick is reused for templateSelectorCacheTTL to keep
+// scale-ups from listing storages every time.
+func (g *InstanceGroup) selectTemplate(ctx context.Context) error {
+	if len(g.TemplateSelector) == 0 || time.Since(g.templateSelectedAt) < templateSelectorCacheTTL {
+		return nil
+	}
+
+	var filters []request.QueryFilter
+	for _, k := range slices.Sorted(maps.Keys(g.TemplateSelector)) {
+		filters = append(filters, request.FilterLabel{Label: upcloud.Label{Key: k, Value: g.TemplateSelector[k]}})
+	}
+	// The API lists storages by type or by access, not both.
+	storages, err := g.svc.GetStorages(ctx, &request.GetStoragesRequest{
+		Type:    upcloud.StorageTypeTemplate,
+		Filters: filters,
+	})
+	if err != nil {
+		return fmt.Errorf("listing templates matching template_selector: %w", err)
+	}
+
+	var newest *upcloud.Storage
+	for i, s := range storages.Storages {
+		if s.Zone != g.Zone || s.Access != upcloud.StorageAccessPrivate {
+			continue
+		}
+		if newest == nil || s.Created.After(newest.Created) {
+			newest = &storages.Storages[i]
+		}
+	}
+	if newest == nil {
+		return fmt.Errorf("no template in zone %s matches template_selector %v", g.Zone, g.TemplateSelector)
+	}
+	g.templateSelectedAt = time.Now()
+
+	if newest.UUID == g.templateSelected {
+		return nil
+	}
+	if g.templateSelected != "" {
+		g.log.Info("selected newer template for new instances", "template", newest.UUID, "title", newest.Title, "previous", g.templateSelected)
+	}
+	g.templateSelected = newest.UUID
+	// A template_file override keeps precedence over the selector.
+	if g.templateOverride == "" {
+		g.useTemplate(storageTemplateInfo(*newest))
+	}
+	return nil
+}
+
+// useTemplate caches the metadata of the template new servers are cloned
+// from, warning about settings it makes ineffective.
+func (g *InstanceGroup) useTemplate(info templateInfo) {
+	g.template = info
+	if g.StorageSize > 0 && g.StorageSize < info.Size {
+		g.log.Warn("storage_size is smaller than the template; using the template size", "storage_size", g.StorageSize, "template_size", info.Size)
+	}
+	if g.hasUserData() && info.TemplateType == upcloud.StorageTemplateTypeNative {
+		g.log.Warn("template does not support cloud-init; user_data will be ignored", "template", info.Title)
+	}
+}
+
+// refreshTemplate switches to the template named in TemplateFile when the
+// file changed since it was last read. Servers created earlier keep running
+// on their old image until the runner retires them. An unusable template is
+// logged and the current one kept.
+func (g *InstanceGroup) refreshTemplate(ctx context.Context) {
+	if g.TemplateFile == "" {
+		return
+	}
+	fi, err := os.Stat(g.TemplateFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			g.log.Warn("failed to read template_file", "path", g.TemplateFile, "error", err)
+		}
+		return
+	}
+	if fi.ModTime().Equal(g.templateFileMod) {
+		return
+	}
+	data, err := os.ReadFile(g.TemplateFile)
+	if err != nil {
+		g.log.Warn("failed to read template_file", "path", g.TemplateFile, "error", err)
+		return
+	}
+	g.templateFileMod = fi.ModTime()
+
+	uuid := strings.TrimSpace(string(data))
+	if uuid == "" || uuid == g.templateUUID() {
+		return
+	}
+	info, err := g.lookupTemplate(ctx, uuid)
+	if err != nil {
+		g.log.Warn("ignoring template from template_file", "path", g.TemplateFile, "error", err)
+		return
+	}
+	previous := g.templateUUID()
+	g.templateOverride = uuid
+	g.useTemplate(info)
+	g.log.Info("switched template for new instances", "template", uuid, "title", info.Title, "previous", previous)
+}
+
+// writeTemplateFile atomically replaces the template file with uuid.
+func writeTemplateFile(path, uuid string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing template file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(uuid + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing template file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing template file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("writing template file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing template file: %w", err)
+	}
+	return nil
+}
+
+// runSetTemplate implements `set-template --config <file> <template-uuid>`.
+func runSetTemplate(ctx context.Context, args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("set-template", stdout)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one template UUID")
+	}
+	uuid := fs.Arg(0)
+
+	g, err := loadGroup(ctx, *config)
+	if err != nil {
+		return err
+	}
+	if g.TemplateFile == "" {
+		return fmt.Errorf("template_file is not set in the plugin config")
+	}
+	info, err := g.lookupTemplate(ctx, uuid)
+	if err != nil {
+		return err
+	}
+	if err := writeTemplateFile(g.TemplateFile, uuid); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "New instances of group %s will be cloned from %s (%s).\n", g.Name, uuid, info.Title)
+	return nil
+}
+
+// rootStorageSize returns the size to request for the cloned root storage:
+// storage_size, raised to the template's size since UpCloud rejects clones
+// smaller than their source. Zero lets the API pick the template's size.
+func (g *InstanceGroup) rootStorageSize() int {
+	return max(g.StorageSize, g.template.Size)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/client"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── template validation ──────────────────────────────────────────────────────
+
+func TestCheckTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage upcloud.Storage
+		err     error
+		wantErr bool
+	}{
+		{
+			name:    "public template",
+			storage: upcloud.Storage{Type: upcloud.StorageTypeTemplate, Access: upcloud.StorageAccessPublic, Size: 10},
+		},
+		{
+			name:    "private template in zone",
+			storage: upcloud.Storage{Type: upcloud.StorageTypeTemplate, Access: upcloud.StorageAccessPrivate, Zone: "fi-hel1", Size: 25},
+		},
+		{
+			name:    "private template in another zone",
+			storage: upcloud.Storage{Type: upcloud.StorageTypeTemplate, Access: upcloud.StorageAccessPrivate, Zone: "de-fra1"},
+			wantErr: true,
+		},
+		{
+			name:    "not a template",
+			storage: upcloud.Storage{Type: upcloud.StorageTypeNormal, Access: upcloud.StorageAccessPrivate, Zone: "fi-hel1"},
+			wantErr: true,
+		},
+		{
+			name:    "not found",
+			err:     &upcloud.Problem{Status: 404, Title: "Storage not found"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newMockSvc()
+			mock.getStorageDetails = func(_ context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+				if r.UUID != "template-uuid" {
+					t.Errorf("looked up %q, want template-uuid", r.UUID)
+				}
+				if tc.err != nil {
+					return nil, tc.err
+				}
+				return &upcloud.StorageDetails{Storage: tc.storage}, nil
+			}
+
+			g := baseGroup(mock)
+			err := g.checkTemplate(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("checkTemplate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("checkTemplate() error = %v, want it to wrap %v", err, tc.err)
+			}
+			if !tc.wantErr && g.template.Size != tc.storage.Size {
+				t.Errorf("cached template size = %d, want %d", g.template.Size, tc.storage.Size)
+			}
+		})
+	}
+}
+
+func TestIncrease_RootStorageSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		storageSize  int
+		templateSize int
+		want         int
+	}{
+		{"unset uses template size", 0, 25, 25},
+		{"smaller raised to template size", 20, 25, 25},
+		{"larger kept", 50, 25, 50},
+		{"template unknown", 30, 0, 30},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got int
+			mock := newMockSvc()
+			noServers(mock)
+			mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+				got = r.StorageDevices[0].Size
+				return &upcloud.ServerDetails{}, nil
+			}
+
+			g := baseGroup(mock)
+			g.StorageSize = tc.storageSize
+			g.template.Size = tc.templateSize
+			g.Increase(context.Background(), 1)
+
+			if got != tc.want {
+				t.Errorf("storage size = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTemplateUUID_PerArch(t *testing.T) {
+	tests := []struct {
+		name          string
+		connectorArch string
+		defaultArch   string
+		want          string
+	}{
+		{"connector arch selects template", "arm64", "amd64", "tmpl-arm"},
+		{"default arch selects template", "", "amd64", "tmpl-amd"},
+		{"unmapped arch falls back to template", "386", "amd64", "template-uuid"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cloned string
+			mock := newMockSvc()
+			noServers(mock)
+			mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+				cloned = r.StorageDevices[0].Storage
+				return &upcloud.ServerDetails{}, nil
+			}
+
+			g := baseGroup(mock)
+			g.Templates = map[string]string{"amd64": "tmpl-amd", "arm64": "tmpl-arm"}
+			g.DefaultArch = tc.defaultArch
+			g.settings.ConnectorConfig.Arch = tc.connectorArch
+			g.Increase(context.Background(), 1)
+
+			if cloned != tc.want {
+				t.Errorf("cloned template = %q, want %q", cloned, tc.want)
+			}
+		})
+	}
+}
+
+func TestConnectInfo_ReportsTemplateArch(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("1.2.3.4", ""), nil
+	}
+
+	g := baseGroup(mock)
+	g.DefaultArch = "arm64"
+	g.Templates = map[string]string{"arm64": "tmpl-arm"}
+
+	info, err := g.ConnectInfo(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("ConnectInfo() unexpected error: %v", err)
+	}
+	if info.Arch != "arm64" {
+		t.Errorf("Arch = %q, want arm64", info.Arch)
+	}
+}
+
+func TestPlanArch(t *testing.T) {
+	for plan, want := range map[string]string{
+		"1xCPU-2GB":         "",
+		"ARM-2xCPU-4GB":     "arm64",
+		"DEV-arm-1xCPU-1GB": "arm64",
+		"HICPU-8xCPU-16GB":  "",
+		"":                  "",
+	} {
+		if got := planArch(plan); got != want {
+			t.Errorf("planArch(%q) = %q, want %q", plan, got, want)
+		}
+	}
+}
+
+func TestValidate_PlanArch(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultArch   string
+		connectorArch string
+		wantArch      string
+		wantErr       bool
+	}{
+		{name: "inferred from plan", wantArch: "arm64"},
+		{name: "matching default arch", defaultArch: "arm64", wantArch: "arm64"},
+		{name: "conflicting default arch", defaultArch: "amd64", wantErr: true},
+		{name: "conflicting connector arch", connectorArch: "amd64", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", Plan: "ARM-2xCPU-4GB", DefaultArch: tc.defaultArch}
+			g.settings.ConnectorConfig.Arch = tc.connectorArch
+			err := g.validate()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if err == nil && g.arch() != tc.wantArch {
+				t.Errorf("arch() = %q, want %q", g.arch(), tc.wantArch)
+			}
+		})
+	}
+}
+
+func TestCheckTemplate_NoTemplateForArch(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.Template = ""
+	g.Templates = map[string]string{"arm64": "tmpl-arm"}
+
+	// The mock panics on lookup, so the error must come before any API call.
+	if err := g.checkTemplate(context.Background()); err == nil {
+		t.Fatal("checkTemplate() expected error without a template for amd64, got nil")
+	}
+}
+
+// ─── template rollout ─────────────────────────────────────────────────────────
+
+// templatesMock serves template storages by UUID; unknown UUIDs are not found.
+func templatesMock(sizes map[string]int) *mockSvc {
+	mock := newMockSvc()
+	mock.getStorageDetails = func(_ context.Context, r *request.GetStorageDetailsRequest) (*upcloud.StorageDetails, error) {
+		size, ok := sizes[r.UUID]
+		if !ok {
+			return nil, errors.New("storage not found")
+		}
+		return &upcloud.StorageDetails{Storage: upcloud.Storage{
+			UUID: r.UUID, Title: r.UUID, Type: upcloud.StorageTypeTemplate, Access: upcloud.StorageAccessPublic, Size: size,
+		}}, nil
+	}
+	return mock
+}
+
+func TestRefreshTemplate(t *testing.T) {
+	g := baseGroup(templatesMock(map[string]int{"template-uuid": 10, "template-v2": 20}))
+	g.TemplateFile = filepath.Join(t.TempDir(), "template")
+
+	// A missing file keeps the configured template.
+	g.refreshTemplate(context.Background())
+	if got := g.templateUUID(); got != "template-uuid" {
+		t.Fatalf("templateUUID() = %q before the file exists, want template-uuid", got)
+	}
+
+	if err := writeTemplateFile(g.TemplateFile, "template-v2"); err != nil {
+		t.Fatal(err)
+	}
+	g.refreshTemplate(context.Background())
+	if got := g.templateUUID(); got != "template-v2" {
+		t.Errorf("templateUUID() = %q, want template-v2", got)
+	}
+	if g.rootStorageSize() != 20 {
+		t.Errorf("rootStorageSize() = %d, want the new template's size 20", g.rootStorageSize())
+	}
+
+	// An unusable template is ignored.
+	if err := os.WriteFile(g.TemplateFile, []byte("template-missing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(g.TemplateFile, future, future)
+	g.refreshTemplate(context.Background())
+	if got := g.templateUUID(); got != "template-v2" {
+		t.Errorf("templateUUID() = %q after an invalid update, want template-v2 kept", got)
+	}
+}
+
+func TestIncrease_TemplateLabel(t *testing.T) {
+	var labels upcloud.LabelSlice
+	mock := templatesMock(map[string]int{"template-v2": 10})
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		labels = *r.Labels
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.TemplateFile = filepath.Join(t.TempDir(), "template")
+	if err := writeTemplateFile(g.TemplateFile, "template-v2"); err != nil {
+		t.Fatal(err)
+	}
+	g.Increase(context.Background(), 1)
+
+	if v, _ := labelValue(labels, templateLabelKey); v != "template-v2" {
+		t.Errorf("label %s = %q, want template-v2", templateLabelKey, v)
+	}
+}
+
+func TestRunSetTemplate(t *testing.T) {
+	orig := newUpcloudService
+	newUpcloudService = func(_ *client.Client) upcloudSvc {
+		mock := templatesMock(map[string]int{"template-v2": 10})
+		mock.getAccount = func(context.Context) (*upcloud.Account, error) { return &upcloud.Account{}, nil }
+		return mock
+	}
+	defer func() { newUpcloudService = orig }()
+
+	dir := t.TempDir()
+	templateFile := filepath.Join(dir, "template")
+	path := filepath.Join(dir, "config.json")
+	config := fmt.Sprintf(`{"token": "tok", "zone": "fi-hel1", "template": "t", "name": "test-group", "template_file": %q}`, templateFile)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runSetTemplate(context.Background(), []string{"--config", path, "template-missing"}, &bytes.Buffer{}); err == nil {
+		t.Error("runSetTemplate() expected error for unknown template, got nil")
+	}
+	if _, err := os.Stat(templateFile); !errors.Is(err, os.ErrNotExist) {
+		t.Error("template file written for an unknown template")
+	}
+
+	if err := runSetTemplate(context.Background(), []string{"--config", path, "template-v2"}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("runSetTemplate() unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(templateFile); strings.TrimSpace(string(data)) != "template-v2" {
+		t.Errorf("template file = %q, want template-v2", data)
+	}
+}
+
+// ─── template selector ────────────────────────────────────────────────────────
+
+func TestSelectTemplate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 3, 0, 0, 0, time.UTC) }
+	var (
+		calls   int
+		url     string
+		filters []request.QueryFilter
+	)
+	private := upcloud.StorageAccessPrivate
+	mock := newMockSvc()
+	mock.getStorages = func(_ context.Context, r *request.GetStoragesRequest) (*upcloud.Storages, error) {
+		calls++
+		url, filters = r.RequestURL(), r.Filters
+		return &upcloud.Storages{Storages: []upcloud.Storage{
+			{UUID: "nightly-1", Access: private, Zone: "fi-hel1", Created: day(1), Size: 10},
+			{UUID: "nightly-3-other-zone", Access: private, Zone: "de-fra1", Created: day(3), Size: 10},
+			{UUID: "nightly-2", Access: private, Zone: "fi-hel1", Created: day(2), Size: 30},
+			{UUID: "public-4", Access: upcloud.StorageAccessPublic, Zone: "fi-hel1", Created: day(4), Size: 10},
+		}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.TemplateSelector = map[string]string{"image": "ci-runner"}
+	if err := g.selectTemplate(context.Background()); err != nil {
+		t.Fatalf("selectTemplate() unexpected error: %v", err)
+	}
+	if got := g.templateUUID(); got != "nightly-2" {
+		t.Errorf("templateUUID() = %q, want nightly-2", got)
+	}
+	if g.rootStorageSize() != 30 {
+		t.Errorf("rootStorageSize() = %d, want 30 from the selected template", g.rootStorageSize())
+	}
+	want := request.FilterLabel{Label: upcloud.Label{Key: "image", Value: "ci-runner"}}
+	if len(filters) != 1 || filters[0] != want {
+		t.Errorf("filters = %v, want [%v]", filters, want)
+	}
+	if !strings.HasPrefix(url, "/storage/template?") {
+		t.Errorf("listed %q, want /storage/template with label filters", url)
+	}
+
+	g.selectTemplate(context.Background())
+	if calls != 1 {
+		t.Errorf("GetStorages called %d times, want 1 (cached)", calls)
+	}
+}
+
+func TestSelectTemplate_NoMatch(t *testing.T) {
+	mock := newMockSvc()
+	mock.getStorages = func(context.Context, *request.GetStoragesRequest) (*upcloud.Storages, error) {
+		return &upcloud.Storages{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.TemplateSelector = map[string]string{"image": "ci-runner"}
+	if err := g.selectTemplate(context.Background()); err == nil {
+		t.Error("selectTemplate() expected error when nothing matches, got nil")
+	}
+	if got := g.templateUUID(); got != "template-uuid" {
+		t.Errorf("templateUUID() = %q, want the configured template kept", got)
+	}
+}
+
+func TestValidate_TemplateSelector(t *testing.T) {
+	g := InstanceGroup{Token: "tok", Zone: "z", Name: "n", TemplateSelector: map[string]string{"image": "ci-runner"}}
+	if err := g.validate(); err != nil {
+		t.Errorf("validate() with only template_selector unexpected error: %v", err)
+	}
+	g = InstanceGroup{Token: "tok", Zone: "z", Name: "n", TemplateSelector: map[string]string{"bad key": "x"}}
+	if err := g.validate(); err == nil {
+		t.Error("validate() expected error for invalid template_selector key, got nil")
+	}
+}
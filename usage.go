@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// usageTracker accumulates the instance lifetimes of one usage report
+// period.
+type usageTracker struct {
+	since   time.Time // start of the current period
+	created int
+	deleted int
+	hours   map[string]float64   // instance-hours of servers gone in this period, by plan
+	live    map[string]usageLife // servers currently billed, by UUID
+}
+
+// usageLife is the plan and start time of one tracked server.
+type usageLife struct {
+	plan  string
+	since time.Time
+}
+
+// usageReport summarises one period.
+type usageReport struct {
+	period  time.Duration
+	created int
+	deleted int
+	live    int
+	hours   map[string]float64 // instance-hours by plan
+}
+
+// total returns the instance-hours of all plans.
+func (r usageReport) total() float64 {
+	var t float64
+	for _, h := range r.hours {
+		t += h
+	}
+	return t
+}
+
+// plans formats the per-plan breakdown as "plan=hours" pairs, sorted by
+// plan.
+func (r usageReport) plans() string {
+	names := make([]string, 0, len(r.hours))
+	for name := range r.hours {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%.2f", name, r.hours[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// initUsage starts the first usage period.
+func (g *InstanceGroup) initUsage() {
+	g.usageMu.Lock()
+	defer g.usageMu.Unlock()
+	g.usage = usageTracker{since: time.Now(), hours: map[string]float64{}, live: map[string]usageLife{}}
+}
+
+// usageStart begins billing a server. created counts it as an instance the
+// plugin created, rather than one it found running.
+func (g *InstanceGroup) usageStart(uuid, plan string, created bool) {
+	if plan == "" {
+		plan = g.Plan
+	}
+	g.usageMu.Lock()
+	defer g.usageMu.Unlock()
+	if g.usage.live == nil {
+		return // Init has not run
+	}
+	if _, ok := g.usage.live[uuid]; ok {
+		return
+	}
+	g.usage.live[uuid] = usageLife{plan: plan, since: time.Now()}
+	if created {
+		g.usage.created++
+	}
+}
+
+// usageStop ends billing a server that was deleted.
+func (g *InstanceGroup) usageStop(uuid string) {
+	g.usageMu.Lock()
+	defer g.usageMu.Unlock()
+	life, ok := g.usage.live[uuid]
+	if !ok {
+		return
+	}
+	g.usage.hours[life.plan] += g.usage.billedHours(life, time.Now())
+	delete(g.usage.live, uuid)
+	g.usage.deleted++
+}
+
+// billedHours returns how long a server has run in the current period.
+func (u *usageTracker) billedHours(life usageLife, now time.Time) float64 {
+	start := life.since
+	if start.Before(u.since) {
+		start = u.since
+	}
+	return now.Sub(start).Hours()
+}
+
+// trackUsage reconciles the tracked servers with a listing of the group:
+// servers the plugin did not create, e.g. from before a restart, start
+// being billed when first seen, and servers deleted behind the plugin's
+// back stop.
+func (g *InstanceGroup) trackUsage(servers []upcloud.Server) {
+	listed := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		listed[s.UUID] = true
+		g.usageStart(s.UUID, s.Plan, false)
+	}
+
+	g.usageMu.Lock()
+	var gone []string
+	for uuid := range g.usage.live {
+		if !listed[uuid] {
+			gone = append(gone, uuid)
+		}
+	}
+	g.usageMu.Unlock()
+	for _, uuid := range gone {
+		g.usageStop(uuid)
+	}
+}
+
+// takeUsage returns the report of the current period and starts the next.
+func (g *InstanceGroup) takeUsage() usageReport {
+	g.usageMu.Lock()
+	defer g.usageMu.Unlock()
+	now := time.Now()
+	r := usageReport{
+		period:  now.Sub(g.usage.since),
+		created: g.usage.created,
+		deleted: g.usage.deleted,
+		live:    len(g.usage.live),
+		hours:   g.usage.hours,
+	}
+	for _, life := range g.usage.live {
+		r.hours[life.plan] += g.usage.billedHours(life, now)
+	}
+	g.usage.since = now
+	g.usage.created, g.usage.deleted = 0, 0
+	g.usage.hours = map[string]float64{}
+	return r
+}
+
+// maybeReportUsage logs a usage report once UsageReportInterval has passed
+// since the last one. It is called from Update.
+func (g *InstanceGroup) maybeReportUsage() {
+	if g.UsageReportInterval <= 0 {
+		return
+	}
+	g.usageMu.Lock()
+	due := !g.usage.since.IsZero() && time.Since(g.usage.since) >= time.Duration(g.UsageReportInterval)
+	g.usageMu.Unlock()
+	if due {
+		g.reportUsage("periodic")
+	}
+}
+
+// reportUsage logs the usage of the current period and records the
+// instance-hours as metrics.
+func (g *InstanceGroup) reportUsage(reason string) {
+	g.usageMu.Lock()
+	started := g.usage.live != nil
+	g.usageMu.Unlock()
+	if !started {
+		return
+	}
+
+	r := g.takeUsage()
+	g.metrics.gauge("usage.instance_hours", r.total())
+	g.metrics.count("usage.instances_created", int64(r.created))
+	g.logger(logScaling).Info("usage report",
+		"reason", reason,
+		"period", r.period.Round(time.Second),
+		"instances_created", r.created,
+		"instances_deleted", r.deleted,
+		"instances_running", r.live,
+		"instance_hours", fmt.Sprintf("%.2f", r.total()),
+		"plans", r.plans(),
+	)
+}
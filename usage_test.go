@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+)
+
+// ─── usage report ─────────────────────────────────────────────────────────────
+
+func TestTakeUsage(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.Plan = "1xCPU-2GB"
+	g.initUsage()
+	g.usageStart("uuid-1", "", true)
+	g.usageStart("uuid-2", "2xCPU-4GB", true)
+	g.trackUsage([]upcloud.Server{{UUID: "uuid-1"}, {UUID: "uuid-2"}, {UUID: "uuid-3", Plan: "2xCPU-4GB"}})
+
+	// Pretend the period and all servers started two hours ago.
+	start := time.Now().Add(-2 * time.Hour)
+	g.usage.since = start
+	for uuid, life := range g.usage.live {
+		life.since = start
+		g.usage.live[uuid] = life
+	}
+	g.usageStop("uuid-1")
+
+	r := g.takeUsage()
+	if r.created != 2 || r.deleted != 1 || r.live != 2 {
+		t.Errorf("report = %d created, %d deleted, %d live, want 2, 1, 2", r.created, r.deleted, r.live)
+	}
+	want := map[string]float64{"1xCPU-2GB": 2, "2xCPU-4GB": 4}
+	for plan, h := range want {
+		if math.Abs(r.hours[plan]-h) > 0.01 {
+			t.Errorf("hours[%s] = %.3f, want %.0f", plan, r.hours[plan], h)
+		}
+	}
+	if got := r.plans(); got != "1xCPU-2GB=2.00,2xCPU-4GB=4.00" {
+		t.Errorf("plans() = %q", got)
+	}
+
+	// Servers missing from the listing stop being billed.
+	g.trackUsage([]upcloud.Server{{UUID: "uuid-2"}})
+	if r := g.takeUsage(); r.created != 0 || r.deleted != 1 || r.live != 1 {
+		t.Errorf("next report = %d created, %d deleted, %d live, want 0, 1, 1", r.created, r.deleted, r.live)
+	}
+}
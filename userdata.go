@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bootstrapCloudConfig turns a stock OS template into a job-ready instance:
+// Docker from the upstream convenience script plus the tools the runner's
+// helpers expect. It is only intended for public OS templates; golden images
+// should be preferred once a fleet grows.
+const bootstrapCloudConfig = `#cloud-config
+package_update: true
+packages:
+  - ca-certificates
+  - curl
+  - git
+  - git-lfs
+runcmd:
+  - curl -fsSL https://get.docker.com | sh
+  - systemctl enable --now docker
+`
+
+// Bounds for downloading user_data when fetch_user_data is set.
+const (
+	userDataFetchTimeout = 30 * time.Second
+	userDataFetchLimit   = 1 << 20
+)
+
+// maxUserDataSize is the longest user_data the UpCloud API accepts.
+const maxUserDataSize = 16384
+
+// sha256Pattern matches a hex-encoded SHA-256 digest.
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// cloudConfigMergeType makes cloud-init append lists such as packages and
+// runcmd across cloud-config parts instead of letting the last part win.
+const cloudConfigMergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+
+// bootstrapUserData returns the built-in bootstrap cloud-config, letting the
+// connector user run Docker without sudo.
+func (g *InstanceGroup) bootstrapUserData() string {
+	var sb strings.Builder
+	sb.WriteString(bootstrapCloudConfig)
+	if user := g.settings.ConnectorConfig.Username; user != "" && user != "root" {
+		fmt.Fprintf(&sb, "  - usermod -aG docker %s\n", user)
+	}
+	return sb.String()
+}
+
+// hasUserData reports whether new servers receive any user data.
+func (g *InstanceGroup) hasUserData() bool {
+	return g.Bootstrap || g.UserData != "" || g.mtuUserData() != ""
+}
+
+// userData returns the user data passed to new servers, if any. Content the
+// plugin generates is combined with the user's user_data as a multipart MIME
+// document, which cloud-init processes part by part.
+func (g *InstanceGroup) userData(ctx context.Context) (string, error) {
+	var parts []string
+	if g.Bootstrap {
+		parts = append(parts, g.bootstrapUserData())
+	}
+	if mtu := g.mtuUserData(); mtu != "" {
+		parts = append(parts, mtu)
+	}
+	if g.UserData != "" {
+		user := g.UserData
+		if g.FetchUserData {
+			var err error
+			if user, err = fetchUserData(ctx, strings.TrimSpace(g.UserData), g.UserDataSHA256); err != nil {
+				return "", err
+			}
+		}
+		if g.TemplateUserData {
+			var err error
+			if user, err = g.renderUserData(user); err != nil {
+				return "", err
+			}
+		}
+		if err := checkUserData(user); err != nil {
+			return "", fmt.Errorf("user_data: %w", err)
+		}
+		parts = append(parts, user)
+	}
+	var data string
+	switch len(parts) {
+	case 0:
+		return "", nil
+	case 1:
+		data = parts[0]
+	default:
+		data = multipartUserData(parts)
+	}
+	return g.fitUserData(data)
+}
+
+// checkUserData catches user data that cannot work: content too large even
+// when compressed, and #cloud-config that is not a valid YAML mapping.
+// cloud-init would otherwise skip it at boot and leave an unprovisioned
+// instance behind.
+func checkUserData(data string) error {
+	if len(data) > maxUserDataSize {
+		if n := len(gzipUserData(data)); n > maxUserDataSize {
+			return fmt.Errorf("%d bytes (%d gzipped), exceeding the API limit of %d bytes", len(data), n, maxUserDataSize)
+		}
+	}
+	if !strings.HasPrefix(data, "#cloud-config") {
+		return nil
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return fmt.Errorf("invalid cloud-config: %w", err)
+	}
+	return nil
+}
+
+// fitUserData compresses user data that exceeds maxUserDataSize. The result
+// is a single gzip part, base64-encoded within a MIME document, which
+// cloud-init decompresses before processing the original content.
+func (g *InstanceGroup) fitUserData(data string) (string, error) {
+	if len(data) <= maxUserDataSize {
+		return data, nil
+	}
+	compressed := gzipUserData(data)
+	if len(compressed) > maxUserDataSize {
+		return "", fmt.Errorf("user data is %d bytes (%d gzipped), exceeding the API limit of %d bytes", len(data), len(compressed), maxUserDataSize)
+	}
+	g.log.Debug("compressed user data", "size", len(data), "compressed", len(compressed))
+	return compressed, nil
+}
+
+// gzipUserData wraps data in a base64-encoded application/x-gzip MIME part.
+func gzipUserData(data string) string {
+	var gz bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression) // the level is valid
+	zw.Write([]byte(data))
+	zw.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "application/x-gzip")
+	h.Set("Content-Transfer-Encoding", "base64")
+	pw, _ := w.CreatePart(h) // writes to a bytes.Buffer cannot fail
+	enc := base64.StdEncoding.EncodeToString(gz.Bytes())
+	for len(enc) > 76 {
+		pw.Write([]byte(enc[:76] + "\n"))
+		enc = enc[76:]
+	}
+	pw.Write([]byte(enc))
+	w.Close()
+	return mimeDocument(w.Boundary(), body.Bytes())
+}
+
+// fetchUserData downloads user data from url, verifying its SHA-256 digest
+// when want is set.
+func fetchUserData(ctx context.Context, url, want string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, userDataFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("fetching user_data: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching user_data: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching user_data from %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, userDataFetchLimit+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching user_data from %s: %w", url, err)
+	}
+	if len(body) > userDataFetchLimit {
+		return "", fmt.Errorf("user_data at %s exceeds %d bytes", url, userDataFetchLimit)
+	}
+	if want != "" {
+		sum := sha256.Sum256(body)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+			return "", fmt.Errorf("user_data at %s has SHA-256 %s, want %s", url, got, want)
+		}
+	}
+	return string(body), nil
+}
+
+// secretNamePattern restricts secret names so they cannot escape secrets_dir.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// parseUserDataTemplate compiles user data as a Go template whose secret
+// function is backed by lookup. A nil lookup is enough to check the syntax.
+func parseUserDataTemplate(text string, lookup func(name string) (string, error)) (*template.Template, error) {
+	funcs := template.FuncMap{"secret": func(name string) (string, error) {
+		if lookup == nil {
+			return "", nil
+		}
+		return lookup(name)
+	}}
+	return template.New("user_data").Option("missingkey=error").Funcs(funcs).Parse(text)
+}
+
+// renderUserData resolves the secret placeholders in user data. Secrets are
+// never logged; errors name only the missing secret.
+func (g *InstanceGroup) renderUserData(text string) (string, error) {
+	tmpl, err := parseUserDataTemplate(text, g.lookupSecret)
+	if err != nil {
+		return "", fmt.Errorf("user_data: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, nil); err != nil {
+		return "", fmt.Errorf("rendering user_data: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// lookupSecret returns the value of the named environment variable or, when
+// it is unset, the content of the file with that name in secrets_dir. A
+// single trailing newline is trimmed from file content.
+func (g *InstanceGroup) lookupSecret(name string) (string, error) {
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	if v, ok := os.LookupEnv(name); ok {
+		secrets.add(v)
+		return v, nil
+	}
+	if g.SecretsDir == "" {
+		return "", fmt.Errorf("secret %q is not set", name)
+	}
+	data, err := os.ReadFile(filepath.Join(g.SecretsDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("secret %q is not set in the environment or %s", name, g.SecretsDir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading secret %q: %w", name, err)
+	}
+	v := strings.TrimSuffix(string(data), "\n")
+	secrets.add(v)
+	return v, nil
+}
+
+// userDataPartType returns the cloud-init content type for a user data part.
+func userDataPartType(part string) string {
+	switch {
+	case strings.HasPrefix(part, "#cloud-config"):
+		return "text/cloud-config"
+	case strings.HasPrefix(part, "#cloud-boothook"):
+		return "text/cloud-boothook"
+	case strings.HasPrefix(part, "#include"):
+		return "text/x-include-url"
+	case isUserDataURL(part):
+		// A bare URL is fetched and processed by cloud-init like #include.
+		return "text/x-include-url"
+	default:
+		return "text/x-shellscript"
+	}
+}
+
+// isUserDataURL reports whether user data is a single http(s) URL.
+func isUserDataURL(s string) bool {
+	s = strings.TrimSpace(s)
+	return (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) && !strings.ContainsAny(s, " \n")
+}
+
+// multipartUserData joins parts into a multipart/mixed MIME document.
+func multipartUserData(parts []string) string {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range parts {
+		h := textproto.MIMEHeader{}
+		contentType := userDataPartType(part)
+		h.Set("Content-Type", contentType+`; charset="utf-8"`)
+		if contentType == "text/cloud-config" {
+			h.Set("Merge-Type", cloudConfigMergeType)
+		}
+		pw, _ := w.CreatePart(h) // writes to a bytes.Buffer cannot fail
+		pw.Write([]byte(part))
+	}
+	w.Close()
+	return mimeDocument(w.Boundary(), body.Bytes())
+}
+
+// mimeDocument prefixes a multipart/mixed body with its top-level headers.
+func mimeDocument(boundary string, body []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Content-Type: multipart/mixed; boundary=%q\n", boundary)
+	sb.WriteString("MIME-Version: 1.0\n\n")
+	sb.Write(body)
+	return sb.String()
+}
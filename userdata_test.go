@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── bootstrap ────────────────────────────────────────────────────────────────
+
+func TestIncrease_Bootstrap(t *testing.T) {
+	var got string
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		got = r.UserData
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.Bootstrap = true
+	g.settings.ConnectorConfig.Username = "ubuntu"
+	g.Increase(context.Background(), 1)
+
+	if !strings.HasPrefix(got, "#cloud-config\n") {
+		t.Errorf("user data is not a cloud-config:\n%s", got)
+	}
+	for _, want := range []string{"get.docker.com", "usermod -aG docker ubuntu"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("user data does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBootstrapUserData_Root(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.settings.ConnectorConfig.Username = "root"
+	if strings.Contains(g.bootstrapUserData(), "usermod") {
+		t.Error("root should not be added to the docker group")
+	}
+}
+
+// ─── merging ──────────────────────────────────────────────────────────────────
+
+// parseUserData splits multipart user data into content types and bodies.
+func parseUserData(t *testing.T, data string) (types, bodies []string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("user data is not a MIME document: %v\n%s", err, data)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/mixed", msg.Header.Get("Content-Type"), err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return types, bodies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(p)
+		types = append(types, ct)
+		bodies = append(bodies, string(body))
+	}
+}
+
+func TestUserData_MergesBootstrapWithUserData(t *testing.T) {
+	tests := []struct {
+		name     string
+		userData string
+		wantType string
+	}{
+		{name: "shell script", userData: "#!/bin/sh\necho hi\n", wantType: "text/x-shellscript"},
+		{name: "cloud-config", userData: "#cloud-config\npackages: [jq]\n", wantType: "text/cloud-config"},
+		{name: "URL", userData: "https://example.com/init.sh", wantType: "text/x-include-url"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := baseGroup(newMockSvc())
+			g.Bootstrap = true
+			g.UserData = tc.userData
+
+			types, bodies := parseUserData(t, mustUserData(t, g))
+			if len(types) != 2 {
+				t.Fatalf("got %d parts, want 2", len(types))
+			}
+			if types[0] != "text/cloud-config" || bodies[0] != g.bootstrapUserData() {
+				t.Errorf("first part = %s %q, want the bootstrap cloud-config", types[0], bodies[0])
+			}
+			if types[1] != tc.wantType || bodies[1] != tc.userData {
+				t.Errorf("second part = %s %q, want %s %q", types[1], bodies[1], tc.wantType, tc.userData)
+			}
+		})
+	}
+}
+
+func TestUserData_SinglePartUnchanged(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UserData = "https://example.com/init.sh"
+	if got := mustUserData(t, g); got != g.UserData {
+		t.Errorf("userData() = %q, want user_data passed through", got)
+	}
+}
+
+func TestUserData_PrivateMTU(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UsePrivateNetwork = true
+	g.PrivateNetworks = []string{"net-a", "net-b"}
+	g.PrivateMTU = 1400
+	g.UserData = "#!/bin/sh\necho hi\n"
+
+	types, bodies := parseUserData(t, mustUserData(t, g))
+	if len(types) != 2 || types[0] != "text/cloud-config" {
+		t.Fatalf("parts = %v, want the MTU cloud-config before user_data", types)
+	}
+	if err := checkUserData(bodies[0]); err != nil {
+		t.Errorf("MTU cloud-config is invalid: %v", err)
+	}
+	for _, want := range []string{`case " 2 3 " in`, "mtu 1400"} {
+		if !strings.Contains(bodies[0], want) {
+			t.Errorf("MTU cloud-config does not contain %q:\n%s", want, bodies[0])
+		}
+	}
+
+	g.PrivateMTU = 0
+	if !g.hasUserData() || strings.Contains(mustUserData(t, g), "mtu") {
+		t.Error("MTU cloud-config should only be added when private_mtu is set")
+	}
+}
+
+func TestValidate_PrivateMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		mtu     int
+		private bool
+		wantErr bool
+	}{
+		{name: "valid", mtu: 1400, private: true},
+		{name: "too small", mtu: 500, private: true, wantErr: true},
+		{name: "too large", mtu: 9216, private: true, wantErr: true},
+		{name: "no private network", mtu: 1400, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			g.PrivateMTU, g.UsePrivateNetwork = tc.mtu, tc.private
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// mustUserData returns g.userData, failing the test on error.
+func mustUserData(t *testing.T, g *InstanceGroup) string {
+	t.Helper()
+	data, err := g.userData(context.Background())
+	if err != nil {
+		t.Fatalf("userData() unexpected error: %v", err)
+	}
+	return data
+}
+
+// ─── fetching ─────────────────────────────────────────────────────────────────
+
+func TestUserData_Fetch(t *testing.T) {
+	const script = "#!/bin/sh\necho hi\n"
+	sum := sha256.Sum256([]byte(script))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, script)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		sha256  string
+		wantErr bool
+	}{
+		{name: "no checksum"},
+		{name: "matching checksum", sha256: hex.EncodeToString(sum[:])},
+		{name: "wrong checksum", sha256: strings.Repeat("0", 64), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := baseGroup(newMockSvc())
+			g.UserData = srv.URL
+			g.FetchUserData = true
+			g.UserDataSHA256 = tc.sha256
+
+			got, err := g.userData(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("userData() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && got != script {
+				t.Errorf("userData() = %q, want the fetched script", got)
+			}
+		})
+	}
+}
+
+func TestIncrease_UserDataFetchFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	g := baseGroup(newMockSvc()) // CreateServer panics if reached
+	g.UserData = srv.URL
+	g.FetchUserData = true
+	if n, err := g.Increase(context.Background(), 2); n != 0 || err == nil {
+		t.Errorf("Increase() = (%d, %v), want (0, error)", n, err)
+	}
+}
+
+func TestValidate_UserDataFetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "checksum implies fetch", mod: func(g *InstanceGroup) {
+			g.UserData, g.UserDataSHA256 = "https://example.com/x", strings.Repeat("a", 64)
+		}},
+		{name: "fetch without URL", mod: func(g *InstanceGroup) { g.UserData, g.FetchUserData = "#!/bin/sh", true }, wantErr: true},
+		{name: "malformed checksum", mod: func(g *InstanceGroup) { g.UserData, g.UserDataSHA256 = "https://example.com/x", "abc" }, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !g.FetchUserData {
+				t.Error("FetchUserData not enabled by user_data_sha256")
+			}
+		})
+	}
+}
+
+// ─── secrets ──────────────────────────────────────────────────────────────────
+
+func TestUserData_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "CACHE_KEY"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RUNNER_TOKEN", "from-env")
+
+	g := baseGroup(newMockSvc())
+	g.TemplateUserData = true
+	g.SecretsDir = dir
+	g.UserData = `#!/bin/sh
+echo {{ secret "RUNNER_TOKEN" }} {{ secret "CACHE_KEY" }}`
+	if got, want := mustUserData(t, g), "#!/bin/sh\necho from-env from-file"; got != want {
+		t.Errorf("userData() = %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"MISSING", "../CACHE_KEY"} {
+		g.UserData = `{{ secret "` + name + `" }}`
+		if _, err := g.userData(context.Background()); err == nil {
+			t.Errorf("userData() with secret %q: expected error, got nil", name)
+		}
+	}
+}
+
+func TestUserData_NotTemplatedByDefault(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UserData = "## template: jinja\n#cloud-config\nhostname: {{ v1.local_hostname }}"
+	if got := mustUserData(t, g); got != g.UserData {
+		t.Errorf("userData() = %q, want user_data unchanged", got)
+	}
+}
+
+func TestValidate_UserDataTemplate(t *testing.T) {
+	g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", UserData: `{{ secret "X" `, TemplateUserData: true}
+	if err := g.validate(); err == nil {
+		t.Error("validate() expected error for malformed template, got nil")
+	}
+	g = InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", SecretsDir: "/run/secrets"}
+	if err := g.validate(); err == nil {
+		t.Error("validate() expected error for secrets_dir without template_user_data, got nil")
+	}
+}
+
+// ─── size limit ───────────────────────────────────────────────────────────────
+
+func TestUserData_CompressesLargeContent(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UserData = "#!/bin/sh\n" + strings.Repeat("echo compressible\n", 2000)
+
+	data := mustUserData(t, g)
+	if len(data) > maxUserDataSize {
+		t.Fatalf("userData() is %d bytes, want at most %d", len(data), maxUserDataSize)
+	}
+	types, bodies := parseUserData(t, data)
+	if len(types) != 1 || types[0] != "application/x-gzip" {
+		t.Fatalf("types = %v, want a single application/x-gzip part", types)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(bodies[0], "\n", ""))
+	if err != nil {
+		t.Fatalf("part is not base64: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("part is not gzip: %v", err)
+	}
+	got, _ := io.ReadAll(zr)
+	if string(got) != g.UserData {
+		t.Error("decompressed user data differs from user_data")
+	}
+}
+
+// incompressible returns 2n hex characters of random data.
+func incompressible(n int) string {
+	random := make([]byte, n)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+func TestUserData_TooLarge(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	g.UserData = "#!/bin/sh\n# " + incompressible(maxUserDataSize)
+	_, err := g.userData(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "exceeding the API limit") {
+		t.Fatalf("userData() error = %v, want size limit error", err)
+	}
+}
+
+// ─── pre-flight checks ────────────────────────────────────────────────────────
+
+func TestValidate_UserDataContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		userData string
+		wantErr  bool
+	}{
+		{name: "cloud-config", userData: "#cloud-config\npackages:\n  - git\n"},
+		{name: "malformed cloud-config", userData: "#cloud-config\npackages:\n  - git\n runcmd: [\n", wantErr: true},
+		{name: "cloud-config not a mapping", userData: "#cloud-config\n- git\n", wantErr: true},
+		{name: "shell script is not parsed", userData: "#!/bin/sh\nkey: [\n"},
+		{name: "jinja template is not parsed", userData: "## template: jinja\n#cloud-config\nhostname: {{ v1.local_hostname }}\n"},
+		{name: "too large", userData: "#!/bin/sh\n# " + incompressible(maxUserDataSize), wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", UserData: tc.userData}
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserData_ChecksRenderedCloudConfig(t *testing.T) {
+	t.Setenv("PACKAGES", "[git")
+	g := baseGroup(newMockSvc())
+	g.TemplateUserData = true
+	g.UserData = "#cloud-config\npackages: {{ secret \"PACKAGES\" }}\n"
+	if _, err := g.userData(context.Background()); err == nil {
+		t.Fatal("userData() expected error for invalid rendered cloud-config, got nil")
+	}
+}
@@ -1,6 +1,14 @@
 package main
 
-import "gitlab.com/gitlab-org/fleeting/fleeting/plugin"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/plugin"
+)
 
 var (
 	buildVersion = "dev"
@@ -15,3 +23,43 @@ var Version = plugin.VersionInfo{
 	Reference: "gitlab.com/kirbo/fleeting-plugin-upcloud",
 	BuiltAt:   buildDate,
 }
+
+// versionInfo is the machine-readable form of Version printed by
+// "version --json".
+type versionInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Reference string `json:"reference"`
+	BuiltAt   string `json:"built_at"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// runVersion prints the build information, as JSON with --json. It handles
+// "version" and "--version" so both accept --json.
+func runVersion(_ context.Context, args []string, stdout io.Writer) error {
+	fs, _ := newFlagSet("version", stdout)
+	asJSON := fs.Bool("json", false, "print the build information as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*asJSON {
+		_, err := fmt.Fprint(stdout, Version.Full())
+		return err
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(versionInfo{
+		Name:      Version.Name,
+		Version:   Version.Version,
+		Revision:  Version.Revision,
+		Reference: Version.Reference,
+		BuiltAt:   Version.BuiltAt,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// ─── version command ──────────────────────────────────────────────────────────
+
+func TestRunVersion_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := runVersion(context.Background(), []string{"--json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var got versionInfo
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if got.Name != Version.Name || got.Version != Version.Version || got.GoVersion != runtime.Version() {
+		t.Errorf("version info = %+v", got)
+	}
+}
+
+func TestRunVersion_Text(t *testing.T) {
+	var out bytes.Buffer
+	if err := runVersion(context.Background(), nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Name:         "+Version.Name) {
+		t.Errorf("output = %q, want plugin.VersionInfo.Full()", out.String())
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Warm capacity timing.
+const (
+	warmRetryInterval = time.Minute      // between replenishments that came up short
+	warmTimeout       = 10 * time.Minute // bounds one replenishment
+)
+
+// errMinSize is returned for removals held back to keep MinSize instances.
+var errMinSize = errors.New("removal would take the group below min_size")
+
+// maybeReplenish creates servers in the background when fewer than MinSize
+// are alive, so the group keeps warm capacity whatever the runner asks
+// for. At most one replenishment runs at a time, and after one came up
+// short the next waits warmRetryInterval. Update calls it with the number
+// of creating and running instances it found plus the creations its
+// listing could not show yet, so a server being created is never asked for
+// twice.
+func (g *InstanceGroup) maybeReplenish(alive int) {
+	missing := g.MinSize - alive
+	if missing <= 0 {
+		return
+	}
+	g.warmMu.Lock()
+	if g.warming || time.Since(g.warmFailedAt) < warmRetryInterval {
+		g.warmMu.Unlock()
+		return
+	}
+	g.warming = true
+	g.warmMu.Unlock()
+
+	log := g.logger(logScaling)
+	log.Info("replenishing warm capacity", "alive", alive, "min_size", g.MinSize, "creating", missing)
+	g.createInBackground(missing, warmTimeout, func(n int, err error) {
+		g.warmMu.Lock()
+		g.warming = false
+		if n < missing {
+			g.warmFailedAt = time.Now()
+		}
+		g.warmMu.Unlock()
+		if n < missing {
+			log.Warn("warm capacity not fully replenished", "created", n, "wanted", missing, "error", err)
+		}
+	})
+}
+
+// holdForMinSize splits the servers the runner asked to remove into those
+// that may go and those held back so that MinSize healthy instances remain,
+// which would otherwise be replaced straight away by maybeReplenish. Servers
+// outside the desired set and unhealthy ones always go. Those that may go
+// are marked as being removed before it returns, so concurrent calls never
+// count them twice.
+func (g *InstanceGroup) holdForMinSize(uuids []string) (remove, hold []string) {
+	if g.MinSize <= 0 {
+		return uuids, nil
+	}
+	g.desiredMu.Lock()
+	defer g.desiredMu.Unlock()
+	alive := 0
+	for uuid := range g.desired {
+		if !g.isDeleting(uuid) {
+			alive++
+		}
+	}
+	for _, uuid := range uuids {
+		_, desired := g.desired[uuid]
+		_, unhealthy := g.unhealthyReason(uuid)
+		switch {
+		case !desired || g.isDeleting(uuid):
+		case unhealthy || alive > g.MinSize:
+			alive--
+		default:
+			hold = append(hold, uuid)
+			continue
+		}
+		g.setDeleting(uuid, true)
+		remove = append(remove, uuid)
+	}
+	return remove, hold
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+)
+
+// ─── warm capacity ────────────────────────────────────────────────────────────
+
+func TestUpdate_ReplenishesMinSize(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created int
+	)
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+	mock.createServer = func(context.Context, *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created++
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.MinSize = 3
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.background.Wait()
+	if created != 2 {
+		t.Errorf("created = %d, want 2 to reach min_size", created)
+	}
+}
+
+func TestValidate_MinSize(t *testing.T) {
+	for size, wantErr := range map[int]bool{0: false, 5: false, -1: true, 11: true} {
+		g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n", MaxSize: 10, MinSize: size}
+		if err := g.validate(); (err != nil) != wantErr {
+			t.Errorf("validate() with min_size %d error = %v, wantErr = %v", size, err, wantErr)
+		}
+	}
+}
+
+func TestUpdate_CountsPendingCreates(t *testing.T) {
+	mock := newMockSvc()
+	mock.getServersWithFilters = func(context.Context, *request.GetServersWithFiltersRequest) (*upcloud.Servers, error) {
+		return &upcloud.Servers{Servers: []upcloud.Server{{UUID: "uuid-1", State: upcloud.ServerStateStarted}}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.MinSize = 3
+	g.expectCreates(2)
+	if err := g.Update(context.Background(), func(string, provider.State) {}); err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+	g.background.Wait() // mock.createServer panics if called
+
+	// A creation owned after the listing started still counts.
+	listedAt := time.Now()
+	g.own("uuid-2")
+	if n := g.pendingCreates(map[string]bool{"uuid-1": true}, listedAt); n != 2 {
+		t.Errorf("pendingCreates() = %d, want 2", n)
+	}
+}
+
+func TestDecrease_HoldsMinSize(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	mock := newMockSvc()
+	stubRemoval(mock, &mu, &deleted)
+	mock.getServerDetails = func(context.Context, *request.GetServerDetailsRequest) (*upcloud.ServerDetails, error) {
+		return makeDetails("", ""), nil
+	}
+	mock.modifyServer = func(context.Context, *request.ModifyServerRequest) (*upcloud.ServerDetails, error) {
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.MinSize = 2
+	for _, uuid := range []string{"uuid-1", "uuid-2", "uuid-3"} {
+		g.own(uuid)
+	}
+	g.markUnhealthy("uuid-3", "probe failed")
+
+	removed, err := g.Decrease(context.Background(), []string{"uuid-1", "uuid-2", "uuid-3"})
+	if !errors.Is(err, errMinSize) {
+		t.Errorf("Decrease() error = %v, want errMinSize", err)
+	}
+	slices.Sort(removed)
+	if !slices.Equal(removed, []string{"uuid-1", "uuid-3"}) {
+		t.Errorf("Decrease() removed %v, want uuid-1 and the unhealthy uuid-3", removed)
+	}
+	if _, ok := g.desired["uuid-2"]; !ok {
+		t.Error("held uuid-2 dropped from the desired set")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Scaling events reported to the webhook.
+const (
+	eventInstanceCreated = "instance_created"
+	eventInstanceDeleted = "instance_deleted"
+	eventInstanceFailed  = "instance_failed"
+)
+
+// webhookTimeout bounds a single webhook delivery.
+const webhookTimeout = 10 * time.Second
+
+// webhookEvent is the payload sent to the webhook, and the data passed to
+// webhook_template.
+type webhookEvent struct {
+	Event    string    `json:"event"`
+	Group    string    `json:"group"`
+	Zone     string    `json:"zone"`
+	Instance string    `json:"instance,omitempty"`
+	Hostname string    `json:"hostname,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// parseWebhookTemplate compiles webhook_template, if set.
+func (g *InstanceGroup) parseWebhookTemplate() error {
+	if g.WebhookTemplate == "" {
+		return nil
+	}
+	tmpl, err := template.New("webhook").Parse(g.WebhookTemplate)
+	if err != nil {
+		return fmt.Errorf("webhook_template: %w", err)
+	}
+	g.webhookTmpl = tmpl
+	return nil
+}
+
+// notify counts a scaling event in metrics and sends it to the configured
+// webhook in the background. Delivery failures are logged and otherwise
+// ignored.
+func (g *InstanceGroup) notify(event, instance, hostname string, cause error) {
+	g.metrics.count("events."+event, 1)
+	if g.WebhookURL == "" {
+		return
+	}
+
+	ev := webhookEvent{
+		Event:    event,
+		Group:    g.Name,
+		Zone:     g.Zone,
+		Instance: instance,
+		Hostname: hostname,
+		Time:     time.Now().UTC(),
+	}
+	if cause != nil {
+		ev.Error = cause.Error()
+	}
+
+	g.background.Add(1)
+	go func() {
+		defer g.background.Done()
+		if err := g.sendWebhook(ev); err != nil {
+			g.log.Warn("webhook delivery failed", "event", event, "error", err)
+		}
+	}()
+}
+
+// sendWebhook renders and posts a single event.
+func (g *InstanceGroup) sendWebhook(ev webhookEvent) error {
+	var body bytes.Buffer
+	if g.webhookTmpl != nil {
+		if err := g.webhookTmpl.Execute(&body, ev); err != nil {
+			return fmt.Errorf("rendering webhook_template: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(ev); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.WebhookURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", Version.Name+"/"+Version.Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── webhook ──────────────────────────────────────────────────────────────────
+
+// webhookRecorder starts a server collecting request bodies.
+func webhookRecorder(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestIncrease_WebhookEvents(t *testing.T) {
+	srv, bodies := webhookRecorder(t)
+
+	calls := 0
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("quota exceeded")
+		}
+		return &upcloud.ServerDetails{Server: upcloud.Server{UUID: "uuid-1", Hostname: r.Hostname}}, nil
+	}
+
+	g := baseGroup(mock)
+	g.WebhookURL = srv.URL
+	g.Increase(context.Background(), 2)
+	g.background.Wait()
+
+	got := map[string]webhookEvent{}
+	for _, b := range bodies() {
+		var ev webhookEvent
+		if err := json.Unmarshal([]byte(b), &ev); err != nil {
+			t.Fatalf("webhook body %q is not JSON: %v", b, err)
+		}
+		got[ev.Event] = ev
+	}
+	if ev, ok := got[eventInstanceCreated]; !ok || ev.Instance != "uuid-1" || ev.Group != g.Name {
+		t.Errorf("created event = %+v (present %v)", ev, ok)
+	}
+	if ev, ok := got[eventInstanceFailed]; !ok || ev.Error != "quota exceeded" {
+		t.Errorf("failed event = %+v (present %v)", ev, ok)
+	}
+}
+
+func TestWebhook_Template(t *testing.T) {
+	srv, bodies := webhookRecorder(t)
+
+	g := baseGroup(newMockSvc())
+	g.WebhookURL = srv.URL
+	g.WebhookTemplate = `{"text": "{{.Event}} {{.Instance}} in {{.Group}}"}`
+	if err := g.parseWebhookTemplate(); err != nil {
+		t.Fatalf("parseWebhookTemplate() unexpected error: %v", err)
+	}
+
+	g.notify(eventInstanceDeleted, "uuid-9", "", nil)
+	g.background.Wait()
+
+	want := `{"text": "instance_deleted uuid-9 in test-group"}`
+	if b := bodies(); len(b) != 1 || b[0] != want {
+		t.Errorf("bodies = %v, want [%s]", b, want)
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	g := baseGroup(newMockSvc())
+	g.WebhookURL = srv.URL
+	if err := g.sendWebhook(webhookEvent{Event: eventInstanceCreated}); err == nil {
+		t.Fatal("sendWebhook() expected error for 500 response, got nil")
+	}
+}
+
+func TestNotify_NoWebhookConfigured(t *testing.T) {
+	g := baseGroup(newMockSvc())
+	// Must neither block nor panic without a URL.
+	g.notify(eventInstanceCreated, "uuid-1", "host", nil)
+	g.background.Wait()
+}
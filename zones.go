@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// capacityErrorCodes are UpCloud error codes reporting that a zone is out of
+// capacity for the requested server, as opposed to an account limit.
+var capacityErrorCodes = []string{
+	upcloud.ErrCodeServerResourcesUnavailable,
+	upcloud.ErrCodeStorageResourcesUnavailable,
+	upcloud.ErrCodeIpAddressResourcesUnavailable,
+}
+
+// isCapacityError reports whether err says the zone is out of capacity.
+func isCapacityError(err error) bool {
+	var p *upcloud.Problem
+	return errors.As(err, &p) && slices.Contains(capacityErrorCodes, p.ErrorCode())
+}
+
+// zones returns the configured zone followed by the fallback zones.
+func (g *InstanceGroup) zones() []string {
+	return append([]string{g.Zone}, g.FallbackZones...)
+}
+
+// createInZones creates a server in the configured zone and, while the
+// attempt fails for lack of capacity, in each of FallbackZones in turn, so
+// a full zone does not cost the instance slot. Zones paused for maintenance
+// are skipped, and a zone failing with a maintenance error is paused for
+// ZoneMaintenancePause. r.Zone is left at the zone of the last attempt.
+func (g *InstanceGroup) createInZones(ctx context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+	zones := g.zones()
+	var err error
+	for i, zone := range zones {
+		if p, paused := g.zonePaused(zone); paused {
+			if err == nil {
+				err = fmt.Errorf("zone %s: %w until %s (%s)", zone, errZonePaused, p.until.Format(time.RFC3339), p.reason)
+			}
+			continue
+		}
+		if i > 0 {
+			g.moveToZone(r, zone)
+		}
+		var details *upcloud.ServerDetails
+		details, err = g.createServer(ctx, r)
+		switch {
+		case err == nil:
+			return details, nil
+		case isMaintenanceError(err):
+			g.pauseZone(zone, time.Now().Add(time.Duration(g.ZoneMaintenancePause)), err.Error())
+		case !isCapacityError(err):
+			return nil, err
+		case i < len(zones)-1:
+			g.logger(logScaling).Warn("zone out of capacity; trying the next zone",
+				"hostname", r.Hostname, "zone", zone, "error", err)
+		}
+	}
+	return nil, err
+}
+
+// moveToZone retargets a create request at zone, cloning the zone's own
+// template when templates_by_zone maps one.
+func (g *InstanceGroup) moveToZone(r *request.CreateServerRequest, zone string) {
+	r.Zone = zone
+	template := g.templateForZone(zone)
+	for i, d := range r.StorageDevices {
+		if d.Action == request.CreateServerStorageDeviceActionClone {
+			r.StorageDevices[i].Storage = template
+		}
+	}
+	if r.Labels == nil {
+		return
+	}
+	for i, l := range *r.Labels {
+		if l.Key == templateLabelKey {
+			(*r.Labels)[i].Value = template
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	upcloud "github.com/UpCloudLtd/upcloud-go-api/v8/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/v8/upcloud/request"
+)
+
+// ─── zone failover ────────────────────────────────────────────────────────────
+
+// outOfCapacity is the problem UpCloud returns when a zone has no room left.
+var outOfCapacity = &upcloud.Problem{Status: 409, Type: "https://developers.upcloud.com/1.3/errors#ERROR_SERVER_RESOURCES_UNAVAILABLE"}
+
+func TestIncrease_FallbackZones(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      map[string]error
+		wantN     int
+		wantZones []string
+	}{
+		{name: "primary has room", wantN: 1, wantZones: []string{"fi-hel1"}},
+		{name: "primary full", fail: map[string]error{"fi-hel1": outOfCapacity}, wantN: 1, wantZones: []string{"fi-hel1", "fi-hel2"}},
+		{
+			name:      "all full",
+			fail:      map[string]error{"fi-hel1": outOfCapacity, "fi-hel2": outOfCapacity, "de-fra1": outOfCapacity},
+			wantZones: []string{"fi-hel1", "fi-hel2", "de-fra1"},
+		},
+		{
+			name:      "other transient error retried in place",
+			fail:      map[string]error{"fi-hel1": errors.New("connection reset")},
+			wantZones: []string{"fi-hel1", "fi-hel1", "fi-hel1", "fi-hel1"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var zones []string
+			mock := newMockSvc()
+			noServers(mock)
+			mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+				zones = append(zones, r.Zone)
+				if err := tc.fail[r.Zone]; err != nil {
+					return nil, err
+				}
+				return &upcloud.ServerDetails{}, nil
+			}
+
+			g := baseGroup(mock)
+			g.FallbackZones = []string{"fi-hel2", "de-fra1"}
+			g.CreateRetries = 3 // capacity errors move on without retrying
+			n, _ := g.Increase(context.Background(), 1)
+			if n != tc.wantN || !slices.Equal(zones, tc.wantZones) {
+				t.Errorf("Increase() = %d with zones %v, want %d with %v", n, zones, tc.wantN, tc.wantZones)
+			}
+		})
+	}
+}
+
+func TestIncrease_TemplatesByZone(t *testing.T) {
+	cloned := map[string]string{}
+	labelled := map[string]string{}
+	mock := newMockSvc()
+	noServers(mock)
+	mock.createServer = func(_ context.Context, r *request.CreateServerRequest) (*upcloud.ServerDetails, error) {
+		cloned[r.Zone] = r.StorageDevices[0].Storage
+		labelled[r.Zone], _ = labelValue(*r.Labels, templateLabelKey)
+		if r.Zone == "fi-hel1" {
+			return nil, outOfCapacity
+		}
+		return &upcloud.ServerDetails{}, nil
+	}
+
+	g := baseGroup(mock)
+	g.FallbackZones = []string{"de-fra1"}
+	g.TemplatesByZone = map[string]string{"de-fra1": "fra-template"}
+	if n, err := g.Increase(context.Background(), 1); n != 1 {
+		t.Fatalf("Increase() = %d, %v, want 1", n, err)
+	}
+	want := map[string]string{"fi-hel1": "template-uuid", "de-fra1": "fra-template"}
+	if !maps.Equal(cloned, want) || !maps.Equal(labelled, want) {
+		t.Errorf("cloned %v with labels %v, want %v", cloned, labelled, want)
+	}
+}
+
+func TestValidate_FallbackZones(t *testing.T) {
+	tests := []struct {
+		name    string
+		mod     func(*InstanceGroup)
+		wantErr bool
+	}{
+		{name: "valid", mod: func(g *InstanceGroup) { g.FallbackZones = []string{"z2", "z3"} }},
+		{name: "repeats zone", mod: func(g *InstanceGroup) { g.FallbackZones = []string{"z"} }, wantErr: true},
+		{name: "duplicate", mod: func(g *InstanceGroup) { g.FallbackZones = []string{"z2", "z2"} }, wantErr: true},
+		{name: "templates by zone", mod: func(g *InstanceGroup) {
+			g.Template, g.FallbackZones = "", []string{"z2"}
+			g.TemplatesByZone = map[string]string{"z": "t1", "z2": "t2"}
+		}},
+		{name: "templates by unknown zone", mod: func(g *InstanceGroup) {
+			g.TemplatesByZone = map[string]string{"z9": "t9"}
+		}, wantErr: true},
+		{name: "private network", mod: func(g *InstanceGroup) {
+			g.FallbackZones, g.UsePrivateNetwork = []string{"z2"}, true
+		}, wantErr: true},
+		{name: "template selector without zone template", mod: func(g *InstanceGroup) {
+			g.Template, g.FallbackZones = "", []string{"z2"}
+			g.TemplateSelector = map[string]string{"role": "runner"}
+		}, wantErr: true},
+		{name: "template selector with zone template", mod: func(g *InstanceGroup) {
+			g.Template, g.FallbackZones = "", []string{"z2"}
+			g.TemplateSelector = map[string]string{"role": "runner"}
+			g.TemplatesByZone = map[string]string{"z2": "t2"}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := InstanceGroup{Token: "tok", Zone: "z", Template: "t", Name: "n"}
+			tc.mod(&g)
+			if err := g.validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("validate() error = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckZone_FallbackZones(t *testing.T) {
+	mock := newMockSvc()
+	mock.getZones = func(context.Context) (*upcloud.Zones, error) {
+		return &upcloud.Zones{Zones: []upcloud.Zone{{ID: "fi-hel1"}, {ID: "fi-hel2"}}}, nil
+	}
+	g := baseGroup(mock)
+	g.FallbackZones = []string{"fi-hel2", "fi-hel9"}
+	if err := g.checkZone(context.Background()); err == nil {
+		t.Error("checkZone() expected error for an unknown fallback zone")
+	}
+}